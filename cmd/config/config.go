@@ -2,11 +2,90 @@ package config
 
 import (
 	"sync"
+	"time"
 )
 
 type Config struct {
-	Port        string `yaml:"Port"`
-	Environment string `yaml:"Environment"`
+	Port        string            `yaml:"Port"`
+	Environment string            `yaml:"Environment"`
+	Storage     StorageConfig     `yaml:"Storage"`
+	Lock        LockConfig        `yaml:"Lock"`
+	Tax         TaxConfig         `yaml:"Tax"`
+	Currency    CurrencyConfig    `yaml:"Currency"`
+	Inventory   InventoryConfig   `yaml:"Inventory"`
+	Basket      BasketConfig      `yaml:"Basket"`
+	Idempotency IdempotencyConfig `yaml:"Idempotency"`
+}
+
+// StorageConfig selects the Storage implementation. Type can be "memory"(default) or "file".
+// The file storage keeps its data on Path and writes a snapshot every SnapshotInterval.
+type StorageConfig struct {
+	Type             string        `yaml:"Type"`
+	Path             string        `yaml:"Path"`
+	SnapshotInterval time.Duration `yaml:"SnapshotInterval"`
+}
+
+// LockConfig selects the Locker implementation. Type can be "memory"(default) or "redis", the
+// redis lock uses the server on Address, shared by all the instances. TTL is the time after which
+// a lock not released or refreshed expires. Backoff is the wait between the attempts to lock a
+// locked resource.
+type LockConfig struct {
+	Type     string        `yaml:"Type"`
+	Address  string        `yaml:"Address"`
+	Password string        `yaml:"Password"`
+	TTL      time.Duration `yaml:"TTL"`
+	Backoff  BackoffConfig `yaml:"Backoff"`
+}
+
+// BackoffConfig has the first wait, multiplied by Multiplier on every attempt up to Max, the
+// jitter(fraction of the wait, randomized up and down) and the time after which the lock fails
+// with 423 Locked. Defaults are used for zero values.
+type BackoffConfig struct {
+	Initial    time.Duration `yaml:"Initial"`
+	Max        time.Duration `yaml:"Max"`
+	Multiplier float64       `yaml:"Multiplier"`
+	Jitter     float64       `yaml:"Jitter"`
+	MaxWait    time.Duration `yaml:"MaxWait"`
+}
+
+// TaxConfig has the VAT rates(percentage) by country and tax class. Country is the default
+// basket country, PricesIncludeTax tells if product prices include taxes and Rounding can be
+// "line"(default) or "total". Without rates no taxes are calculated.
+type TaxConfig struct {
+	Country          string                        `yaml:"Country"`
+	PricesIncludeTax bool                          `yaml:"PricesIncludeTax"`
+	Rounding         string                        `yaml:"Rounding"`
+	Rates            map[string]map[string]float64 `yaml:"Rates"`
+}
+
+// CurrencyConfig has the exchange rates used to price products in the currencies they have no
+// price in. Rates are units of every currency for one unit of Base(EUR if empty). RatesFile is a
+// yaml file with the rates(USD: 1.18), used instead of Rates when set.
+type CurrencyConfig struct {
+	Base      string             `yaml:"Base"`
+	Rates     map[string]float64 `yaml:"Rates"`
+	RatesFile string             `yaml:"RatesFile"`
+}
+
+// InventoryConfig has the time stock stays reserved for a basket line after its last change
+// (30m if zero).
+type InventoryConfig struct {
+	ReservationTTL time.Duration `yaml:"ReservationTTL"`
+}
+
+// BasketConfig has the idle time after which baskets expire(never if zero), the time expired
+// baskets are still reported as expired(410 Gone) and how often the janitor looks for idle
+// baskets(1m if zero).
+type BasketConfig struct {
+	TTL             time.Duration `yaml:"TTL"`
+	GracePeriod     time.Duration `yaml:"GracePeriod"`
+	JanitorInterval time.Duration `yaml:"JanitorInterval"`
+}
+
+// IdempotencyConfig has the time the responses to requests with an idempotency key are replayed
+// (24h if zero).
+type IdempotencyConfig struct {
+	Window time.Duration `yaml:"Window"`
 }
 
 var (
@@ -2,14 +2,123 @@ package container
 
 import (
 	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/cmd/config"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/clock"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/locker"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/storage"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
 )
 
-func NewContainer(ctx context.Context) *checkout.Container {
+const (
+	storageTypeMemory = "memory"
+	storageTypeFile   = "file"
+	lockTypeMemory    = "memory"
+	lockTypeRedis     = "redis"
+)
+
+func NewContainer(ctx context.Context, cfg config.Config) (*checkout.Container, error) {
+	// The storage & the domain share the clock
+	c := clock.NewClock()
+
+	s, err := newStorage(ctx, cfg.Storage, c)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := newLocker(ctx, cfg.Lock)
+	if err != nil {
+		return nil, err
+	}
+
+	tax, err := newTaxConfig(cfg.Tax)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange, err := newExchangeRates(cfg.Currency)
+	if err != nil {
+		return nil, err
+	}
+
 	return &checkout.Container{
-		Storage: storage.NewStorage(ctx),
-		Locker:  locker.NewLocker(ctx),
+		Storage:        s,
+		Locker:         l,
+		Clock:          c,
+		Tax:            tax,
+		Exchange:       exchange,
+		ReservationTTL: cfg.Inventory.ReservationTTL,
+		BasketTTL:      cfg.Basket.TTL,
+		BasketGrace:    cfg.Basket.GracePeriod,
+	}, nil
+}
+
+func newStorage(ctx context.Context, cfg config.StorageConfig, clock checkout.Clock) (checkout.Storage, error) {
+	switch cfg.Type {
+	case "", storageTypeMemory:
+		return storage.NewStorage(ctx, clock), nil
+	case storageTypeFile:
+		return storage.NewFileStorage(ctx, cfg.Path, cfg.SnapshotInterval, clock)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", cfg.Type)
+	}
+}
+
+func newLocker(ctx context.Context, cfg config.LockConfig) (checkout.Locker, error) {
+	backoff := locker.Backoff{
+		Initial:    cfg.Backoff.Initial,
+		Max:        cfg.Backoff.Max,
+		Multiplier: cfg.Backoff.Multiplier,
+		Jitter:     cfg.Backoff.Jitter,
+		MaxWait:    cfg.Backoff.MaxWait,
+	}
+
+	switch cfg.Type {
+	case "", lockTypeMemory:
+		return locker.NewLocker(ctx, cfg.TTL, backoff), nil
+	case lockTypeRedis:
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("redis lock address is required")
+		}
+		return locker.NewRedisLocker(ctx, cfg.Address, cfg.Password, cfg.TTL, backoff), nil
+	default:
+		return nil, fmt.Errorf("unknown lock type: %s", cfg.Type)
+	}
+}
+
+func newTaxConfig(cfg config.TaxConfig) (entities.TaxConfig, error) {
+	tax := entities.TaxConfig{
+		Country:          cfg.Country,
+		PricesIncludeTax: cfg.PricesIncludeTax,
+		Rounding:         entities.TaxRounding(cfg.Rounding),
+		Rates:            cfg.Rates,
+	}
+	if err := tax.Validate(); err != nil {
+		return entities.TaxConfig{}, fmt.Errorf("invalid tax config: %w", err)
+	}
+	return tax, nil
+}
+
+func newExchangeRates(cfg config.CurrencyConfig) (entities.ExchangeRates, error) {
+	exchange := entities.ExchangeRates{
+		Base:  cfg.Base,
+		Rates: cfg.Rates,
+	}
+	if cfg.RatesFile != "" {
+		data, err := ioutil.ReadFile(cfg.RatesFile)
+		if err != nil {
+			return entities.ExchangeRates{}, fmt.Errorf("exchange rates file error: %w", err)
+		}
+		exchange.Rates = make(map[string]float64)
+		if err := yaml.Unmarshal(data, &exchange.Rates); err != nil {
+			return entities.ExchangeRates{}, fmt.Errorf("exchange rates file error: %w", err)
+		}
+	}
+	if err := exchange.Validate(); err != nil {
+		return entities.ExchangeRates{}, fmt.Errorf("invalid currency config: %w", err)
 	}
+	return exchange, nil
 }
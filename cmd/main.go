@@ -6,28 +6,98 @@ import (
 	"github.com/gbrlmza/lana-bechallenge-checkout/cmd/config"
 	"github.com/gbrlmza/lana-bechallenge-checkout/cmd/container"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/idempotency"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics/prometheus"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/rest"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultJanitorInterval = time.Minute
+	shutdownTimeout        = 10 * time.Second
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Config
 	cfg := config.Get()
 
 	// Container & service initialization
-	container := container.NewContainer(ctx)
+	container, err := container.NewContainer(ctx, cfg)
+	if err != nil {
+		log.Fatalf("container initialization error: %v", err)
+	}
 	service := checkout.NewService(container)
 
+	// Basket janitor
+	janitor := startJanitor(ctx, service, cfg.Basket)
+
 	// Handler
-	handler := rest.NewHandler(service)
+	idempotencyStore := idempotency.NewStore(ctx, cfg.Idempotency.Window)
+	handler := rest.NewHandler(service, rest.WithIdempotencyStore(idempotencyStore))
 	router := handler.RouterInit()
 
 	// Start server
 	fmt.Printf("### Environment: %s\n", cfg.Environment)
 	fmt.Printf("### Starting server at port: %s\n", cfg.Port)
-	addr := fmt.Sprintf(":%s", cfg.Port)
-	log.Fatal(http.ListenAndServe(addr, router))
+	server := &http.Server{Addr: fmt.Sprintf(":%s", cfg.Port), Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for a shutdown signal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		log.Printf("server error: %v", err)
+	case sig := <-signals:
+		fmt.Printf("### Shutting down: %s\n", sig)
+	}
+
+	// Stop accepting requests & wait for the running ones, then stop the background jobs
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown error: %v", err)
+	}
+	if janitor != nil {
+		janitor.Stop()
+	}
+	if closer, ok := container.Storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("storage close error: %v", err)
+		}
+	}
+	if closer, ok := container.Locker.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("locker close error: %v", err)
+		}
+	}
+	cancel()
+}
+
+// startJanitor starts the janitor that expires idle baskets, if baskets expire.
+func startJanitor(ctx context.Context, service checkout.Service, cfg config.BasketConfig) *checkout.Janitor {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	interval := cfg.JanitorInterval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	janitor := checkout.NewJanitor(service, interval)
+	janitor.Start(metrics.WithMetrics(ctx, prometheus.NewMetrics()))
+	return janitor
 }
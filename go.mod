@@ -8,5 +8,6 @@ require (
 	github.com/google/uuid v1.1.2
 	github.com/prometheus/client_golang v1.7.1
 	github.com/stretchr/testify v1.6.1
+	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -2,6 +2,7 @@ package checkout
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
@@ -9,9 +10,42 @@ import (
 	"net/http"
 )
 
-func (s *service) BasketCreate(ctx context.Context) (*entities.Basket, error) {
+func (s *service) BasketCreate(ctx context.Context, basketDetail entities.BasketDetail) (*entities.Basket, error) {
 	basket := entities.NewBasket()
-	if err := s.Storage.BasketSave(ctx, basket); err != nil {
+
+	// Country used for taxes
+	basket.Country = basketDetail.Country
+	if basket.Country == "" {
+		basket.Country = s.Tax.Country
+	}
+	if s.Tax.IsEnabled() && !s.Tax.HasCountry(basket.Country) {
+		err := fmt.Errorf("country %s is not supported", basket.Country)
+		return nil, lanaerr.New(err, http.StatusBadRequest)
+	}
+
+	// Currency of all the basket amounts
+	if basketDetail.Currency != "" {
+		basket.Currency = basketDetail.Currency
+	}
+	if !s.Exchange.IsSupported(basket.Currency) {
+		err := fmt.Errorf("currency %s is not supported", basket.Currency)
+		return nil, lanaerr.New(err, http.StatusBadRequest)
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return nil, err
+	}
+	events := s.newBasketEvents(basket)
+	events.record(entities.NewBasketCreatedEvent(basket))
+
+	// Save basket & its creation, all or nothing. A new basket isn't locked by anyone yet, so
+	// it's saved without fencing token
+	err := s.Storage.WithTx(ctx, func(tx Storage) error {
+		if err := tx.BasketSave(ctx, basket, 0); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -27,89 +61,353 @@ func (s *service) BasketGet(ctx context.Context, basketID string) (*entities.Bas
 		return nil, err
 	}
 
+	// Open baskets are priced at the time they are read, so promotions that started or ended
+	// since the last change are taken into account
+	if !basket.IsCheckedOut() {
+		if err := s.priceBasket(ctx, basket); err != nil {
+			return nil, err
+		}
+	}
+
 	return basket, nil
 }
 
 func (s *service) BasketDelete(ctx context.Context, basketID string) error {
 	// Lock basket
 	lockKey := s.getBasketLockKey(basketID)
-	if err := s.Locker.Lock(ctx, lockKey); err != nil {
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
 		return err
 	}
-	defer s.Locker.Unlock(ctx, lockKey)
+	defer lock.Unlock(ctx)
 
-	// Delete basket
-	return s.Storage.BasketDelete(ctx, basketID)
+	// Get Basket, if it exists
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil && lanaerr.FromErr(err).GetStatusCode() != http.StatusNotFound {
+		return err
+	}
+	found := err == nil
+	if !found {
+		if err := s.checkBasketMissing(ctx, basketID); err != nil {
+			return err
+		}
+	}
+	events := s.newBasketEvents(basket)
+	if found {
+		if err := s.checkBasketVersion(ctx, basket); err != nil {
+			return err
+		}
+
+		// A checked out basket is kept as its order was placed
+		if err := s.checkBasketOpen(basket); err != nil {
+			return err
+		}
+		events.record(entities.NewBasketDeletedEvent(basket))
+	}
+
+	// Release the stock reserved by the basket & delete basket, all or nothing
+	release := found
+	if release {
+		unlockStock, err := s.lockBasketStock(ctx, basket)
+		if err != nil {
+			return err
+		}
+		defer unlockStock()
+	}
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		if release {
+			if err := s.releaseStock(ctx, tx, basket); err != nil {
+				return err
+			}
+		}
+		if err := tx.BasketDelete(ctx, basketID, lock.Token()); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
 }
 
 func (s *service) BasketAddItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
 	// Lock basket
 	lockKey := s.getBasketLockKey(basketID)
-	if err := s.Locker.Lock(ctx, lockKey); err != nil {
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
 		return err
 	}
-	defer s.Locker.Unlock(ctx, lockKey)
+	defer lock.Unlock(ctx)
 
 	// Get Basket
 	basket, err := s.Storage.BasketGet(ctx, basketID)
 	if err != nil {
 		return err
 	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
+	}
 
-	// Obtain product
-	product, err := s.Storage.ProductGet(ctx, itemDetail.ProductID)
+	// Add item
+	events := s.newBasketEvents(basket)
+	if err := s.addItem(ctx, basket, itemDetail, events); err != nil {
+		return err
+	}
+
+	// Reserve stock for the whole line & save basket
+	if err := s.saveBasketReservingStock(ctx, lock, basket, itemDetail.ProductID, events); err != nil {
+		return err
+	}
+
+	// Metric
+	metrics.Counter(ctx, "basket_items_added", float64(itemDetail.Quantity))
+
+	// Done
+	return nil
+}
+
+func (s *service) BasketRemoveItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
 	if err != nil {
 		return err
 	}
+	defer lock.Unlock(ctx)
 
-	// Check if product is already in the basket
-	basketItem := basket.GetItem(itemDetail.ProductID)
-	if basketItem == nil { // If not, create new basket item
-		var promotion *entities.Promotion
-		if product.PromotionID != nil {
-			if promotion, err = s.Storage.PromotionGet(ctx, *product.PromotionID); err != nil {
-				return err
-			}
-		}
-		basketItem = entities.NewBasketItem(*product, promotion)
+	// Get Basket
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
 	}
 
-	// Add quantity
-	basketItem.AddQuantity(itemDetail.Quantity)
+	// Remove item
+	events := s.newBasketEvents(basket)
+	if err := s.removeItem(ctx, basket, itemDetail, events); err != nil {
+		return err
+	}
 
-	// Save item in basket
-	basket.SaveItem(basketItem)
+	// Release the removed stock & save basket
+	if err := s.saveBasketReservingStock(ctx, lock, basket, itemDetail.ProductID, events); err != nil {
+		return err
+	}
+
+	// Done
+	return nil
+}
+
+func (s *service) BasketSetItemQuantity(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx)
+
+	// Get Basket
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
+	}
 
-	// Save basket
-	if err := s.Storage.BasketSave(ctx, basket); err != nil {
+	// Set quantity
+	events := s.newBasketEvents(basket)
+	added, err := s.setItemQuantity(ctx, basket, itemDetail, events)
+	if err != nil {
+		return err
+	}
+
+	// The basket isn't saved again if the quantity is the same
+	if events.empty() {
+		return nil
+	}
+
+	// Reserve stock for the whole line & save basket
+	if err := s.saveBasketReservingStock(ctx, lock, basket, itemDetail.ProductID, events); err != nil {
 		return err
 	}
 
 	// Metric
-	metrics.Counter(ctx, "basket_items_added", float64(itemDetail.Quantity))
+	if added > 0 {
+		metrics.Counter(ctx, "basket_items_added", float64(added))
+	}
 
 	// Done
 	return nil
 }
 
-func (s *service) BasketRemoveItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+// BasketUpdateItems applies several item operations to the basket at once. The operations are
+// applied in order and the basket saved once, if any of them fails nothing is applied.
+func (s *service) BasketUpdateItems(ctx context.Context, basketID string, operations []entities.ItemOperation) error {
+	if len(operations) == 0 {
+		return lanaerr.New(errors.New("at least one operation is required"), http.StatusBadRequest)
+	}
+
 	// Lock basket
 	lockKey := s.getBasketLockKey(basketID)
-	if err := s.Locker.Lock(ctx, lockKey); err != nil {
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
 		return err
 	}
-	defer s.Locker.Unlock(ctx, lockKey)
+	defer lock.Unlock(ctx)
 
 	// Get Basket
 	basket, err := s.Storage.BasketGet(ctx, basketID)
 	if err != nil {
 		return err
 	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
+	}
 
+	// Apply operations. The last operation changing every product is kept to name it if the
+	// stock reservation of the product fails
+	productIDs := make([]string, 0, len(operations))
+	lastOperation := make(map[string]int, len(operations))
+	events := s.newBasketEvents(basket)
+	added := uint(0)
+	for i, operation := range operations {
+		if _, ok := lastOperation[operation.ProductID]; !ok {
+			productIDs = append(productIDs, operation.ProductID)
+		}
+		lastOperation[operation.ProductID] = i
+
+		units, err := s.applyItemOperation(ctx, basket, operation, events)
+		if err != nil {
+			return itemOperationError(i, operation, err)
+		}
+		added += units
+	}
+
+	// The basket isn't saved again if no operation changed it
+	if events.empty() {
+		return nil
+	}
+
+	// Reserve stock for the resulting lines & save basket, all or nothing
+	unlockStock, err := s.lockProductsStock(ctx, productIDs)
+	if err != nil {
+		return err
+	}
+	defer unlockStock()
+	err = s.Storage.WithTx(ctx, func(tx Storage) error {
+		if productID, err := s.reserveItemsStock(ctx, tx, basket, productIDs); err != nil {
+			i := lastOperation[productID]
+			return itemOperationError(i, operations[i], err)
+		}
+		if err := tx.BasketSave(ctx, basket, lock.Token()); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Metric
+	if added > 0 {
+		metrics.Counter(ctx, "basket_items_added", float64(added))
+	}
+
+	// Done
+	return nil
+}
+
+// applyItemOperation applies the operation to the basket, returning the units added.
+func (s *service) applyItemOperation(ctx context.Context, basket *entities.Basket, operation entities.ItemOperation, events *basketEvents) (uint, error) {
+	switch operation.Op {
+	case entities.ItemOperationAdd:
+		return operation.Quantity, s.addItem(ctx, basket, operation.ItemDetail, events)
+	case entities.ItemOperationRemove:
+		return 0, s.removeItem(ctx, basket, operation.ItemDetail, events)
+	case entities.ItemOperationSet:
+		return s.setItemQuantity(ctx, basket, operation.ItemDetail, events)
+	default:
+		err := fmt.Errorf("unknown operation %s", operation.Op)
+		return 0, lanaerr.New(err, http.StatusBadRequest)
+	}
+}
+
+// itemOperationError names the failing operation in the error, keeping its status code.
+func itemOperationError(i int, operation entities.ItemOperation, err error) error {
+	err = fmt.Errorf("operations[%d] %s %s: %w", i, operation.Op, operation.ProductID, err)
+	return lanaerr.FromErr(errors.Unwrap(err)).WithErr(err)
+}
+
+// addItem adds units of a product to the basket. The line is always priced with the current
+// product & promotions.
+func (s *service) addItem(ctx context.Context, basket *entities.Basket, itemDetail entities.ItemDetail, events *basketEvents) error {
+	// Obtain product, priced in the basket currency
+	product, err := s.Storage.ProductGet(ctx, itemDetail.ProductID)
+	if err != nil {
+		return err
+	}
+	product, err = product.InCurrency(basket.GetCurrency(), s.Exchange)
+	if err != nil {
+		return err
+	}
+
+	// Obtain promotions
+	promotions := make([]*entities.Promotion, 0, len(product.PromotionIDs))
+	for _, promotionID := range product.PromotionIDs {
+		promotion, err := s.Storage.PromotionGet(ctx, promotionID)
+		if err != nil {
+			return err
+		}
+		converted := s.Exchange.ConvertPromotion(*promotion, basket.GetCurrency())
+		promotions = append(promotions, &converted)
+	}
+
+	// If the product is already in the basket, keep its quantity
+	quantity := uint(0)
+	if current := basket.GetItem(itemDetail.ProductID); current != nil {
+		quantity = current.Quantity
+	}
+	basketItem := entities.NewBasketItem(*product, promotions...)
+
+	// Add quantity
+	basketItem.AddQuantity(quantity + itemDetail.Quantity)
+
+	// Save item in basket
+	basket.SaveItem(basketItem)
+	events.record(entities.NewItemAddedEvent(basket, basketItem, itemDetail.Quantity))
+	return nil
+}
+
+// removeItem removes units of a product from the basket.
+func (s *service) removeItem(ctx context.Context, basket *entities.Basket, itemDetail entities.ItemDetail, events *basketEvents) error {
 	// Check if product is in the basket
 	basketItem := basket.GetItem(itemDetail.ProductID)
 	if basketItem == nil {
-		err := fmt.Errorf("item %s not found in basket %s", itemDetail.ProductID, basketID)
+		err := fmt.Errorf("item %s not found in basket %s", itemDetail.ProductID, basket.ID)
 		return lanaerr.New(err, http.StatusNotFound)
 	}
 
@@ -120,13 +418,188 @@ func (s *service) BasketRemoveItem(ctx context.Context, basketID string, itemDet
 
 	// Update item in basket
 	basket.SaveItem(basketItem)
+	events.record(entities.NewItemRemovedEvent(basket, itemDetail.ProductID, itemDetail.Quantity))
+	return nil
+}
+
+// setItemQuantity sets the quantity of a product in the basket, returning the units added. More
+// units are added like addItem does, so the line is priced with the current product, and fewer
+// units are removed like removeItem does. A zero quantity removes the line.
+func (s *service) setItemQuantity(ctx context.Context, basket *entities.Basket, itemDetail entities.ItemDetail, events *basketEvents) (uint, error) {
+	current := uint(0)
+	if item := basket.GetItem(itemDetail.ProductID); item != nil {
+		current = item.Quantity
+	}
+
+	switch {
+	case itemDetail.Quantity > current:
+		added := itemDetail.Quantity - current
+		return added, s.addItem(ctx, basket, entities.ItemDetail{ProductID: itemDetail.ProductID, Quantity: added}, events)
+	case itemDetail.Quantity < current:
+		removed := current - itemDetail.Quantity
+		return 0, s.removeItem(ctx, basket, entities.ItemDetail{ProductID: itemDetail.ProductID, Quantity: removed}, events)
+	}
+	return 0, nil
+}
 
-	// Save basket
-	if err := s.Storage.BasketSave(ctx, basket); err != nil {
+func (s *service) BasketCheckout(ctx context.Context, basketID string) (*entities.Order, error) {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Get Basket
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return nil, err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return nil, err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return nil, err
+	}
+	if len(basket.Items) == 0 {
+		err := fmt.Errorf("basket %s is empty", basketID)
+		return nil, lanaerr.New(err, http.StatusBadRequest)
+	}
+
+	// Check coupons
+	coupons, unlockCoupons, err := s.lockCoupons(ctx, basket)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockCoupons()
+
+	// Check stock
+	stocks, unlockStock, err := s.lockStock(ctx, basket)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockStock()
+
+	// Locking coupons & stock takes a while, the basket must still be locked before any write
+	if err := lock.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	// Save the order, coupons usage, stock & basket, all or nothing
+	order := entities.NewOrder(*basket)
+	events := s.newBasketEvents(basket)
+	err = s.Storage.WithTx(ctx, func(tx Storage) error {
+		// Freeze basket lines into a new order
+		if err := tx.OrderSave(ctx, order); err != nil {
+			return err
+		}
+
+		// Count coupons usage
+		if err := s.redeemCoupons(ctx, tx, coupons); err != nil {
+			return err
+		}
+
+		// Take the lines from the stock on hand
+		if err := s.commitStock(ctx, tx, stocks); err != nil {
+			return err
+		}
+
+		// Close basket
+		basket.CheckOut(order)
+		if err := tx.BasketSave(ctx, basket, lock.Token()); err != nil {
+			return err
+		}
+		events.record(entities.NewBasketCheckedOutEvent(basket))
+		return events.append(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Metric
+	metrics.Counter(ctx, "basket_checked_out", 1)
+
+	return order, nil
+}
+
+// saveBasket saves the basket & its events, all or nothing.
+func (s *service) saveBasket(ctx context.Context, lock Lock, basket *entities.Basket, events *basketEvents) error {
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		if err := tx.BasketSave(ctx, basket, lock.Token()); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
+}
+
+// saveBasketReservingStock reserves the quantity of the product in the basket and saves the
+// basket & its events, all or nothing.
+func (s *service) saveBasketReservingStock(ctx context.Context, lock Lock, basket *entities.Basket, productID string, events *basketEvents) error {
+	unlockStock, err := s.lockProductsStock(ctx, []string{productID})
+	if err != nil {
 		return err
 	}
+	defer unlockStock()
 
-	// Done
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		if err := s.reserveItemStock(ctx, tx, basket, productID); err != nil {
+			return err
+		}
+		if err := tx.BasketSave(ctx, basket, lock.Token()); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
+}
+
+// priceBasket prices the basket at the current time with the configured taxes and the current
+// promotions and coupons: the promotions copied into the basket & its lines, and the applied
+// coupons, are replaced by their current version, so promotions changed, ended or deleted since are
+// taken into account, and coupons are discounted as they're defined now. Their amounts are
+// converted to the basket currency.
+func (s *service) priceBasket(ctx context.Context, basket *entities.Basket) error {
+	promotions, err := s.Storage.PromotionList(ctx)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]entities.Promotion, len(promotions))
+	for i := range promotions {
+		promotions[i] = s.Exchange.ConvertPromotion(promotions[i], basket.GetCurrency())
+		current[promotions[i].ID] = promotions[i]
+	}
+
+	for productID, item := range basket.Items {
+		item.UpdatePromotions(current)
+		basket.Items[productID] = item
+	}
+	basket.SetPromotions(promotions)
+
+	coupons := make(map[string]entities.Coupon, len(basket.Coupons))
+	for _, applied := range basket.Coupons {
+		coupon, err := s.Storage.CouponGet(ctx, applied.Code)
+		if lanaerr.FromErr(err).GetStatusCode() == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		coupons[coupon.Code] = s.Exchange.ConvertCoupon(*coupon, basket.GetCurrency())
+	}
+	basket.UpdateCoupons(coupons)
+	basket.TaxConfig = s.Tax
+	basket.Reprice(s.Clock.Now())
+	return nil
+}
+
+func (s *service) checkBasketOpen(basket *entities.Basket) error {
+	if basket.IsCheckedOut() {
+		err := fmt.Errorf("basket %s is already checked out", basket.ID)
+		return lanaerr.New(err, http.StatusConflict)
+	}
 	return nil
 }
 
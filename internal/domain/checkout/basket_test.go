@@ -4,40 +4,61 @@ import (
 	"context"
 	"errors"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"net/http"
 	"testing"
+	"time"
 )
 
 type serviceTest struct {
 	Ctx       context.Context
 	Locker    *FakeLocker
 	Storage   *FakeStorage
+	Clock     *FakeClock
 	Container *Container
 	Service   Service
 }
 
+func buildTestTaxConfig() entities.TaxConfig {
+	return entities.TaxConfig{
+		Country:          "ES",
+		PricesIncludeTax: true,
+		Rates:            map[string]map[string]float64{"ES": {"standard": 21}},
+	}
+}
+
 func buildTestDependencies() serviceTest {
 	st := serviceTest{
 		Ctx:     context.Background(),
 		Locker:  &FakeLocker{},
 		Storage: &FakeStorage{},
+		Clock:   &FakeClock{Time: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)},
 	}
 	st.Container = &Container{
 		Locker:  st.Locker,
 		Storage: st.Storage,
+		Clock:   st.Clock,
 	}
 	st.Service = NewService(st.Container)
 	return st
 }
 
+// withoutStock makes the products have no stock, so their quantities aren't limited.
+func withoutStock(st serviceTest) {
+	err := lanaerr.New(errors.New("stock not found"), http.StatusNotFound)
+	st.Storage.On("StockGet", st.Ctx, mock.Anything).Return((*entities.Stock)(nil), err)
+}
+
 func Test_service_BasketCreate_Error(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(errors.New("save-error"))
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(errors.New("save-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
-	basket, err := st.Service.BasketCreate(st.Ctx)
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{})
 
 	// Then
 	assert.EqualError(t, err, "save-error")
@@ -49,10 +70,12 @@ func Test_service_BasketCreate_Error(t *testing.T) {
 func Test_service_BasketCreate_Success(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, uint64(0)).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
-	basket, err := st.Service.BasketCreate(st.Ctx)
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{})
 
 	// Then
 	assert.NotNil(t, basket)
@@ -61,6 +84,73 @@ func Test_service_BasketCreate_Success(t *testing.T) {
 	st.Locker.AssertExpectations(t)
 }
 
+func Test_service_BasketCreate_CountryError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.Tax = buildTestTaxConfig()
+
+	// When
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{Country: "FR"})
+
+	// Then
+	assert.EqualError(t, err, "country FR is not supported")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, basket)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketCreate_Taxes(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.Tax = buildTestTaxConfig()
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.Country == "ES" && b.Taxes != nil
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{})
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, "ES", basket.Country)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketCreate_CurrencyError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+
+	// When
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{Currency: "USD"})
+
+	// Then
+	assert.EqualError(t, err, "currency USD is not supported")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, basket)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketCreate_Currency(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.Exchange = entities.ExchangeRates{Rates: map[string]float64{"USD": 1.18}}
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.Currency == "USD" && b.Total.Currency == "USD"
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	basket, err := st.Service.BasketCreate(st.Ctx, entities.BasketDetail{Currency: "USD"})
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", basket.Currency)
+	st.Storage.AssertExpectations(t)
+}
+
 func Test_service_BasketGet_Error(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
@@ -83,6 +173,7 @@ func Test_service_BasketGet_Success(t *testing.T) {
 	st := buildTestDependencies()
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
 	basket, err := st.Service.BasketGet(st.Ctx, basketID)
@@ -116,7 +207,9 @@ func Test_service_BasketDelete_StorageError(t *testing.T) {
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
 	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
-	st.Storage.On("BasketDelete", st.Ctx, basketID).Return(errors.New("delete-error"))
+	st.Storage.On("BasketGet", st.Ctx, basketID).
+		Return((*entities.Basket)(nil), lanaerr.New(errors.New("not found"), http.StatusNotFound))
+	st.Storage.On("BasketDelete", st.Ctx, basketID, mock.Anything).Return(errors.New("delete-error"))
 
 	// When
 	err := st.Service.BasketDelete(st.Ctx, basketID)
@@ -133,7 +226,20 @@ func Test_service_BasketDelete_Success(t *testing.T) {
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
 	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
-	st.Storage.On("BasketDelete", st.Ctx, basketID).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 3},
+		},
+	}, nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve(basketID, 3, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		return s.Reserved == 0 && s.Available == 10
+	})).Return(nil)
+	st.Storage.On("BasketDelete", st.Ctx, basketID, uint64(1)).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
 
 	// When
 	err := st.Service.BasketDelete(st.Ctx, basketID)
@@ -144,6 +250,45 @@ func Test_service_BasketDelete_Success(t *testing.T) {
 	st.Locker.AssertExpectations(t)
 }
 
+func Test_service_BasketDelete_CheckedOut(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	checkedOutAt := st.Clock.Now()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID:           basketID,
+		CheckedOutAt: &checkedOutAt,
+	}, nil)
+
+	// When
+	err := st.Service.BasketDelete(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is already checked out")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketDelete_GetBasketError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return((*entities.Basket)(nil), errors.New("get-error"))
+
+	// When
+	err := st.Service.BasketDelete(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "get-error")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
 func Test_service_BasketAddItem_LockError(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
@@ -190,6 +335,7 @@ func Test_service_BasketAddItem_GetProductError(t *testing.T) {
 	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{ID: basketID}, nil)
 	st.Storage.On("ProductGet", st.Ctx, item.ProductID).
 		Return(&entities.Product{}, errors.New("get-product-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
 	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
@@ -210,11 +356,13 @@ func Test_service_BasketAddItem_GetPromotionError(t *testing.T) {
 	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
 	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{ID: basketID}, nil)
 	st.Storage.On("ProductGet", st.Ctx, item.ProductID).Return(&entities.Product{
-		ID:          "PEN",
-		PromotionID: &promotion.ID,
+		ID:           "PEN",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{promotion.ID},
 	}, nil)
 	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).
 		Return(&entities.Promotion{}, errors.New("get-promotion-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
 	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
@@ -228,6 +376,7 @@ func Test_service_BasketAddItem_GetPromotionError(t *testing.T) {
 func Test_service_BasketAddItem_SaveBasketError(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
+	withoutStock(st)
 	item := entities.ItemDetail{ProductID: "PEN", Quantity: 10}
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	promotion := entities.Promotion{ID: "2X1"}
@@ -238,11 +387,13 @@ func Test_service_BasketAddItem_SaveBasketError(t *testing.T) {
 		Items: make(map[string]entities.BasketItem),
 	}, nil)
 	st.Storage.On("ProductGet", st.Ctx, item.ProductID).Return(&entities.Product{
-		ID:          "PEN",
-		PromotionID: &promotion.ID,
+		ID:           "PEN",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{promotion.ID},
 	}, nil)
 	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).Return(&entities.Promotion{}, nil)
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(errors.New("save-basket-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(errors.New("save-basket-error"))
 
 	// When
 	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
@@ -256,6 +407,7 @@ func Test_service_BasketAddItem_SaveBasketError(t *testing.T) {
 func Test_service_BasketAddItem_Success(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
+	withoutStock(st)
 	item := entities.ItemDetail{ProductID: "PEN", Quantity: 10}
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	promotion := entities.Promotion{ID: "2X1"}
@@ -266,11 +418,14 @@ func Test_service_BasketAddItem_Success(t *testing.T) {
 		Items: make(map[string]entities.BasketItem),
 	}, nil)
 	st.Storage.On("ProductGet", st.Ctx, item.ProductID).Return(&entities.Product{
-		ID:          "PEN",
-		PromotionID: &promotion.ID,
+		ID:           "PEN",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{promotion.ID},
 	}, nil)
 	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).Return(&entities.Promotion{}, nil)
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
 
 	// When
 	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
@@ -325,6 +480,7 @@ func Test_service_BasketRemoveItem_ProductNotInBasketError(t *testing.T) {
 	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
 	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
 	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{ID: basketID}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
 	err := st.Service.BasketRemoveItem(st.Ctx, basketID, item)
@@ -348,6 +504,7 @@ func Test_service_BasketRemoveItem_QuantityError(t *testing.T) {
 			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
 		},
 	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
 
 	// When
 	err := st.Service.BasketRemoveItem(st.Ctx, basketID, item)
@@ -361,6 +518,7 @@ func Test_service_BasketRemoveItem_QuantityError(t *testing.T) {
 func Test_service_BasketRemoveItem_SaveBasketError(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
+	withoutStock(st)
 	item := entities.ItemDetail{ProductID: "PEN", Quantity: 1}
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
 	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
@@ -371,7 +529,8 @@ func Test_service_BasketRemoveItem_SaveBasketError(t *testing.T) {
 			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
 		},
 	}, nil)
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(errors.New("save-basket-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(errors.New("save-basket-error"))
 
 	// When
 	err := st.Service.BasketRemoveItem(st.Ctx, basketID, item)
@@ -383,10 +542,61 @@ func Test_service_BasketRemoveItem_SaveBasketError(t *testing.T) {
 }
 
 func Test_service_BasketRemoveItem_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	item := entities.ItemDetail{ProductID: "PEN", Quantity: 1}
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
+		},
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketRemoveItem(st.Ctx, basketID, item)
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_CheckedOutError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	item := entities.ItemDetail{ProductID: "PEN", Quantity: 10}
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	checkedOutAt := time.Now()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID:           basketID,
+		CheckedOutAt: &checkedOutAt,
+	}, nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is already checked out")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketRemoveItem_CheckedOutError(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
 	item := entities.ItemDetail{ProductID: "PEN", Quantity: 1}
 	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	checkedOutAt := time.Now()
 	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
 	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
 	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
@@ -394,14 +604,785 @@ func Test_service_BasketRemoveItem_Success(t *testing.T) {
 		Items: map[string]entities.BasketItem{
 			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
 		},
+		CheckedOutAt: &checkedOutAt,
 	}, nil)
-	st.Storage.On("BasketSave", st.Ctx, mock.Anything).Return(nil)
 
 	// When
 	err := st.Service.BasketRemoveItem(st.Ctx, basketID, item)
 
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is already checked out")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_LockError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, "basket-1680cd34-931e-4b0c-b7e3-ab314d688398").
+		Return(errors.New("lock-error"))
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "lock-error")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_GetBasketError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).
+		Return(&entities.Basket{}, errors.New("get-basket-error"))
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "get-basket-error")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_CheckedOutError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	checkedOutAt := time.Now()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID:           basketID,
+		CheckedOutAt: &checkedOutAt,
+	}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is already checked out")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_EmptyBasketError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{ID: basketID}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is empty")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_SaveOrderError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
+		},
+	}, nil)
+	st.Storage.On("OrderSave", st.Ctx, mock.Anything).Return(errors.New("save-order-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "save-order-error")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_LockExpiredError(t *testing.T) {
+	// Given: the basket lock expired while locking the stock
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, "basket-"+basketID).Return(errors.New("lock-expired"))
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
+		},
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then: nothing is saved
+	assert.EqualError(t, err, "lock-expired")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_SaveBasketError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
+		},
+	}, nil)
+	st.Storage.On("OrderSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(errors.New("save-basket-error"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "save-basket-error")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 1},
+		},
+	}, nil)
+	st.Storage.On("OrderSave", st.Ctx, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(1).(*entities.Order).ID = "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	}).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.IsCheckedOut() && b.OrderID == "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
 	// Then
 	assert.Nil(t, err)
+	assert.Equal(t, basketID, order.BasketID)
+	assert.Equal(t, 1, len(order.Items))
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_ExistingItem_CurrentPrice(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	item := entities.ItemDetail{ProductID: "MUG", Quantity: 1}
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	oldProduct := entities.Product{ID: "MUG", Price: entities.NewMoney(750, entities.DefaultCurrency)}
+	newProduct := entities.Product{ID: "MUG", Price: entities.NewMoney(800, entities.DefaultCurrency)}
+	basketItem := entities.NewBasketItem(oldProduct, nil)
+	basketItem.AddQuantity(2)
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	basket.SaveItem(basketItem)
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("ProductGet", st.Ctx, item.ProductID).Return(&newProduct, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		mug := b.Items["MUG"]
+		return mug.Quantity == 3 && mug.Total == entities.NewMoney(2400, entities.DefaultCurrency)
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_PromotionListError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	item := entities.ItemDetail{ProductID: "MUG", Quantity: 1}
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(entities.NewBasket(), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, errors.New("list-error"))
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, item)
+
+	// Then
+	assert.EqualError(t, err, "list-error")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_BasketPromotion(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	pen := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, nil)
+	pen.AddQuantity(1)
+	basket.SaveItem(pen)
+	bundle := entities.Promotion{
+		ID:   "PENMUG",
+		Type: entities.PromotionTypeCrossProductBundle,
+		CrossProductBundle: &entities.CrossProductBundleParams{
+			Items:    []entities.BundleItem{{ProductID: "PEN", Quantity: 1}, {ProductID: "MUG", Quantity: 1}},
+			Discount: entities.NewMoney(200, entities.DefaultCurrency),
+		},
+	}
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{
+		ID:    "MUG",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{{ID: "2X1"}, bundle}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return len(b.Discounts) == 1 && b.Discounts[0].PromotionID == "PENMUG" &&
+			b.Discount.Equal(entities.NewMoney(200, entities.DefaultCurrency)) &&
+			b.Total.Equal(entities.NewMoney(1050, entities.DefaultCurrency))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "MUG", Quantity: 1})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketGet_PromotionEnded(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	endsAt := st.Clock.Time.Add(-time.Minute)
+	promotion := &entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1, EndsAt: &endsAt}
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, promotion)
+	item.AddQuantity(2)
+	basket.SaveItem(item)
+	assert.Equal(t, entities.NewMoney(500, entities.DefaultCurrency), basket.Discount)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{*promotion}, nil)
+
+	// When
+	b, err := st.Service.BasketGet(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, entities.Zero(entities.DefaultCurrency), b.Discount)
+	assert.Equal(t, entities.NewMoney(1000, entities.DefaultCurrency), b.Total)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketGet_PromotionEndedEarly(t *testing.T) {
+	// Given: a basket priced with a promotion without end, ended afterwards by an admin
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	promotion := &entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, promotion)
+	item.AddQuantity(2)
+	basket.SaveItem(item)
+	endsAt := st.Clock.Time.Add(-time.Minute)
+	ended := *promotion
+	ended.EndsAt = &endsAt
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{ended}, nil)
+
+	// When
+	b, err := st.Service.BasketGet(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, entities.Zero(entities.DefaultCurrency), b.Discount)
+	assert.Equal(t, entities.NewMoney(1000, entities.DefaultCurrency), b.Total)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketGet_PromotionDeleted(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	promotion := &entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, promotion)
+	item.AddQuantity(2)
+	basket.SaveItem(item)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	b, err := st.Service.BasketGet(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, entities.Zero(entities.DefaultCurrency), b.Discount)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_MultiplePromotions(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(entities.NewBasket(), nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:           "PEN",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{"2X1", "10OFF"},
+	}, nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{
+		ID: "2X1", RequiredItems: 2, FreeItems: 1, Stacking: entities.StackingBestForCustomer,
+	}, nil)
+	st.Storage.On("PromotionGet", st.Ctx, "10OFF").Return(&entities.Promotion{
+		ID: "10OFF", Reduction: 10, Stacking: entities.StackingBestForCustomer,
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		item := b.Items["PEN"]
+		return len(item.Promotions) == 2 && len(item.AppliedPromotions) == 1 &&
+			item.AppliedPromotions[0].PromotionID == "2X1" &&
+			item.Discount.Equal(entities.NewMoney(500, entities.DefaultCurrency))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 2})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_NoPriceInCurrency(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.Currency = "USD"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1})
+
+	// Then
+	assert.EqualError(t, err, "product PEN has no price in USD")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_Currency(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	st.Container.Exchange = entities.ExchangeRates{Rates: map[string]float64{"USD": 1.18}}
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.Currency = "USD"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:           "PEN",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{"1OFF"},
+	}, nil)
+	st.Storage.On("PromotionGet", st.Ctx, "1OFF").Return(&entities.Promotion{
+		ID:          "1OFF",
+		Type:        entities.PromotionTypeFixedAmount,
+		FixedAmount: &entities.FixedAmountParams{Amount: entities.NewMoney(100, entities.DefaultCurrency)},
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		item := b.Items["PEN"]
+		return item.Product.Price.Equal(entities.NewMoney(590, "USD")) &&
+			item.Discount.Equal(entities.NewMoney(236, "USD")) &&
+			b.Total.Equal(entities.NewMoney(944, "USD"))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 2})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketSetItemQuantity_Add(t *testing.T) {
+	// Given: the product price changed since the line was added
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 2), nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(600, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.Items["PEN"].Quantity == 4 && b.Total.Equal(entities.NewMoney(2400, entities.DefaultCurrency))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 4})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketSetItemQuantity_Remove(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.Items["PEN"].Quantity == 2
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 2})
+
+	// Then: the product isn't loaded again
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketSetItemQuantity_ZeroRemovesItem(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return len(b.Items) == 0
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 0})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketSetItemQuantity_SameQuantity(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 5})
+	errZero := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "MUG", Quantity: 0})
+
+	// Then: nothing changed, the basket isn't saved nor its version incremented
+	assert.Nil(t, err)
+	assert.Nil(t, errZero)
+	st.Storage.AssertNotCalled(t, "BasketSave", mock.Anything, mock.Anything, mock.Anything)
+	st.Storage.AssertNotCalled(t, "BasketEventsAppend", mock.Anything, mock.Anything, mock.Anything)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketSetItemQuantity_CheckedOutError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestStockBasket(basketID, 5)
+	basket.CheckOut(&entities.Order{ID: "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"})
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+
+	// When
+	err := st.Service.BasketSetItemQuantity(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1})
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 is already checked out")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_NoOperationsError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, "1680cd34-931e-4b0c-b7e3-ab314d688398", nil)
+
+	// Then
+	assert.EqualError(t, err, "at least one operation is required")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_OperationError(t *testing.T) {
+	// Given: the second operation removes more units than the first one leaves
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	operations := []entities.ItemOperation{
+		{Op: entities.ItemOperationSet, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+		{Op: entities.ItemOperationRemove, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 3}},
+	}
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, basketID, operations)
+
+	// Then: nothing is saved
+	assert.EqualError(t, err, "operations[1] remove PEN: can't remove 3 PEN. item quantity: 2")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_UnknownOperationError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	operations := []entities.ItemOperation{
+		{Op: "replace", ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+	}
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, basketID, operations)
+
+	// Then
+	assert.EqualError(t, err, "operations[0] replace PEN: unknown operation replace")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_StockError(t *testing.T) {
+	// Given: MUG is reserved before the PEN reservation fails
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 1), nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{
+		ID:    "MUG",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("StockGet", st.Ctx, "MUG").Return(entities.NewStock("MUG", 10), nil).Once()
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		return s.ProductID == "MUG" && s.Reserved == 2
+	})).Return(nil).Once()
+	stock := entities.NewStock("PEN", 3)
+	stock.Reserve(basketID, 1, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	operations := []entities.ItemOperation{
+		{Op: entities.ItemOperationAdd, ItemDetail: entities.ItemDetail{ProductID: "MUG", Quantity: 2}},
+		{Op: entities.ItemOperationSet, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 4}},
+	}
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, basketID, operations)
+
+	// Then: the transaction fails, so the storage rolls back the MUG reservation, and the basket
+	// isn't saved
+	assert.EqualError(t, err, "operations[1] set PEN: not enough stock of PEN: 3 available")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{
+		ID:    "MUG",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return b.Items["PEN"].Quantity == 3 && b.Items["MUG"].Quantity == 2
+	}), mock.Anything).Return(nil).Once()
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	operations := []entities.ItemOperation{
+		{Op: entities.ItemOperationAdd, ItemDetail: entities.ItemDetail{ProductID: "MUG", Quantity: 1}},
+		{Op: entities.ItemOperationRemove, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+		{Op: entities.ItemOperationSet, ItemDetail: entities.ItemDetail{ProductID: "MUG", Quantity: 2}},
+	}
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, basketID, operations)
+
+	// Then: the basket is saved once
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_VersionMismatchError(t *testing.T) {
+	// Given: the basket was modified after the client read version 3
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestStockBasket(basketID, 2)
+	basket.Version = 4
+	ctx := WithBasketVersions(st.Ctx, []uint64{3})
+	st.Locker.On("Lock", ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", ctx, basketID).Return(basket, nil)
+
+	// When
+	err := st.Service.BasketAddItem(ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1})
+
+	// Then: nothing is saved
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 was modified, current version is 4")
+	assert.Equal(t, http.StatusPreconditionFailed, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketDelete_VersionMatch(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestStockBasket(basketID, 2)
+	basket.Version = 4
+	ctx := WithBasketVersions(st.Ctx, []uint64{3, 4})
+	st.Locker.On("Lock", ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", ctx, basketID).Return(basket, nil)
+	st.Storage.On("StockGet", ctx, "PEN").Return((*entities.Stock)(nil), lanaerr.New(errors.New("stock not found"), http.StatusNotFound))
+	st.Storage.On("BasketDelete", ctx, basketID, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketDelete(ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketDelete_VersionNotFound(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	ctx := WithBasketVersions(st.Ctx, []uint64{4})
+	st.Locker.On("Lock", ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", ctx, basketID).
+		Return((*entities.Basket)(nil), lanaerr.New(errors.New("basket not found"), http.StatusNotFound))
+
+	// When
+	err := st.Service.BasketDelete(ctx, basketID)
+
+	// Then: the expected version isn't there
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 not found, it isn't in the required version")
+	assert.Equal(t, http.StatusPreconditionFailed, lanaerr.FromErr(err).GetStatusCode())
 	st.Storage.AssertExpectations(t)
 	st.Locker.AssertExpectations(t)
 }
@@ -3,6 +3,7 @@ package checkout
 import (
 	"context"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"time"
 )
 
 // The container has all the external functionality required by the business logic(domain).
@@ -14,25 +15,77 @@ import (
 // Also allows us to test the domain logic regardless of the specific repository implementations.
 
 type Container struct {
-	Storage Storage
-	Locker  Locker
+	Storage        Storage
+	Locker         Locker
+	Clock          Clock
+	Tax            entities.TaxConfig
+	Exchange       entities.ExchangeRates
+	ReservationTTL time.Duration // Stock reservations expiry, defaultReservationTTL if zero
+	BasketTTL      time.Duration // Idle time until a basket expires, never if zero
+	BasketGrace    time.Duration // Time expired baskets are reported as expired(410)
 }
 
 type Storage interface {
 	// Basket
-	BasketSave(ctx context.Context, basket *entities.Basket) error
+	// Basket writes carry the fencing token of the basket lock, see Lock
+	BasketSave(ctx context.Context, basket *entities.Basket, fencingToken uint64) error
 	BasketGet(ctx context.Context, basketID string) (*entities.Basket, error)
-	BasketDelete(ctx context.Context, basketID string) error
+	BasketDelete(ctx context.Context, basketID string, fencingToken uint64) error
+	BasketListIdle(ctx context.Context, since time.Time) ([]entities.Basket, error) // Open baskets only
+	BasketExpire(ctx context.Context, basketID string, graceUntil time.Time, fencingToken uint64) error
+
+	// Basket history. Appended events are numbered after the last event of the basket and are
+	// never changed nor deleted, even if the basket is deleted
+	BasketEventsAppend(ctx context.Context, basketID string, events []entities.BasketEvent) error
+	BasketEventsGet(ctx context.Context, basketID string) ([]entities.BasketEvent, error)
 
 	// Product
 	ProductGet(ctx context.Context, productID string) (*entities.Product, error)
 	ProductList(ctx context.Context) ([]entities.Product, error)
+	ProductSave(ctx context.Context, product *entities.Product) error
+	ProductDelete(ctx context.Context, productID string) error
 
 	// Promotion
 	PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error)
+	PromotionList(ctx context.Context) ([]entities.Promotion, error)
+	PromotionSave(ctx context.Context, promotion *entities.Promotion) error
+	PromotionDelete(ctx context.Context, promotionID string) error
+
+	// Coupon
+	CouponGet(ctx context.Context, code string) (*entities.Coupon, error)
+	CouponSave(ctx context.Context, coupon *entities.Coupon) error
+
+	// Order
+	OrderSave(ctx context.Context, order *entities.Order) error
+	OrderGet(ctx context.Context, orderID string) (*entities.Order, error)
+
+	// Stock
+	StockGet(ctx context.Context, productID string) (*entities.Stock, error)
+	StockSave(ctx context.Context, stock *entities.Stock) error
+
+	// Transaction. The unit of work does all its reads & writes with tx, if it returns an error
+	// all its writes are rolled back
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 }
 
+// Locker locks resources for a while(the lock TTL). Only the owner of a lock, the returned
+// handle, can release it or extend its TTL.
 type Locker interface {
-	Lock(ctx context.Context, resource string) error
-	Unlock(ctx context.Context, resource string) error
+	Lock(ctx context.Context, resource string) (Lock, error)
+}
+
+// Lock is a lock held on a resource. Unlock and Refresh fail if the lock isn't held anymore,
+// like when it expired and another owner locked the resource.
+//
+// Every acquisition has a fencing token greater than the previous ones of the resource. The
+// storage rejects writes with an older token than the last one it accepted, so a holder paused
+// until its lock expired can't overwrite the changes of the next holder.
+type Lock interface {
+	Unlock(ctx context.Context) error
+	Refresh(ctx context.Context) error
+	Token() uint64
+}
+
+type Clock interface {
+	Now() time.Time
 }
@@ -4,58 +4,172 @@ import (
 	"context"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
-//==================================================================================================
+// ==================================================================================================
 // Fake Storage
-//==================================================================================================
+// ==================================================================================================
 type FakeStorage struct {
 	mock.Mock
 }
 
-func (f FakeStorage) BasketSave(ctx context.Context, basket *entities.Basket) error {
-	args := f.Called(ctx, basket)
+func (f *FakeStorage) BasketSave(ctx context.Context, basket *entities.Basket, fencingToken uint64) error {
+	args := f.Called(ctx, basket, fencingToken)
 	return args.Error(0)
 }
 
-func (f FakeStorage) BasketGet(ctx context.Context, basketID string) (*entities.Basket, error) {
+func (f *FakeStorage) BasketGet(ctx context.Context, basketID string) (*entities.Basket, error) {
 	args := f.Called(ctx, basketID)
 	return args.Get(0).(*entities.Basket), args.Error(1)
 }
 
-func (f FakeStorage) BasketDelete(ctx context.Context, basketID string) error {
-	args := f.Called(ctx, basketID)
+func (f *FakeStorage) BasketDelete(ctx context.Context, basketID string, fencingToken uint64) error {
+	args := f.Called(ctx, basketID, fencingToken)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) BasketListIdle(ctx context.Context, since time.Time) ([]entities.Basket, error) {
+	args := f.Called(ctx, since)
+	return args.Get(0).([]entities.Basket), args.Error(1)
+}
+
+func (f *FakeStorage) BasketExpire(ctx context.Context, basketID string, graceUntil time.Time, fencingToken uint64) error {
+	args := f.Called(ctx, basketID, graceUntil, fencingToken)
 	return args.Error(0)
 }
 
-func (f FakeStorage) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
+func (f *FakeStorage) BasketEventsAppend(ctx context.Context, basketID string, events []entities.BasketEvent) error {
+	args := f.Called(ctx, basketID, events)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) BasketEventsGet(ctx context.Context, basketID string) ([]entities.BasketEvent, error) {
+	args := f.Called(ctx, basketID)
+	return args.Get(0).([]entities.BasketEvent), args.Error(1)
+}
+
+func (f *FakeStorage) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
 	args := f.Called(ctx, productID)
 	return args.Get(0).(*entities.Product), args.Error(1)
 }
 
-func (f FakeStorage) ProductList(ctx context.Context) ([]entities.Product, error) {
+func (f *FakeStorage) ProductList(ctx context.Context) ([]entities.Product, error) {
 	args := f.Called(ctx)
 	return args.Get(0).([]entities.Product), args.Error(1)
 }
 
-func (f FakeStorage) PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error) {
+func (f *FakeStorage) ProductSave(ctx context.Context, product *entities.Product) error {
+	args := f.Called(ctx, product)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) ProductDelete(ctx context.Context, productID string) error {
+	args := f.Called(ctx, productID)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error) {
 	args := f.Called(ctx, promotionID)
 	return args.Get(0).(*entities.Promotion), args.Error(1)
 }
 
-//==================================================================================================
+func (f *FakeStorage) PromotionList(ctx context.Context) ([]entities.Promotion, error) {
+	args := f.Called(ctx)
+	return args.Get(0).([]entities.Promotion), args.Error(1)
+}
+
+func (f *FakeStorage) PromotionSave(ctx context.Context, promotion *entities.Promotion) error {
+	args := f.Called(ctx, promotion)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) PromotionDelete(ctx context.Context, promotionID string) error {
+	args := f.Called(ctx, promotionID)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) CouponGet(ctx context.Context, code string) (*entities.Coupon, error) {
+	args := f.Called(ctx, code)
+	return args.Get(0).(*entities.Coupon), args.Error(1)
+}
+
+func (f *FakeStorage) CouponSave(ctx context.Context, coupon *entities.Coupon) error {
+	args := f.Called(ctx, coupon)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) OrderSave(ctx context.Context, order *entities.Order) error {
+	args := f.Called(ctx, order)
+	return args.Error(0)
+}
+
+func (f *FakeStorage) OrderGet(ctx context.Context, orderID string) (*entities.Order, error) {
+	args := f.Called(ctx, orderID)
+	return args.Get(0).(*entities.Order), args.Error(1)
+}
+
+func (f *FakeStorage) StockGet(ctx context.Context, productID string) (*entities.Stock, error) {
+	args := f.Called(ctx, productID)
+	return args.Get(0).(*entities.Stock), args.Error(1)
+}
+
+func (f *FakeStorage) StockSave(ctx context.Context, stock *entities.Stock) error {
+	args := f.Called(ctx, stock)
+	return args.Error(0)
+}
+
+// WithTx runs the unit of work with the fake itself, the rollback is tested on the storages
+func (f *FakeStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return fn(f)
+}
+
+// ==================================================================================================
 // Fake Locker
-//==================================================================================================
+// ==================================================================================================
 type FakeLocker struct {
 	mock.Mock
+	fence uint64
 }
 
-func (f FakeLocker) Lock(ctx context.Context, resource string) error {
+func (f *FakeLocker) Lock(ctx context.Context, resource string) (Lock, error) {
 	args := f.Called(ctx, resource)
+	if err := args.Error(0); err != nil {
+		return nil, err
+	}
+	f.fence++
+	return &FakeLock{locker: f, resource: resource, fence: f.fence}, nil
+}
+
+// FakeLock reports its calls to the locker mock as Unlock(ctx, resource) & Refresh(ctx, resource).
+// The fencing tokens are 1, 2, 3... in the order the locks are taken.
+type FakeLock struct {
+	locker   *FakeLocker
+	resource string
+	fence    uint64
+}
+
+func (f *FakeLock) Unlock(ctx context.Context) error {
+	args := f.locker.MethodCalled("Unlock", ctx, f.resource)
 	return args.Error(0)
 }
 
-func (f FakeLocker) Unlock(ctx context.Context, resource string) error {
-	args := f.Called(ctx, resource)
+func (f *FakeLock) Refresh(ctx context.Context) error {
+	args := f.locker.MethodCalled("Refresh", ctx, f.resource)
 	return args.Error(0)
 }
+
+func (f *FakeLock) Token() uint64 {
+	return f.fence
+}
+
+// ==================================================================================================
+// Fake Clock
+// ==================================================================================================
+type FakeClock struct {
+	Time time.Time
+}
+
+func (f *FakeClock) Now() time.Time {
+	return f.Time
+}
@@ -0,0 +1,234 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+)
+
+// Coupons are checked(expiry, usage limit & minimum basket total) when they are applied to a
+// basket and again on checkout, when their usage is counted. A coupon whose minimum is no longer
+// reached because items were removed stays in the basket without discount.
+//
+// Coupons are created and updated by the admin endpoints. Their usage is only counted on checkout,
+// it's never taken from the payload.
+
+func (s *service) CouponGet(ctx context.Context, code string) (*entities.Coupon, error) {
+	return s.Storage.CouponGet(ctx, code)
+}
+
+func (s *service) CouponCreate(ctx context.Context, coupon entities.Coupon) (*entities.Coupon, error) {
+	// Validate coupon
+	if err := coupon.Validate(); err != nil {
+		return nil, err
+	}
+	coupon.Used = 0
+
+	// Lock coupon
+	lockKey := s.getCouponLockKey(coupon.Code)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check unique code
+	_, err = s.Storage.CouponGet(ctx, coupon.Code)
+	if err == nil {
+		err := fmt.Errorf("coupon %s already exists", coupon.Code)
+		return nil, lanaerr.New(err, http.StatusConflict)
+	}
+	if lanaerr.FromErr(err).GetStatusCode() != http.StatusNotFound {
+		return nil, err
+	}
+
+	// Save coupon
+	if err := s.Storage.CouponSave(ctx, &coupon); err != nil {
+		return nil, err
+	}
+
+	return &coupon, nil
+}
+
+func (s *service) CouponUpdate(ctx context.Context, code string, coupon entities.Coupon) (*entities.Coupon, error) {
+	// Validate coupon
+	coupon.Code = code
+	if err := coupon.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Lock coupon
+	lockKey := s.getCouponLockKey(code)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check coupon exists & keep its usage
+	stored, err := s.Storage.CouponGet(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	coupon.Used = stored.Used
+
+	// Save coupon
+	if err := s.Storage.CouponSave(ctx, &coupon); err != nil {
+		return nil, err
+	}
+
+	return &coupon, nil
+}
+
+func (s *service) BasketApplyCoupon(ctx context.Context, basketID string, couponDetail entities.CouponDetail) error {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx)
+
+	// Get Basket
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
+	}
+
+	// Obtain coupon, with its amounts in the basket currency
+	coupon, err := s.Storage.CouponGet(ctx, couponDetail.Code)
+	if err != nil {
+		return err
+	}
+	converted := s.Exchange.ConvertCoupon(*coupon, basket.GetCurrency())
+	coupon = &converted
+
+	// Check coupon can be used on this basket
+	if err := coupon.CheckRedeemable(s.Clock.Now()); err != nil {
+		return err
+	}
+	if err := coupon.CheckMinBasketTotal(basket.TotalBeforeCoupons()); err != nil {
+		return err
+	}
+
+	// Apply coupon
+	if err := basket.AddCoupon(*coupon); err != nil {
+		return err
+	}
+	events := s.newBasketEvents(basket)
+	events.record(entities.NewCouponAppliedEvent(basket, *coupon))
+
+	// Save basket
+	if err := s.saveBasket(ctx, lock, basket, events); err != nil {
+		return err
+	}
+
+	// Metric
+	metrics.Counter(ctx, "basket_coupons_applied", 1)
+
+	// Done
+	return nil
+}
+
+func (s *service) BasketRemoveCoupon(ctx context.Context, basketID string, code string) error {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx)
+
+	// Get Basket
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkBasketVersion(ctx, basket); err != nil {
+		return err
+	}
+	if err := s.checkBasketOpen(basket); err != nil {
+		return err
+	}
+	if err := s.priceBasket(ctx, basket); err != nil {
+		return err
+	}
+
+	// Remove coupon
+	if err := basket.RemoveCoupon(code); err != nil {
+		return err
+	}
+	events := s.newBasketEvents(basket)
+	events.record(entities.NewCouponRemovedEvent(basket, code))
+
+	// Save basket
+	return s.saveBasket(ctx, lock, basket, events)
+}
+
+// lockCoupons locks and checks the coupons giving a discount to the basket. The returned unlock
+// function must be called once the usage of the coupons is saved.
+func (s *service) lockCoupons(ctx context.Context, basket *entities.Basket) ([]*entities.Coupon, func(), error) {
+	coupons := make([]*entities.Coupon, 0, len(basket.Coupons))
+	locks := make([]Lock, 0, len(basket.Coupons))
+	unlock := func() {
+		for _, lock := range locks {
+			lock.Unlock(ctx)
+		}
+	}
+
+	for _, applied := range basket.Coupons {
+		if applied.Discount.IsZero() {
+			continue
+		}
+
+		// Lock coupon
+		lockKey := s.getCouponLockKey(applied.Code)
+		lock, err := s.Locker.Lock(ctx, lockKey)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		locks = append(locks, lock)
+
+		// Current usage
+		coupon, err := s.Storage.CouponGet(ctx, applied.Code)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		if err := coupon.CheckRedeemable(s.Clock.Now()); err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	return coupons, unlock, nil
+}
+
+// redeemCoupons counts the usage of the coupons locked by lockCoupons.
+func (s *service) redeemCoupons(ctx context.Context, tx Storage, coupons []*entities.Coupon) error {
+	for _, coupon := range coupons {
+		coupon.Used++
+		if err := tx.CouponSave(ctx, coupon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) getCouponLockKey(code string) string {
+	return fmt.Sprintf("coupon-%s", code)
+}
@@ -0,0 +1,398 @@
+package checkout
+
+import (
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func buildTestCouponBasket(basketID string) *entities.Basket {
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, nil)
+	item.AddQuantity(4)
+	basket.SaveItem(item)
+	return basket
+}
+
+func Test_service_CouponCreate_ValidationError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	coupon := entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 110}
+
+	// When
+	c, err := st.Service.CouponCreate(st.Ctx, coupon)
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF percent must be greater than 0 and up to 100")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, c)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_CouponCreate_AlreadyExistsError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	coupon := entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10}
+	st.Locker.On("Lock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&coupon, nil)
+
+	// When
+	c, err := st.Service.CouponCreate(st.Ctx, coupon)
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF already exists")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, c)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_CouponCreate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	coupon := entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10, Used: 5}
+	created := coupon
+	created.Used = 0
+	st.Locker.On("Lock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").
+		Return(&entities.Coupon{}, lanaerr.New(errors.New("coupon 10OFF not found"), http.StatusNotFound))
+	st.Storage.On("CouponSave", st.Ctx, &created).Return(nil)
+
+	// When
+	c, err := st.Service.CouponCreate(st.Ctx, coupon)
+
+	// Then: the usage isn't taken from the payload
+	assert.Nil(t, err)
+	assert.Equal(t, &created, c)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_CouponUpdate_NotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	coupon := entities.Coupon{DiscountType: entities.CouponDiscountPercentage, Percent: 10}
+	notFound := lanaerr.New(errors.New("coupon 10OFF not found"), http.StatusNotFound)
+	st.Locker.On("Lock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{}, notFound)
+
+	// When
+	c, err := st.Service.CouponUpdate(st.Ctx, "10OFF", coupon)
+
+	// Then
+	assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, c)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_CouponUpdate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	coupon := entities.Coupon{DiscountType: entities.CouponDiscountPercentage, Percent: 15}
+	updated := coupon
+	updated.Code = "10OFF"
+	updated.Used = 7
+	st.Locker.On("Lock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10, Used: 7,
+	}, nil)
+	st.Storage.On("CouponSave", st.Ctx, &updated).Return(nil)
+
+	// When
+	c, err := st.Service.CouponUpdate(st.Ctx, "10OFF", coupon)
+
+	// Then: the usage is kept
+	assert.Nil(t, err)
+	assert.Equal(t, &updated, c)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketApplyCoupon_LockError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(errors.New("lock-error"))
+
+	// When
+	err := st.Service.BasketApplyCoupon(st.Ctx, basketID, entities.CouponDetail{Code: "10OFF"})
+
+	// Then
+	assert.EqualError(t, err, "lock-error")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketApplyCoupon_CouponNotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestCouponBasket(basketID), nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").
+		Return(&entities.Coupon{}, notFound("coupon 10OFF not found"))
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketApplyCoupon(st.Ctx, basketID, entities.CouponDetail{Code: "10OFF"})
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF not found")
+	assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketApplyCoupon_ExpiredError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	expiresAt := st.Clock.Time.Add(-time.Hour)
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestCouponBasket(basketID), nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code:         "10OFF",
+		DiscountType: entities.CouponDiscountPercentage,
+		Percent:      10,
+		ExpiresAt:    &expiresAt,
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketApplyCoupon(st.Ctx, basketID, entities.CouponDetail{Code: "10OFF"})
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF is expired")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketApplyCoupon_MinBasketTotalError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestCouponBasket(basketID), nil)
+	st.Storage.On("CouponGet", st.Ctx, "5OFF").Return(&entities.Coupon{
+		Code:           "5OFF",
+		DiscountType:   entities.CouponDiscountFixedAmount,
+		Amount:         entities.NewMoney(500, entities.DefaultCurrency),
+		MinBasketTotal: entities.NewMoney(5000, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketApplyCoupon(st.Ctx, basketID, entities.CouponDetail{Code: "5OFF"})
+
+	// Then
+	assert.EqualError(t, err, "coupon 5OFF requires a basket total of at least 50.00 EUR")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketApplyCoupon_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, "basket-"+basketID).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "basket-"+basketID).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestCouponBasket(basketID), nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code:         "10OFF",
+		DiscountType: entities.CouponDiscountPercentage,
+		Percent:      10,
+	}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return len(b.Coupons) == 1 && b.Total.Equal(entities.NewMoney(1800, entities.DefaultCurrency))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, basketID, mock.MatchedBy(func(events []entities.BasketEvent) bool {
+		return len(events) == 1 && events[0].Type == entities.BasketEventCouponApplied &&
+			events[0].Coupon.Code == "10OFF" && events[0].Total.Equal(entities.NewMoney(1800, entities.DefaultCurrency))
+	})).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketApplyCoupon(st.Ctx, basketID, entities.CouponDetail{Code: "10OFF"})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketRemoveCoupon_NotAppliedError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestCouponBasket(basketID), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketRemoveCoupon(st.Ctx, basketID, "10OFF")
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF not found in basket 1680cd34-931e-4b0c-b7e3-ab314d688398")
+	assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketGet_CouponChanged(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestCouponBasket(basketID)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 20,
+	}, nil)
+
+	// When
+	b, err := st.Service.BasketGet(st.Ctx, basketID)
+
+	// Then: the coupon is discounted as it's defined now
+	assert.Nil(t, err)
+	assert.Equal(t, float64(20), b.Coupons[0].Coupon.Percent)
+	assert.Equal(t, entities.NewMoney(400, entities.DefaultCurrency), b.Coupons[0].Discount)
+	assert.Equal(t, entities.NewMoney(1600, entities.DefaultCurrency), b.Total)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketGet_CouponDeleted(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestCouponBasket(basketID)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{}, notFound("coupon 10OFF not found"))
+
+	// When
+	b, err := st.Service.BasketGet(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, b.Coupons)
+	assert.Equal(t, entities.NewMoney(2000, entities.DefaultCurrency), b.Total)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketRemoveCoupon_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestCouponBasket(basketID)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10,
+	}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.MatchedBy(func(b *entities.Basket) bool {
+		return len(b.Coupons) == 0 && b.Total.Equal(entities.NewMoney(2000, entities.DefaultCurrency))
+	}), mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, basketID, mock.MatchedBy(func(events []entities.BasketEvent) bool {
+		return len(events) == 1 && events[0].Type == entities.BasketEventCouponRemoved &&
+			events[0].CouponCode == "10OFF" && events[0].Total.Equal(entities.NewMoney(2000, entities.DefaultCurrency))
+	})).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	err := st.Service.BasketRemoveCoupon(st.Ctx, basketID, "10OFF")
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_CouponUsageLimitError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestCouponBasket(basketID)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code:         "10OFF",
+		DiscountType: entities.CouponDiscountPercentage,
+		Percent:      10,
+		UsageLimit:   1,
+		Used:         1,
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.EqualError(t, err, "coupon 10OFF usage limit reached")
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_CouponRedeemed(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := buildTestCouponBasket(basketID)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	st.Locker.On("Lock", st.Ctx, "basket-"+basketID).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "basket-"+basketID).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Lock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "coupon-10OFF").Return(nil)
+	st.Locker.On("Lock", st.Ctx, "stock-PEN").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "stock-PEN").Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(basket, nil)
+	st.Storage.On("CouponGet", st.Ctx, "10OFF").Return(&entities.Coupon{
+		Code:         "10OFF",
+		DiscountType: entities.CouponDiscountPercentage,
+		Percent:      10,
+		UsageLimit:   2,
+		Used:         1,
+	}, nil)
+	withoutStock(st)
+	st.Storage.On("OrderSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("CouponSave", st.Ctx, mock.MatchedBy(func(c *entities.Coupon) bool {
+		return c.Code == "10OFF" && c.Used == 2
+	})).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(order.Coupons))
+	assert.Equal(t, entities.NewMoney(1800, entities.DefaultCurrency), order.Total)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
@@ -4,3 +4,23 @@ type ItemDetail struct {
 	ProductID string `json:"id"`
 	Quantity  uint   `json:"quantity"`
 }
+
+type ItemOperationType string
+
+const (
+	ItemOperationAdd    ItemOperationType = "add"
+	ItemOperationRemove ItemOperationType = "remove"
+	ItemOperationSet    ItemOperationType = "set"
+)
+
+// ItemOperation is a change of a basket item: add or remove units of the product or set its
+// quantity.
+type ItemOperation struct {
+	Op ItemOperationType `json:"op"`
+	ItemDetail
+}
+
+type BasketDetail struct {
+	Country  string `json:"country"`
+	Currency string `json:"currency"`
+}
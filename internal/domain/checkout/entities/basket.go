@@ -1,25 +1,73 @@
 package entities
 
 import (
-	"math"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
 	"time"
 )
 
 type Basket struct {
-	ID        string                `json:"id"`
-	CreatedAt time.Time             `json:"created_at"`
-	Items     map[string]BasketItem `json:"items"`
-	Subtotal  float64               `json:"subtotal"`
-	Discount  float64               `json:"discount"`
-	Total     float64               `json:"total"`
+	ID                string                `json:"id"`
+	CreatedAt         time.Time             `json:"created_at"`
+	LastModifiedAt    time.Time             `json:"last_modified_at"`
+	Version           uint64                `json:"version"`            // Incremented by every save
+	Currency          string                `json:"currency,omitempty"` // See currency.go
+	Items             map[string]BasketItem `json:"items"`
+	Subtotal          Money                 `json:"subtotal"`
+	Discount          Money                 `json:"discount"`
+	Discounts         []BasketDiscount      `json:"discounts,omitempty"`
+	Coupons           []AppliedCoupon       `json:"coupons,omitempty"`
+	AppliedPromotions []AppliedPromotion    `json:"applied_promotions,omitempty"`
+	Total             Money                 `json:"total"`
+	Taxes             *TaxAmounts           `json:"taxes,omitempty"`
+	Country           string                `json:"country,omitempty"`
+	CheckedOutAt      *time.Time            `json:"checked_out_at,omitempty"`
+	OrderID           string                `json:"order_id,omitempty"`
+	Promotions        []Promotion           `json:"-"` // Basket level promotions
+	PricedAt          time.Time             `json:"-"` // Time used to check the promotions windows
+	TaxConfig         TaxConfig             `json:"-"` // See tax.go
 }
 
 func NewBasket() *Basket {
 	b := &Basket{}
 	b.Items = make(map[string]BasketItem, 0)
+	b.Currency = DefaultCurrency
+	b.Subtotal = Zero(DefaultCurrency)
+	b.Discount = Zero(DefaultCurrency)
+	b.Total = Zero(DefaultCurrency)
 	return b
 }
 
+// CheckOut marks the basket as checked out. A checked out basket can't be modified anymore.
+func (b *Basket) CheckOut(order *Order) {
+	checkedOutAt := order.CreatedAt
+	b.CheckedOutAt = &checkedOutAt
+	b.OrderID = order.ID
+}
+
+func (b *Basket) IsCheckedOut() bool {
+	return b.CheckedOutAt != nil
+}
+
+// GetCurrency returns the currency of the basket. Baskets created before baskets had a currency
+// are in the default currency.
+func (b *Basket) GetCurrency() string {
+	if b.Currency == "" {
+		return DefaultCurrency
+	}
+	return b.Currency
+}
+
+// IdleSince returns the time of the last change of the basket. Baskets saved before the last
+// change was tracked are idle since they were created.
+func (b *Basket) IdleSince() time.Time {
+	if b.LastModifiedAt.IsZero() {
+		return b.CreatedAt
+	}
+	return b.LastModifiedAt
+}
+
 func (b *Basket) GetItem(productID string) *BasketItem {
 	if item, ok := b.Items[productID]; ok {
 		return &item
@@ -27,7 +75,23 @@ func (b *Basket) GetItem(productID string) *BasketItem {
 	return nil
 }
 
+// Reprice calculates all the amounts of the basket again with the promotions active at the given
+// time.
+func (b *Basket) Reprice(now time.Time) {
+	b.PricedAt = now
+	for id, item := range b.Items {
+		item.Reprice(now)
+		b.Items[id] = item
+	}
+
+	// Recalculate totals amounts
+	b.updateTotals()
+}
+
 func (b *Basket) SaveItem(item *BasketItem) {
+	// Price the item at the same time as the rest of the basket
+	item.Reprice(b.PricedAt)
+
 	if item.Quantity == 0 {
 		// If the item has zero quantity, remove it from basket
 		delete(b.Items, item.Product.ID)
@@ -40,16 +104,122 @@ func (b *Basket) SaveItem(item *BasketItem) {
 	b.updateTotals()
 }
 
+// AddCoupon applies the coupon to the basket. Every coupon can be applied only once.
+func (b *Basket) AddCoupon(coupon Coupon) error {
+	if b.GetCoupon(coupon.Code) != nil {
+		err := fmt.Errorf("coupon %s is already applied to basket %s", coupon.Code, b.ID)
+		return lanaerr.New(err, http.StatusConflict)
+	}
+
+	b.Coupons = append(b.Coupons, AppliedCoupon{Code: coupon.Code, Coupon: coupon})
+
+	// Recalculate totals amounts
+	b.updateTotals()
+	return nil
+}
+
+func (b *Basket) RemoveCoupon(code string) error {
+	for i := range b.Coupons {
+		if b.Coupons[i].Code == code {
+			b.Coupons = append(b.Coupons[:i:i], b.Coupons[i+1:]...)
+			if len(b.Coupons) == 0 {
+				b.Coupons = nil
+			}
+
+			// Recalculate totals amounts
+			b.updateTotals()
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("coupon %s not found in basket %s", code, b.ID)
+	return lanaerr.New(err, http.StatusNotFound)
+}
+
+// TotalBeforeCoupons returns the basket total with the promotions but without coupon discounts
+// and taxes not included in the prices.
+func (b *Basket) TotalBeforeCoupons() Money {
+	total := b.Subtotal.Sub(b.Discount)
+	for _, c := range b.Coupons {
+		total = total.Add(c.Discount)
+	}
+	return total
+}
+
+// UpdateCoupons replaces the coupons applied to the basket by their current version, keeping their
+// order. Coupons not found don't apply anymore.
+func (b *Basket) UpdateCoupons(current map[string]Coupon) {
+	var coupons []AppliedCoupon
+	for _, c := range b.Coupons {
+		if updated, ok := current[c.Code]; ok {
+			coupons = append(coupons, AppliedCoupon{Code: c.Code, Discount: c.Discount, Coupon: updated})
+		}
+	}
+	b.Coupons = coupons
+	b.updateTotals()
+}
+
+func (b *Basket) GetCoupon(code string) *AppliedCoupon {
+	for i := range b.Coupons {
+		if b.Coupons[i].Code == code {
+			return &b.Coupons[i]
+		}
+	}
+	return nil
+}
+
+// SetPromotions sets the basket level promotions. Other promotions are ignored.
+func (b *Basket) SetPromotions(promotions []Promotion) {
+	b.Promotions = make([]Promotion, 0)
+	for _, promotion := range promotions {
+		if promotion.IsBasketLevel() {
+			b.Promotions = append(b.Promotions, promotion)
+		}
+	}
+
+	// Recalculate totals amounts
+	b.updateTotals()
+}
+
 func (b *Basket) updateTotals() {
-	b.Subtotal = 0
-	b.Discount = 0
+	b.Subtotal = Zero(b.GetCurrency())
+	b.Discount = Zero(b.GetCurrency())
 	for _, i := range b.Items {
-		b.Subtotal += i.Total
-		b.Discount += i.Discount
+		b.Subtotal = b.Subtotal.Add(i.Total)
+		b.Discount = b.Discount.Add(i.Discount)
+	}
+
+	// Basket level promotions
+	b.Discounts = nil
+	active := make([]Promotion, 0, len(b.Promotions))
+	for _, promotion := range b.Promotions {
+		if promotion.IsActive(b.PricedAt) {
+			active = append(active, promotion)
+		}
+	}
+	if discounts := applyBasketPromotions(b, active); len(discounts) > 0 {
+		b.Discounts = discounts
+	}
+	for _, d := range b.Discounts {
+		b.Discount = b.Discount.Add(d.Amount)
+	}
+	b.AppliedPromotions = summarizePromotions(b)
+
+	// Coupons apply on the total after promotions, in the order they were added. A coupon
+	// whose minimum basket total is not reached stays in the basket without discount
+	promotionsTotal := b.Subtotal.Sub(b.Discount)
+	remaining := promotionsTotal
+	for i := range b.Coupons {
+		c := &b.Coupons[i]
+		c.Discount = Zero(remaining.Currency)
+		if c.Coupon.CheckMinBasketTotal(promotionsTotal) == nil {
+			c.Discount = c.Coupon.Apply(remaining)
+		}
+		remaining = remaining.Sub(c.Discount)
+		b.Discount = b.Discount.Add(c.Discount)
 	}
-	b.Total = b.Subtotal - b.Discount
+	b.Total = b.Subtotal.Sub(b.Discount)
 
-	b.Subtotal = math.Round(b.Subtotal*100) / 100
-	b.Discount = math.Round(b.Discount*100) / 100
-	b.Total = math.Round(b.Total*100) / 100
+	// Taxes
+	b.updateTaxes()
 }
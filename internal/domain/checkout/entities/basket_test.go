@@ -3,12 +3,13 @@ package entities
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestBasket_SaveItem(t *testing.T) {
 	// Given
 	b := NewBasket()
-	bi := NewBasketItem(Product{ID: "PEN", Price: 50}, nil)
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(5000, DefaultCurrency)}, nil)
 	bi.AddQuantity(1)
 
 	// When
@@ -16,15 +17,15 @@ func TestBasket_SaveItem(t *testing.T) {
 
 	// Then
 	assert.Equal(t, 1, len(b.Items))
-	assert.Equal(t, 50.0, b.Subtotal)
-	assert.Equal(t, 0.0, b.Discount)
-	assert.Equal(t, 50.0, b.Total)
+	assert.Equal(t, NewMoney(5000, DefaultCurrency), b.Subtotal)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(5000, DefaultCurrency), b.Total)
 }
 
 func TestBasket_SaveItem_ZeroQuantity(t *testing.T) {
 	// Given
 	b := NewBasket()
-	bi := NewBasketItem(Product{ID: "PEN", Price: 50}, nil)
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(5000, DefaultCurrency)}, nil)
 	bi.AddQuantity(10)
 	b.SaveItem(bi)
 	bi.RemoveQuantity(10)
@@ -34,15 +35,27 @@ func TestBasket_SaveItem_ZeroQuantity(t *testing.T) {
 
 	// Then
 	assert.Equal(t, 0, len(b.Items))
-	assert.Equal(t, 0.0, b.Subtotal)
-	assert.Equal(t, 0.0, b.Discount)
-	assert.Equal(t, 0.0, b.Total)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Subtotal)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Total)
+}
+
+func TestBasket_IdleSince(t *testing.T) {
+	createdAt := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	b := Basket{CreatedAt: createdAt}
+
+	// Saved before the last change was tracked
+	assert.Equal(t, createdAt, b.IdleSince())
+
+	// Modified
+	b.LastModifiedAt = createdAt.Add(time.Hour)
+	assert.Equal(t, createdAt.Add(time.Hour), b.IdleSince())
 }
 
 func TestBasket_GetItem(t *testing.T) {
 	// Given
 	b := NewBasket()
-	bi := NewBasketItem(Product{ID: "PEN", Price: 50}, nil)
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(5000, DefaultCurrency)}, nil)
 	bi.AddQuantity(1)
 	b.SaveItem(bi)
 
@@ -69,16 +82,225 @@ func TestBasket_MultipleItems_Totals(t *testing.T) {
 	b := NewBasket()
 
 	// When
-	bi := NewBasketItem(Product{ID: "PEN", Price: 5}, nil)
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
 	bi.AddQuantity(2)
 	b.SaveItem(bi)
-	bi = NewBasketItem(Product{ID: "TSHIRT", Price: 15.5}, nil)
+	bi = NewBasketItem(Product{ID: "TSHIRT", Price: NewMoney(1550, DefaultCurrency)}, nil)
 	bi.AddQuantity(10)
 	b.SaveItem(bi)
 
 	// Then
 	assert.Equal(t, 2, len(b.Items))
-	assert.Equal(t, 165.0, b.Subtotal)
-	assert.Equal(t, 0.0, b.Discount)
-	assert.Equal(t, 165.0, b.Total)
+	assert.Equal(t, NewMoney(16500, DefaultCurrency), b.Subtotal)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(16500, DefaultCurrency), b.Total)
+}
+
+func buildBundlePromotion() Promotion {
+	return Promotion{
+		ID:   "PENMUG",
+		Type: PromotionTypeCrossProductBundle,
+		CrossProductBundle: &CrossProductBundleParams{
+			Items:    []BundleItem{{ProductID: "PEN", Quantity: 1}, {ProductID: "MUG", Quantity: 1}},
+			Discount: NewMoney(200, DefaultCurrency),
+		},
+	}
+}
+
+func TestBasket_SaveItem_BasketPromotion(t *testing.T) {
+	// Given
+	b := NewBasket()
+	b.SetPromotions([]Promotion{{ID: "2X1", RequiredItems: 2, FreeItems: 1}, buildBundlePromotion()})
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
+	pen.AddQuantity(3)
+	b.SaveItem(pen)
+	assert.Nil(t, b.Discounts)
+
+	// When
+	mug := NewBasketItem(Product{ID: "MUG", Price: NewMoney(750, DefaultCurrency)}, nil)
+	mug.AddQuantity(2)
+	b.SaveItem(mug)
+
+	// Then
+	assert.Equal(t, 1, len(b.Promotions))
+	assert.Equal(t, []BasketDiscount{{
+		PromotionID: "PENMUG",
+		ProductIDs:  []string{"PEN", "MUG"},
+		Quantity:    2,
+		Units:       4,
+		Amount:      NewMoney(400, DefaultCurrency),
+	}}, b.Discounts)
+	assert.Equal(t, NewMoney(3000, DefaultCurrency), b.Subtotal)
+	assert.Equal(t, NewMoney(400, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(2600, DefaultCurrency), b.Total)
+}
+
+func TestBasket_SaveItem_BasketPromotion_Removed(t *testing.T) {
+	// Given
+	b := NewBasket()
+	b.SetPromotions([]Promotion{buildBundlePromotion()})
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
+	pen.AddQuantity(1)
+	b.SaveItem(pen)
+	mug := NewBasketItem(Product{ID: "MUG", Price: NewMoney(750, DefaultCurrency)}, nil)
+	mug.AddQuantity(1)
+	b.SaveItem(mug)
+	assert.Equal(t, 1, len(b.Discounts))
+
+	// When
+	mug.RemoveQuantity(1)
+	b.SaveItem(mug)
+
+	// Then
+	assert.Nil(t, b.Discounts)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(500, DefaultCurrency), b.Total)
+}
+
+func TestBasket_SaveItem_BasketPromotions_ShareUnits(t *testing.T) {
+	// Given
+	other := buildBundlePromotion()
+	other.ID = "PENTSHIRT"
+	other.CrossProductBundle = &CrossProductBundleParams{
+		Items:    []BundleItem{{ProductID: "PEN", Quantity: 1}, {ProductID: "TSHIRT", Quantity: 1}},
+		Discount: NewMoney(300, DefaultCurrency),
+	}
+	b := NewBasket()
+	b.SetPromotions([]Promotion{other, buildBundlePromotion()})
+
+	// When
+	for _, p := range []Product{
+		{ID: "PEN", Price: NewMoney(500, DefaultCurrency)},
+		{ID: "MUG", Price: NewMoney(750, DefaultCurrency)},
+		{ID: "TSHIRT", Price: NewMoney(2000, DefaultCurrency)},
+	} {
+		bi := NewBasketItem(p, nil)
+		bi.AddQuantity(1)
+		b.SaveItem(bi)
+	}
+
+	// Then: the only PEN is used by the first promotion by ID
+	assert.Equal(t, 1, len(b.Discounts))
+	assert.Equal(t, "PENMUG", b.Discounts[0].PromotionID)
+	assert.Equal(t, NewMoney(200, DefaultCurrency), b.Discount)
+}
+
+func TestBasket_SaveItem_BasketPromotion_CappedToPaid(t *testing.T) {
+	// Given
+	promotion := buildBundlePromotion()
+	promotion.CrossProductBundle.Discount = NewMoney(5000, DefaultCurrency)
+	b := NewBasket()
+	b.SetPromotions([]Promotion{promotion})
+
+	// When
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
+	pen.AddQuantity(1)
+	b.SaveItem(pen)
+	mug := NewBasketItem(Product{ID: "MUG", Price: NewMoney(750, DefaultCurrency)}, nil)
+	mug.AddQuantity(1)
+	b.SaveItem(mug)
+
+	// Then
+	assert.Equal(t, NewMoney(1250, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), b.Total)
+}
+
+func TestBasket_AddCoupon(t *testing.T) {
+	// Given
+	b := NewBasket()
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)},
+		&Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1})
+	pen.AddQuantity(6)
+	b.SaveItem(pen)
+
+	// When
+	err := b.AddCoupon(Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10})
+	errTwice := b.AddCoupon(Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10})
+
+	// Then: 10% of the total after promotions(3000 - 1500)
+	assert.Nil(t, err)
+	assert.EqualError(t, errTwice, "coupon 10OFF is already applied to basket ")
+	assert.Equal(t, 1, len(b.Coupons))
+	assert.Equal(t, NewMoney(150, DefaultCurrency), b.Coupons[0].Discount)
+	assert.Equal(t, NewMoney(1650, DefaultCurrency), b.Discount)
+	assert.Equal(t, NewMoney(1350, DefaultCurrency), b.Total)
+	assert.Equal(t, NewMoney(1500, DefaultCurrency), b.TotalBeforeCoupons())
+}
+
+func TestBasket_AddCoupon_MinBasketTotalNotReached(t *testing.T) {
+	// Given
+	b := NewBasket()
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
+	pen.AddQuantity(4)
+	b.SaveItem(pen)
+	b.AddCoupon(Coupon{
+		Code:           "5OFF",
+		DiscountType:   CouponDiscountFixedAmount,
+		Amount:         NewMoney(500, DefaultCurrency),
+		MinBasketTotal: NewMoney(2000, DefaultCurrency),
+	})
+	assert.Equal(t, NewMoney(500, DefaultCurrency), b.Coupons[0].Discount)
+
+	// When
+	pen.RemoveQuantity(1)
+	b.SaveItem(pen)
+
+	// Then: the coupon stays without discount
+	assert.Equal(t, 1, len(b.Coupons))
+	assert.Equal(t, Zero(DefaultCurrency), b.Coupons[0].Discount)
+	assert.Equal(t, NewMoney(1500, DefaultCurrency), b.Total)
+}
+
+func TestBasket_RemoveCoupon(t *testing.T) {
+	// Given
+	b := NewBasket()
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, nil)
+	pen.AddQuantity(4)
+	b.SaveItem(pen)
+	b.AddCoupon(Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10})
+
+	// When
+	err := b.RemoveCoupon("10OFF")
+	errNotFound := b.RemoveCoupon("10OFF")
+
+	// Then
+	assert.Nil(t, err)
+	assert.EqualError(t, errNotFound, "coupon 10OFF not found in basket ")
+	assert.Nil(t, b.Coupons)
+	assert.Equal(t, NewMoney(2000, DefaultCurrency), b.Total)
+}
+
+func TestBasket_Reprice_PromotionWindow(t *testing.T) {
+	// Given
+	startsAt := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(24 * time.Hour)
+	promotion := &Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1, StartsAt: &startsAt, EndsAt: &endsAt}
+	bundle := buildBundlePromotion()
+	bundle.StartsAt = &startsAt
+	bundle.EndsAt = &endsAt
+	b := NewBasket()
+	b.Reprice(startsAt.Add(-time.Hour))
+	b.SetPromotions([]Promotion{bundle})
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, promotion)
+	pen.AddQuantity(2)
+	b.SaveItem(pen)
+	mug := NewBasketItem(Product{ID: "MUG", Price: NewMoney(750, DefaultCurrency)}, nil)
+	mug.AddQuantity(1)
+	b.SaveItem(mug)
+	assert.Equal(t, Zero(DefaultCurrency), b.Discount)
+
+	// When: promotions started
+	b.Reprice(startsAt)
+
+	// Then
+	assert.Equal(t, NewMoney(500, DefaultCurrency), b.Items["PEN"].Discount)
+	assert.Equal(t, NewMoney(700, DefaultCurrency), b.Discount)
+
+	// When: promotions ended
+	b.Reprice(endsAt)
+
+	// Then
+	assert.Equal(t, Zero(DefaultCurrency), b.Items["PEN"].Discount)
+	assert.Nil(t, b.Discounts)
+	assert.Equal(t, NewMoney(1750, DefaultCurrency), b.Total)
 }
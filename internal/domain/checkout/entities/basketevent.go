@@ -0,0 +1,246 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"time"
+)
+
+/*
+	Every change of a basket is recorded as an event in the history of the basket, which is only
+	appended to. Events carry what's needed to apply the change again: an added item has the
+	product & promotions it was priced with, so a basket can be rebuilt replaying its events
+	even if the product changed since then. Total is the basket total after the event, to follow
+	how the basket got to its total. An applied coupon has the coupon it was applied with, so the
+	replayed basket gets the same discounts.
+
+	Baskets are repriced with the current promotions & coupons on every change, so the lines
+	already in the basket may be priced differently than when they were added. Item, coupon &
+	checkout events carry what the basket was priced with after the change: the promotions of
+	every line, the basket promotions and the applied coupons. The replay prices the basket with
+	them, so it gets the same total as the saved basket at every event.
+*/
+
+type BasketEventType string
+
+const (
+	BasketEventCreated       BasketEventType = "basket_created"
+	BasketEventItemAdded     BasketEventType = "item_added"
+	BasketEventItemRemoved   BasketEventType = "item_removed"
+	BasketEventCouponApplied BasketEventType = "coupon_applied"
+	BasketEventCouponRemoved BasketEventType = "coupon_removed"
+	BasketEventDeleted       BasketEventType = "basket_deleted"
+	BasketEventExpired       BasketEventType = "basket_expired"
+	BasketEventCheckedOut    BasketEventType = "basket_checked_out"
+)
+
+type BasketEvent struct {
+	BasketID   string          `json:"basket_id"`
+	Sequence   uint64          `json:"sequence"` // Position in the history, from 1
+	Type       BasketEventType `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Currency   string          `json:"currency,omitempty"`    // Created
+	Country    string          `json:"country,omitempty"`     // Created
+	ProductID  string          `json:"product_id,omitempty"`  // Item added & removed
+	Quantity   uint            `json:"quantity,omitempty"`    // Units added or removed
+	Product    *Product        `json:"product,omitempty"`     // Item added
+	Promotions []Promotion     `json:"promotions,omitempty"`  // Item added, of the product
+	Coupon     *Coupon         `json:"coupon,omitempty"`      // Coupon applied
+	CouponCode string          `json:"coupon_code,omitempty"` // Coupon applied & removed
+	OrderID    string          `json:"order_id,omitempty"`    // Checked out
+	Total      Money           `json:"total"`
+
+	// Pricing of the basket after item & coupon changes and checkout
+	ItemPromotions   map[string][]Promotion `json:"item_promotions,omitempty"` // By product
+	BasketPromotions []Promotion            `json:"basket_promotions,omitempty"`
+	Coupons          []Coupon               `json:"coupons,omitempty"`
+}
+
+func NewBasketCreatedEvent(basket *Basket) BasketEvent {
+	return BasketEvent{
+		Type:     BasketEventCreated,
+		Currency: basket.GetCurrency(),
+		Country:  basket.Country,
+		Total:    basket.Total,
+	}
+}
+
+func NewItemAddedEvent(basket *Basket, item *BasketItem, quantity uint) BasketEvent {
+	product := item.Product
+	return withPricing(basket, BasketEvent{
+		Type:       BasketEventItemAdded,
+		ProductID:  product.ID,
+		Quantity:   quantity,
+		Product:    &product,
+		Promotions: append([]Promotion{}, item.Promotions...),
+		Total:      basket.Total,
+	})
+}
+
+func NewItemRemovedEvent(basket *Basket, productID string, quantity uint) BasketEvent {
+	return withPricing(basket, BasketEvent{
+		Type:      BasketEventItemRemoved,
+		ProductID: productID,
+		Quantity:  quantity,
+		Total:     basket.Total,
+	})
+}
+
+func NewCouponAppliedEvent(basket *Basket, coupon Coupon) BasketEvent {
+	return withPricing(basket, BasketEvent{
+		Type:       BasketEventCouponApplied,
+		Coupon:     &coupon,
+		CouponCode: coupon.Code,
+		Total:      basket.Total,
+	})
+}
+
+func NewCouponRemovedEvent(basket *Basket, code string) BasketEvent {
+	return withPricing(basket, BasketEvent{
+		Type:       BasketEventCouponRemoved,
+		CouponCode: code,
+		Total:      basket.Total,
+	})
+}
+
+func NewBasketDeletedEvent(basket *Basket) BasketEvent {
+	return BasketEvent{
+		Type:  BasketEventDeleted,
+		Total: basket.Total,
+	}
+}
+
+func NewBasketExpiredEvent(basket *Basket) BasketEvent {
+	return BasketEvent{
+		Type:  BasketEventExpired,
+		Total: basket.Total,
+	}
+}
+
+func NewBasketCheckedOutEvent(basket *Basket) BasketEvent {
+	return withPricing(basket, BasketEvent{
+		Type:    BasketEventCheckedOut,
+		OrderID: basket.OrderID,
+		Total:   basket.Total,
+	})
+}
+
+// withPricing adds to the event the promotions & coupons the basket is priced with.
+func withPricing(basket *Basket, event BasketEvent) BasketEvent {
+	event.ItemPromotions = make(map[string][]Promotion, len(basket.Items))
+	for productID, item := range basket.Items {
+		event.ItemPromotions[productID] = append([]Promotion{}, item.Promotions...)
+	}
+	event.BasketPromotions = append([]Promotion{}, basket.Promotions...)
+	for _, c := range basket.Coupons {
+		event.Coupons = append(event.Coupons, c.Coupon)
+	}
+	return event
+}
+
+// ReplayBasket rebuilds a basket applying its events in order, priced at the time of every event
+// with the given taxes. A deleted or expired basket can't be rebuilt.
+func ReplayBasket(events []BasketEvent, taxConfig TaxConfig) (*Basket, error) {
+	if len(events) == 0 || events[0].Type != BasketEventCreated {
+		err := errors.New("the basket history doesn't start with its creation")
+		return nil, lanaerr.New(err, http.StatusConflict)
+	}
+
+	basket := NewBasket()
+	basket.TaxConfig = taxConfig
+	for _, event := range events {
+		if err := basket.apply(event); err != nil {
+			return nil, err
+		}
+	}
+
+	return basket, nil
+}
+
+// apply applies the event like the change it records.
+func (b *Basket) apply(event BasketEvent) error {
+	b.PricedAt = event.OccurredAt
+
+	switch event.Type {
+	case BasketEventCreated:
+		b.ID = event.BasketID
+		b.CreatedAt = event.OccurredAt
+		b.Currency = event.Currency
+		b.Country = event.Country
+		b.Reprice(event.OccurredAt)
+	case BasketEventItemAdded:
+		if event.Product == nil {
+			err := fmt.Errorf("event %d adds an unknown product", event.Sequence)
+			return lanaerr.New(err, http.StatusConflict)
+		}
+		quantity := uint(0)
+		if current := b.GetItem(event.ProductID); current != nil {
+			quantity = current.Quantity
+		}
+		promotions := make([]*Promotion, 0, len(event.Promotions))
+		for i := range event.Promotions {
+			promotions = append(promotions, &event.Promotions[i])
+		}
+		item := NewBasketItem(*event.Product, promotions...)
+		item.AddQuantity(quantity + event.Quantity)
+		b.SaveItem(item)
+		b.applyPricing(event)
+	case BasketEventItemRemoved:
+		item := b.GetItem(event.ProductID)
+		if item == nil {
+			err := fmt.Errorf("event %d removes item %s not found in basket %s", event.Sequence, event.ProductID, b.ID)
+			return lanaerr.New(err, http.StatusConflict)
+		}
+		if err := item.RemoveQuantity(event.Quantity); err != nil {
+			return err
+		}
+		b.SaveItem(item)
+		b.applyPricing(event)
+	case BasketEventCouponApplied:
+		if event.Coupon == nil {
+			err := fmt.Errorf("event %d applies an unknown coupon", event.Sequence)
+			return lanaerr.New(err, http.StatusConflict)
+		}
+		if err := b.AddCoupon(*event.Coupon); err != nil {
+			return err
+		}
+		b.applyPricing(event)
+	case BasketEventCouponRemoved:
+		if err := b.RemoveCoupon(event.CouponCode); err != nil {
+			return err
+		}
+		b.applyPricing(event)
+	case BasketEventDeleted:
+		return lanaerr.New(fmt.Errorf("basket %s was deleted", b.ID), http.StatusGone)
+	case BasketEventExpired:
+		return lanaerr.New(fmt.Errorf("basket %s expired", b.ID), http.StatusGone)
+	case BasketEventCheckedOut:
+		checkedOutAt := event.OccurredAt
+		b.CheckedOutAt = &checkedOutAt
+		b.OrderID = event.OrderID
+		b.applyPricing(event)
+	default:
+		return lanaerr.New(fmt.Errorf("unknown basket event %s", event.Type), http.StatusConflict)
+	}
+
+	b.LastModifiedAt = event.OccurredAt
+	return nil
+}
+
+// applyPricing prices the basket with the promotions & coupons recorded by the event, like the
+// basket was repriced when the change was made.
+func (b *Basket) applyPricing(event BasketEvent) {
+	for productID, item := range b.Items {
+		item.Promotions = append([]Promotion{}, event.ItemPromotions[productID]...)
+		b.Items[productID] = item
+	}
+	b.SetPromotions(event.BasketPromotions)
+	coupons := make(map[string]Coupon, len(event.Coupons))
+	for _, c := range event.Coupons {
+		coupons[c.Code] = c
+	}
+	b.UpdateCoupons(coupons)
+	b.Reprice(event.OccurredAt)
+}
@@ -0,0 +1,173 @@
+package entities
+
+import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// buildBasketHistory changes a basket like the domain does, recording its events: creation, 3
+// pens with a 2x1 and one of them removed.
+func buildBasketHistory() (*Basket, []BasketEvent) {
+	at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	basket := NewBasket()
+	basket.ID = "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	events := []BasketEvent{NewBasketCreatedEvent(basket)}
+
+	promotion := &Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	item := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, promotion)
+	item.AddQuantity(3)
+	basket.SaveItem(item)
+	events = append(events, NewItemAddedEvent(basket, item, 3))
+
+	item.RemoveQuantity(1)
+	basket.SaveItem(item)
+	events = append(events, NewItemRemovedEvent(basket, "PEN", 1))
+
+	for i := range events {
+		events[i].BasketID = basket.ID
+		events[i].Sequence = uint64(i + 1)
+		events[i].OccurredAt = at
+	}
+	return basket, events
+}
+
+func TestReplayBasket(t *testing.T) {
+	// Given
+	basket, events := buildBasketHistory()
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, basket.ID, replayed.ID)
+	assert.Equal(t, uint(2), replayed.Items["PEN"].Quantity)
+	assert.Equal(t, basket.Total, replayed.Total)
+	assert.Equal(t, events[len(events)-1].Total, replayed.Total)
+}
+
+func TestReplayBasket_CheckedOut(t *testing.T) {
+	// Given
+	basket, events := buildBasketHistory()
+	basket.OrderID = "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	events = append(events, NewBasketCheckedOutEvent(basket))
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then
+	assert.Nil(t, err)
+	assert.True(t, replayed.IsCheckedOut())
+	assert.Equal(t, basket.OrderID, replayed.OrderID)
+}
+
+func TestReplayBasket_Deleted(t *testing.T) {
+	// Given
+	basket, events := buildBasketHistory()
+	events = append(events, NewBasketDeletedEvent(basket))
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 was deleted")
+	assert.Equal(t, http.StatusGone, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, replayed)
+}
+
+func TestReplayBasket_Coupons(t *testing.T) {
+	// Given: two coupons applied and one of them removed
+	basket, events := buildBasketHistory()
+	welcome := Coupon{Code: "WELCOME10", DiscountType: CouponDiscountPercentage, Percent: 10}
+	fixed := Coupon{Code: "1OFF", DiscountType: CouponDiscountFixedAmount, Amount: NewMoney(100, DefaultCurrency)}
+	basket.AddCoupon(welcome)
+	events = append(events, NewCouponAppliedEvent(basket, welcome))
+	basket.AddCoupon(fixed)
+	events = append(events, NewCouponAppliedEvent(basket, fixed))
+	withCoupons := basket.Total
+	basket.RemoveCoupon(welcome.Code)
+	events = append(events, NewCouponRemovedEvent(basket, welcome.Code))
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+	beforeRemoval, errBeforeRemoval := ReplayBasket(events[:len(events)-1], TaxConfig{})
+
+	// Then: the coupon discounts are replayed
+	assert.Nil(t, err)
+	assert.Nil(t, errBeforeRemoval)
+	assert.Equal(t, NewMoney(400, DefaultCurrency), basket.Total)
+	assert.Equal(t, basket.Total, replayed.Total)
+	assert.Equal(t, basket.Coupons, replayed.Coupons)
+	assert.Equal(t, withCoupons, beforeRemoval.Total)
+}
+
+func TestReplayBasket_Repriced(t *testing.T) {
+	// Given: the 2x1 of the pens changed to a 3x2 and the WELCOME10 coupon to 20% before a pencil
+	// is added, so the pens already in the basket are repriced
+	basket, events := buildBasketHistory()
+	welcome := Coupon{Code: "WELCOME10", DiscountType: CouponDiscountPercentage, Percent: 10}
+	basket.AddCoupon(welcome)
+	events = append(events, NewCouponAppliedEvent(basket, welcome))
+	pen := basket.Items["PEN"]
+	pen.UpdatePromotions(map[string]Promotion{"2X1": {ID: "2X1", RequiredItems: 3, FreeItems: 1}})
+	basket.Items["PEN"] = pen
+	welcome.Percent = 20
+	basket.UpdateCoupons(map[string]Coupon{welcome.Code: welcome})
+	pencil := NewBasketItem(Product{ID: "PENCIL", Price: NewMoney(100, DefaultCurrency)})
+	pencil.AddQuantity(1)
+	basket.SaveItem(pencil)
+	events = append(events, NewItemAddedEvent(basket, pencil, 1))
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then: the replayed basket is priced like the saved one
+	assert.Nil(t, err)
+	assert.Equal(t, NewMoney(880, DefaultCurrency), basket.Total)
+	assert.Equal(t, basket.Total, replayed.Total)
+	assert.Equal(t, basket.Coupons, replayed.Coupons)
+}
+
+func TestReplayBasket_Expired(t *testing.T) {
+	// Given
+	basket, events := buildBasketHistory()
+	events = append(events, NewBasketExpiredEvent(basket))
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then
+	assert.EqualError(t, err, "basket 1680cd34-931e-4b0c-b7e3-ab314d688398 expired")
+	assert.Equal(t, http.StatusGone, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, replayed)
+}
+
+func TestReplayBasket_WithoutCreation(t *testing.T) {
+	// Given
+	_, events := buildBasketHistory()
+
+	// When
+	replayed, err := ReplayBasket(events[1:], TaxConfig{})
+
+	// Then
+	assert.EqualError(t, err, "the basket history doesn't start with its creation")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, replayed)
+}
+
+func TestReplayBasket_RemovedUnknownItem(t *testing.T) {
+	// Given
+	_, events := buildBasketHistory()
+	events = append(events[:1], events[2])
+
+	// When
+	replayed, err := ReplayBasket(events, TaxConfig{})
+
+	// Then
+	assert.EqualError(t, err, "event 3 removes item PEN not found in basket 1680cd34-931e-4b0c-b7e3-ab314d688398")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, replayed)
+}
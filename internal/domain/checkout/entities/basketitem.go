@@ -3,26 +3,34 @@ package entities
 import (
 	"fmt"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
-	"math"
 	"net/http"
+	"time"
 )
 
 type BasketItem struct {
-	Product   Product    `json:"product"`
-	Promotion *Promotion `json:"-"`
-	Quantity  uint       `json:"quantity"`
-	Total     float64    `json:"total"`
-	Discount  float64    `json:"discount"`
-}
-
-func NewBasketItem(product Product, promotion *Promotion) *BasketItem {
-	return &BasketItem{
-		Product:   product,
-		Promotion: promotion,
-		Quantity:  0,
-		Total:     0,
-		Discount:  0,
+	Product           Product            `json:"product"`
+	Promotions        []Promotion        `json:"-"`
+	Quantity          uint               `json:"quantity"`
+	Total             Money              `json:"total"`
+	Discount          Money              `json:"discount"`
+	AppliedPromotions []AppliedPromotion `json:"applied_promotions,omitempty"`
+	NextThreshold     *PromotionHint     `json:"next_threshold,omitempty"`
+	Taxes             *LineTax           `json:"taxes,omitempty"` // Calculated by the basket
+}
+
+func NewBasketItem(product Product, promotions ...*Promotion) *BasketItem {
+	item := &BasketItem{
+		Product:  product,
+		Quantity: 0,
+		Total:    Zero(product.Price.Currency),
+		Discount: Zero(product.Price.Currency),
 	}
+	for _, promotion := range promotions {
+		if promotion != nil {
+			item.Promotions = append(item.Promotions, *promotion)
+		}
+	}
+	return item
 }
 
 func (b *BasketItem) AddQuantity(quantity uint) {
@@ -40,15 +48,42 @@ func (b *BasketItem) RemoveQuantity(quantity uint) error {
 	return nil
 }
 
+// Reprice calculates the totals again, applying only the promotions active at the given time.
+// Items are repriced by the basket when they are saved.
+func (b *BasketItem) Reprice(now time.Time) {
+	active := make([]Promotion, 0, len(b.Promotions))
+	for _, promotion := range b.Promotions {
+		if promotion.IsActive(now) {
+			active = append(active, promotion)
+		}
+	}
+	b.calculateTotals(active)
+}
+
+// UpdatePromotions replaces the promotions of the item by their current version, keeping their
+// order. Promotions not found, or changed to basket promotions, don't apply anymore.
+func (b *BasketItem) UpdatePromotions(current map[string]Promotion) {
+	var promotions []Promotion
+	for _, promotion := range b.Promotions {
+		if updated, ok := current[promotion.ID]; ok && !updated.IsBasketLevel() {
+			promotions = append(promotions, updated)
+		}
+	}
+	b.Promotions = promotions
+	b.updateTotals()
+}
+
 func (b *BasketItem) updateTotals() {
+	b.calculateTotals(b.Promotions)
+}
+
+func (b *BasketItem) calculateTotals(promotions []Promotion) {
 	// Calculate total of new quantity
-	b.Total = float64(b.Quantity) * b.Product.Price
+	b.Total = b.Product.Price.Multiply(int64(b.Quantity))
 
-	// Apply promotions if needed
-	if b.Promotion != nil {
-		b.Discount = b.Promotion.Apply(b)
-	}
+	// Apply promotions allowed by the stacking rules
+	b.Discount, b.AppliedPromotions = resolvePromotions(promotions, b)
 
-	b.Total = math.Round(b.Total*100) / 100
-	b.Discount = math.Round(b.Discount*100) / 100
+	// Closest discount not reached yet
+	b.NextThreshold = nextThreshold(promotions, b)
 }
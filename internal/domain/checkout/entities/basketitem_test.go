@@ -10,7 +10,7 @@ func TestNewBasketItem_NewBasketItem(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 50,
+		Price: NewMoney(5000, DefaultCurrency),
 	}
 
 	// When
@@ -25,7 +25,7 @@ func TestBasketItem_AddQuantity(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 50,
+		Price: NewMoney(5000, DefaultCurrency),
 	}
 
 	// When
@@ -35,8 +35,8 @@ func TestBasketItem_AddQuantity(t *testing.T) {
 	// Then
 	assert.NotNil(t, bi)
 	assert.Equal(t, uint(10), bi.Quantity)
-	assert.Equal(t, 500.0, bi.Total)
-	assert.Equal(t, 0.0, bi.Discount)
+	assert.Equal(t, NewMoney(50000, DefaultCurrency), bi.Total)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), bi.Discount)
 }
 
 func TestBasketItem_RemoveQuantity_Error(t *testing.T) {
@@ -44,7 +44,7 @@ func TestBasketItem_RemoveQuantity_Error(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 50,
+		Price: NewMoney(5000, DefaultCurrency),
 	}
 
 	// When
@@ -62,7 +62,7 @@ func TestBasketItem_RemoveQuantity_Success(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 50,
+		Price: NewMoney(5000, DefaultCurrency),
 	}
 
 	// When
@@ -74,6 +74,6 @@ func TestBasketItem_RemoveQuantity_Success(t *testing.T) {
 	assert.NotNil(t, bi)
 	assert.Nil(t, err)
 	assert.Equal(t, uint(5), bi.Quantity)
-	assert.Equal(t, 250.0, bi.Total)
-	assert.Equal(t, 0.0, bi.Discount)
+	assert.Equal(t, NewMoney(25000, DefaultCurrency), bi.Total)
+	assert.Equal(t, NewMoney(0, DefaultCurrency), bi.Discount)
 }
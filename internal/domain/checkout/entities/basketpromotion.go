@@ -0,0 +1,181 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BasketPromotionRule calculates the discount of a basket level promotion type. Basket level
+// promotions look at all the basket items together and produce discount lines tied to the
+// items involved.
+type BasketPromotionRule interface {
+	// Validate checks the params of the promotion. The error message is prefixed with the
+	// promotion id, like "promotion PENMUG <message>"
+	Validate(promotion Promotion) error
+	// Apply returns the discount lines of the promotion for the basket. available has the units
+	// of every product not used by other basket promotions yet, the rule must subtract the
+	// units it uses so a unit is never part of two basket promotions.
+	Apply(promotion Promotion, basket *Basket, available map[string]uint) []BasketDiscount
+	// Describe returns a human readable description of the promotion, like "2.00 EUR off
+	// buying 1 PEN and 1 MUG"
+	Describe(promotion Promotion) string
+}
+
+// BasketDiscount is a discount line produced by a basket level promotion.
+type BasketDiscount struct {
+	PromotionID string   `json:"promotion_id"`
+	ProductIDs  []string `json:"product_ids"`
+	Quantity    uint     `json:"quantity"` // Times the promotion was applied
+	Units       uint     `json:"units"`    // Units of the products used
+	Amount      Money    `json:"amount"`
+}
+
+// CrossProductBundleParams: buying all the items of the bundle together gives a fixed discount,
+// like buy a PEN and a MUG and get 2€ off. The discount applies once per complete bundle.
+type CrossProductBundleParams struct {
+	Items    []BundleItem `json:"items"`
+	Discount Money        `json:"discount"`
+}
+
+type BundleItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  uint   `json:"quantity"`
+}
+
+var basketPromotionRules = struct {
+	sync.RWMutex
+	rules map[PromotionType]BasketPromotionRule
+}{
+	rules: map[PromotionType]BasketPromotionRule{
+		PromotionTypeCrossProductBundle: crossProductBundleRule{},
+	},
+}
+
+// RegisterBasketPromotionRule adds or replaces the rule of a basket level promotion type.
+func RegisterBasketPromotionRule(promotionType PromotionType, rule BasketPromotionRule) {
+	basketPromotionRules.Lock()
+	defer basketPromotionRules.Unlock()
+	basketPromotionRules.rules[promotionType] = rule
+}
+
+func getBasketPromotionRule(promotionType PromotionType) (BasketPromotionRule, bool) {
+	basketPromotionRules.RLock()
+	defer basketPromotionRules.RUnlock()
+	rule, ok := basketPromotionRules.rules[promotionType]
+	return rule, ok
+}
+
+// applyBasketPromotions returns the discount lines of the basket level promotions. Promotions
+// are applied sorted by ID so the result doesn't depend on the order they were loaded.
+func applyBasketPromotions(basket *Basket, promotions []Promotion) []BasketDiscount {
+	available := make(map[string]uint, len(basket.Items))
+	for id, item := range basket.Items {
+		available[id] = item.Quantity
+	}
+
+	sorted := append([]Promotion{}, promotions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	discounts := make([]BasketDiscount, 0)
+	for _, promotion := range sorted {
+		rule, ok := getBasketPromotionRule(promotion.Type)
+		if !ok {
+			continue
+		}
+		discounts = append(discounts, rule.Apply(promotion, basket, available)...)
+	}
+	return discounts
+}
+
+// ===========================================================================================
+// Cross product bundle
+// ===========================================================================================
+type crossProductBundleRule struct{}
+
+func (crossProductBundleRule) Validate(d Promotion) error {
+	p := d.CrossProductBundle
+	if p == nil {
+		return errors.New("cross_product_bundle params are required")
+	}
+	if len(p.Items) < 2 {
+		return errors.New("bundle must have at least two products")
+	}
+	seen := make(map[string]bool, len(p.Items))
+	for _, item := range p.Items {
+		if item.ProductID == "" || item.Quantity == 0 {
+			return errors.New("bundle items require a product id and a quantity")
+		}
+		if seen[item.ProductID] {
+			return errors.New("bundle products can't be repeated")
+		}
+		seen[item.ProductID] = true
+	}
+	if p.Discount.Currency == "" {
+		return errors.New("discount currency is required")
+	}
+	if p.Discount.IsZero() || p.Discount.IsNegative() {
+		return errors.New("discount must be greater than zero")
+	}
+	return nil
+}
+
+func (crossProductBundleRule) Apply(d Promotion, basket *Basket, available map[string]uint) []BasketDiscount {
+	p := d.CrossProductBundle
+	if p == nil || len(p.Items) == 0 {
+		return nil
+	}
+
+	// Complete bundles in the basket
+	sets := uint(0)
+	for i, bundleItem := range p.Items {
+		item, ok := basket.Items[bundleItem.ProductID]
+		if !ok || bundleItem.Quantity == 0 || item.Product.Price.Currency != p.Discount.Currency {
+			return nil
+		}
+		n := available[bundleItem.ProductID] / bundleItem.Quantity
+		if i == 0 || n < sets {
+			sets = n
+		}
+	}
+	if sets == 0 {
+		return nil
+	}
+
+	// Use the units. The discount can't be greater than what is paid for them
+	productIDs := make([]string, 0, len(p.Items))
+	paid := Zero(p.Discount.Currency)
+	used := uint(0)
+	for _, bundleItem := range p.Items {
+		item := basket.Items[bundleItem.ProductID]
+		units := bundleItem.Quantity * sets
+		available[bundleItem.ProductID] -= units
+		used += units
+		productIDs = append(productIDs, bundleItem.ProductID)
+		paid = paid.Add(item.Product.Price.Multiply(int64(units)).Min(item.Total.Sub(item.Discount)))
+	}
+
+	return []BasketDiscount{{
+		PromotionID: d.ID,
+		ProductIDs:  productIDs,
+		Quantity:    sets,
+		Units:       used,
+		Amount:      p.Discount.Multiply(int64(sets)).Min(paid),
+	}}
+}
+
+func (crossProductBundleRule) Describe(d Promotion) string {
+	p := d.CrossProductBundle
+	if p == nil {
+		return ""
+	}
+	items := make([]string, 0, len(p.Items))
+	for _, item := range p.Items {
+		items = append(items, fmt.Sprintf("%d %s", item.Quantity, item.ProductID))
+	}
+	return fmt.Sprintf("%s off buying %s", p.Discount, strings.Join(items, " and "))
+}
@@ -0,0 +1,113 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"time"
+)
+
+/*
+	A coupon is a code the customer redeems on a basket. Unlike promotions, coupons are not
+	applied automatically: the customer adds them to the basket. The discount of the coupons is
+	calculated on the basket total after product & basket promotions.
+
+	The usage limit is the number of orders that can use the coupon, so the usage is counted when
+	the basket is checked out.
+*/
+
+type CouponDiscountType string
+
+const (
+	CouponDiscountPercentage  CouponDiscountType = "percentage"
+	CouponDiscountFixedAmount CouponDiscountType = "fixed_amount"
+)
+
+type Coupon struct {
+	Code           string             `json:"code"`
+	DiscountType   CouponDiscountType `json:"discount_type"`
+	Percent        float64            `json:"percent,omitempty"`
+	Amount         Money              `json:"amount"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty"`
+	UsageLimit     uint               `json:"usage_limit"` // Zero means unlimited
+	Used           uint               `json:"used"`
+	MinBasketTotal Money              `json:"min_basket_total"`
+}
+
+// AppliedCoupon is a coupon redeemed on a basket with the discount it gives.
+type AppliedCoupon struct {
+	Code     string `json:"code"`
+	Discount Money  `json:"discount"`
+	Coupon   Coupon `json:"-"`
+}
+
+type CouponDetail struct {
+	Code string `json:"code"`
+}
+
+func (c Coupon) Validate() error {
+	if c.Code == "" {
+		return lanaerr.New(errors.New("coupon code is required"), http.StatusBadRequest)
+	}
+	switch c.DiscountType {
+	case CouponDiscountPercentage:
+		if c.Percent <= 0 || c.Percent > 100 {
+			err := fmt.Errorf("coupon %s percent must be greater than 0 and up to 100", c.Code)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+	case CouponDiscountFixedAmount:
+		if c.Amount.Currency == "" || c.Amount.IsZero() || c.Amount.IsNegative() {
+			err := fmt.Errorf("coupon %s amount must be greater than zero", c.Code)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+	default:
+		err := fmt.Errorf("coupon %s discount type %s is not supported", c.Code, c.DiscountType)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
+	if c.MinBasketTotal.IsNegative() {
+		err := fmt.Errorf("coupon %s min basket total can't be negative", c.Code)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// CheckRedeemable returns an error if the coupon can't be used anymore.
+func (c Coupon) CheckRedeemable(now time.Time) error {
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return lanaerr.New(fmt.Errorf("coupon %s is expired", c.Code), http.StatusBadRequest)
+	}
+	if c.UsageLimit > 0 && c.Used >= c.UsageLimit {
+		return lanaerr.New(fmt.Errorf("coupon %s usage limit reached", c.Code), http.StatusConflict)
+	}
+	return nil
+}
+
+// CheckMinBasketTotal returns an error if the amount doesn't reach the coupon minimum.
+func (c Coupon) CheckMinBasketTotal(total Money) error {
+	if total.Amount < c.MinBasketTotal.Amount {
+		err := fmt.Errorf("coupon %s requires a basket total of at least %s", c.Code, c.MinBasketTotal)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// Apply returns the discount of the coupon for the given amount, never greater than the amount.
+func (c Coupon) Apply(amount Money) Money {
+	zero := Zero(amount.Currency)
+	if amount.IsNegative() || amount.IsZero() {
+		return zero
+	}
+
+	switch c.DiscountType {
+	case CouponDiscountPercentage:
+		return amount.Percent(c.Percent, RoundHalfUp)
+	case CouponDiscountFixedAmount:
+		if c.Amount.Currency != amount.Currency {
+			return zero
+		}
+		return c.Amount.Min(amount)
+	default:
+		return zero
+	}
+}
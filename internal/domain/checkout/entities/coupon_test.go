@@ -0,0 +1,88 @@
+package entities
+
+import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCoupon_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon Coupon
+		err    string
+	}{
+		{"percentage", Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10}, ""},
+		{"fixed amount", Coupon{Code: "5OFF", DiscountType: CouponDiscountFixedAmount,
+			Amount: NewMoney(500, DefaultCurrency)}, ""},
+		{"without code", Coupon{DiscountType: CouponDiscountPercentage, Percent: 10}, "coupon code is required"},
+		{"unknown type", Coupon{Code: "X", DiscountType: "free_shipping"},
+			"coupon X discount type free_shipping is not supported"},
+		{"percentage over 100", Coupon{Code: "X", DiscountType: CouponDiscountPercentage, Percent: 110},
+			"coupon X percent must be greater than 0 and up to 100"},
+		{"fixed amount zero", Coupon{Code: "X", DiscountType: CouponDiscountFixedAmount, Amount: Zero(DefaultCurrency)},
+			"coupon X amount must be greater than zero"},
+		{"negative minimum", Coupon{Code: "X", DiscountType: CouponDiscountPercentage, Percent: 10,
+			MinBasketTotal: NewMoney(-1, DefaultCurrency)}, "coupon X min basket total can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.coupon.Validate()
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCoupon_CheckRedeemable(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+
+	// Valid
+	coupon := Coupon{Code: "10OFF", ExpiresAt: &expiresAt, UsageLimit: 2, Used: 1}
+	assert.Nil(t, coupon.CheckRedeemable(now))
+
+	// Expired
+	err := coupon.CheckRedeemable(expiresAt)
+	assert.EqualError(t, err, "coupon 10OFF is expired")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+
+	// Usage limit
+	coupon.Used = 2
+	err = coupon.CheckRedeemable(now)
+	assert.EqualError(t, err, "coupon 10OFF usage limit reached")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+
+	// Unlimited
+	coupon.UsageLimit = 0
+	assert.Nil(t, coupon.CheckRedeemable(now))
+}
+
+func TestCoupon_CheckMinBasketTotal(t *testing.T) {
+	// Given
+	coupon := Coupon{Code: "5OFF", MinBasketTotal: NewMoney(2000, DefaultCurrency)}
+
+	// When
+	errBelow := coupon.CheckMinBasketTotal(NewMoney(1999, DefaultCurrency))
+	errReached := coupon.CheckMinBasketTotal(NewMoney(2000, DefaultCurrency))
+
+	// Then
+	assert.EqualError(t, errBelow, "coupon 5OFF requires a basket total of at least 20.00 EUR")
+	assert.Nil(t, errReached)
+}
+
+func TestCoupon_Apply(t *testing.T) {
+	percentage := Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10}
+	fixed := Coupon{Code: "5OFF", DiscountType: CouponDiscountFixedAmount, Amount: NewMoney(500, DefaultCurrency)}
+
+	assert.Equal(t, NewMoney(155, DefaultCurrency), percentage.Apply(NewMoney(1550, DefaultCurrency)))
+	assert.Equal(t, NewMoney(500, DefaultCurrency), fixed.Apply(NewMoney(1550, DefaultCurrency)))
+	assert.Equal(t, NewMoney(300, DefaultCurrency), fixed.Apply(NewMoney(300, DefaultCurrency)))
+	assert.Equal(t, Zero("USD"), fixed.Apply(NewMoney(1550, "USD")))
+	assert.Equal(t, Zero(DefaultCurrency), percentage.Apply(Zero(DefaultCurrency)))
+}
@@ -0,0 +1,142 @@
+package entities
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+/*
+	Every basket has a currency, fixed when the basket is created. Products are added to the
+	basket with their price in that currency or, if they have none, with their price converted
+	with the exchange rates. Promotions and coupons with amounts in another currency are
+	converted the same way, so every line, promotion and total of the basket is in the basket
+	currency.
+
+	The supported currencies are the base currency of the exchange rates and the ones with a
+	rate. Without rates the default currency is the only one supported.
+*/
+
+type ExchangeRates struct {
+	Base  string             // Default currency if empty
+	Rates map[string]float64 // Units of every currency for one unit of the base currency
+}
+
+func (e ExchangeRates) base() string {
+	if e.Base == "" {
+		return DefaultCurrency
+	}
+	return e.Base
+}
+
+// Validate checks the rates. The default currency must be supported.
+func (e ExchangeRates) Validate() error {
+	for currency, rate := range e.Rates {
+		if len(currency) != 3 {
+			return fmt.Errorf("currency %s is not a valid ISO 4217 code", currency)
+		}
+		if rate <= 0 {
+			return fmt.Errorf("exchange rate of %s must be greater than zero", currency)
+		}
+	}
+	if !e.IsSupported(DefaultCurrency) {
+		return fmt.Errorf("exchange rates require a rate for %s", DefaultCurrency)
+	}
+	return nil
+}
+
+func (e ExchangeRates) IsSupported(currency string) bool {
+	_, ok := e.rate(currency)
+	return ok
+}
+
+func (e ExchangeRates) rate(currency string) (float64, bool) {
+	if currency == e.base() {
+		return 1, true
+	}
+	rate, ok := e.Rates[currency]
+	return rate, ok
+}
+
+// Convert returns the amount in the given currency, rounded half up to its minor unit. It fails
+// if any of the currencies has no rate.
+func (e ExchangeRates) Convert(amount Money, currency string) (Money, bool) {
+	if amount.Currency == currency {
+		return amount, true
+	}
+	from, ok := e.rate(amount.Currency)
+	if !ok {
+		return Money{}, false
+	}
+	to, ok := e.rate(currency)
+	if !ok {
+		return Money{}, false
+	}
+
+	// amount * to / from, with the minor units of the target currency
+	value := new(big.Rat).SetInt64(amount.Amount)
+	value.Mul(value, new(big.Rat).SetFloat64(to))
+	value.Quo(value, new(big.Rat).SetFloat64(from))
+	value.Mul(value, new(big.Rat).SetFloat64(math.Pow10(currencyExponent(currency))))
+	value.Quo(value, new(big.Rat).SetFloat64(math.Pow10(currencyExponent(amount.Currency))))
+
+	return Money{Amount: roundRat(value), Currency: currency}, true
+}
+
+// ConvertPromotion returns a copy of the promotion with its amounts in the given currency.
+// Amounts that can't be converted are kept, the rules don't apply amounts in other currencies.
+func (e ExchangeRates) ConvertPromotion(d Promotion, currency string) Promotion {
+	convert := func(amount Money) Money {
+		if converted, ok := e.Convert(amount, currency); ok {
+			return converted
+		}
+		return amount
+	}
+
+	if d.FixedAmount != nil {
+		p := *d.FixedAmount
+		p.Amount = convert(p.Amount)
+		d.FixedAmount = &p
+	}
+	if d.BundlePrice != nil {
+		p := *d.BundlePrice
+		p.Price = convert(p.Price)
+		d.BundlePrice = &p
+	}
+	if d.Tiered != nil {
+		p := TieredParams{Tiers: make([]PriceTier, len(d.Tiered.Tiers))}
+		for i, tier := range d.Tiered.Tiers {
+			tier.UnitPrice = convert(tier.UnitPrice)
+			p.Tiers[i] = tier
+		}
+		d.Tiered = &p
+	}
+	if d.CrossProductBundle != nil {
+		p := *d.CrossProductBundle
+		p.Discount = convert(p.Discount)
+		d.CrossProductBundle = &p
+	}
+	return d
+}
+
+// ConvertCoupon returns a copy of the coupon with its amounts in the given currency. Amounts
+// that can't be converted are kept.
+func (e ExchangeRates) ConvertCoupon(c Coupon, currency string) Coupon {
+	if converted, ok := e.Convert(c.Amount, currency); ok {
+		c.Amount = converted
+	}
+	if converted, ok := e.Convert(c.MinBasketTotal, currency); ok {
+		c.MinBasketTotal = converted
+	}
+	return c
+}
+
+// roundRat rounds the value to the nearest integer, ties away from zero.
+func roundRat(value *big.Rat) int64 {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	remainder.Abs(remainder).Lsh(remainder, 1)
+	if remainder.Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Num().Sign())))
+	}
+	return quotient.Int64()
+}
@@ -0,0 +1,171 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func buildTestExchangeRates() ExchangeRates {
+	return ExchangeRates{Rates: map[string]float64{"USD": 1.18, "JPY": 124.5}}
+}
+
+func TestExchangeRates_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rates ExchangeRates
+		err   string
+	}{
+		{name: "without rates", rates: ExchangeRates{}},
+		{name: "valid", rates: buildTestExchangeRates()},
+		{
+			name:  "invalid code",
+			rates: ExchangeRates{Rates: map[string]float64{"DOLLAR": 1.18}},
+			err:   "currency DOLLAR is not a valid ISO 4217 code",
+		},
+		{
+			name:  "invalid rate",
+			rates: ExchangeRates{Rates: map[string]float64{"USD": 0}},
+			err:   "exchange rate of USD must be greater than zero",
+		},
+		{
+			name:  "default currency not supported",
+			rates: ExchangeRates{Base: "USD", Rates: map[string]float64{"GBP": 0.77}},
+			err:   "exchange rates require a rate for EUR",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rates.Validate()
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExchangeRates_Convert(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		currency string
+		expected Money
+		ok       bool
+	}{
+		{name: "same currency", amount: NewMoney(500, "GBP"), currency: "GBP", expected: NewMoney(500, "GBP"), ok: true},
+		{name: "from base", amount: NewMoney(500, "EUR"), currency: "USD", expected: NewMoney(590, "USD"), ok: true},
+		{name: "to base", amount: NewMoney(590, "USD"), currency: "EUR", expected: NewMoney(500, "EUR"), ok: true},
+		{name: "rounded", amount: NewMoney(333, "EUR"), currency: "USD", expected: NewMoney(393, "USD"), ok: true},
+		{name: "between rates", amount: NewMoney(118, "USD"), currency: "JPY", expected: NewMoney(125, "JPY"), ok: true},
+		{name: "without decimals", amount: NewMoney(1245, "JPY"), currency: "EUR", expected: NewMoney(1000, "EUR"), ok: true},
+		{name: "without rate", amount: NewMoney(500, "EUR"), currency: "GBP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, ok := buildTestExchangeRates().Convert(tt.amount, tt.currency)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, converted)
+		})
+	}
+}
+
+func TestExchangeRates_ConvertPromotion(t *testing.T) {
+	// Given
+	promotion := Promotion{
+		ID:          "1OFF",
+		Type:        PromotionTypeFixedAmount,
+		FixedAmount: &FixedAmountParams{Amount: NewMoney(100, DefaultCurrency)},
+	}
+
+	// When
+	converted := buildTestExchangeRates().ConvertPromotion(promotion, "USD")
+
+	// Then: the original promotion is not changed
+	assert.Equal(t, NewMoney(118, "USD"), converted.FixedAmount.Amount)
+	assert.Equal(t, NewMoney(100, DefaultCurrency), promotion.FixedAmount.Amount)
+}
+
+func TestExchangeRates_ConvertCoupon(t *testing.T) {
+	// Given
+	coupon := Coupon{
+		Code:           "5OFF",
+		DiscountType:   CouponDiscountFixedAmount,
+		Amount:         NewMoney(500, DefaultCurrency),
+		MinBasketTotal: NewMoney(2000, DefaultCurrency),
+	}
+
+	// When
+	converted := buildTestExchangeRates().ConvertCoupon(coupon, "USD")
+
+	// Then
+	assert.Equal(t, NewMoney(590, "USD"), converted.Amount)
+	assert.Equal(t, NewMoney(2360, "USD"), converted.MinBasketTotal)
+}
+
+func TestProduct_InCurrency(t *testing.T) {
+	product := Product{
+		ID:     "PEN",
+		Price:  NewMoney(500, DefaultCurrency),
+		Prices: CurrencyPrices{"GBP": NewMoney(450, "GBP")},
+	}
+	tests := []struct {
+		name     string
+		currency string
+		expected Money
+		err      string
+	}{
+		{name: "product currency", currency: "EUR", expected: NewMoney(500, "EUR")},
+		{name: "own price", currency: "GBP", expected: NewMoney(450, "GBP")},
+		{name: "converted", currency: "USD", expected: NewMoney(590, "USD")},
+		{name: "without price", currency: "CHF", err: "product PEN has no price in CHF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priced, err := product.InCurrency(tt.currency, buildTestExchangeRates())
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Nil(t, priced)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, priced.Price)
+			assert.Nil(t, priced.Prices)
+		})
+	}
+}
+
+func TestCurrencyPrices_UnmarshalJSON(t *testing.T) {
+	// Given
+	data := `{"id":"PEN","prices":{"USD":5.9,"JPY":620,"GBP":{"amount":450,"currency":"GBP"}}}`
+
+	// When
+	product := Product{}
+	err := json.Unmarshal([]byte(data), &product)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, CurrencyPrices{
+		"USD": NewMoney(590, "USD"),
+		"JPY": NewMoney(620, "JPY"),
+		"GBP": NewMoney(450, "GBP"),
+	}, product.Prices)
+}
+
+func TestBasket_Currency(t *testing.T) {
+	// Given
+	b := NewBasket()
+	b.Currency = "USD"
+	item := NewBasketItem(Product{ID: "PEN", Price: NewMoney(590, "USD")}, nil)
+	item.AddQuantity(2)
+
+	// When
+	b.SaveItem(item)
+
+	// Then
+	assert.Equal(t, NewMoney(1180, "USD"), b.Subtotal)
+	assert.Equal(t, NewMoney(0, "USD"), b.Discount)
+	assert.Equal(t, NewMoney(1180, "USD"), b.Total)
+	assert.Equal(t, "USD", NewOrder(*b).Currency)
+}
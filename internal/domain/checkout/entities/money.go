@@ -0,0 +1,221 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+	Money represents an amount in the minor unit of its currency(cents for EUR), so all the
+	arithmetic is done with integers and there is no drift due to floating point errors. The only
+	operations that can produce fractions of a minor unit are the ones that scale an amount(like
+	percentages) and those always take an explicit rounding mode.
+
+	The JSON representation is an object with the amount in minor units and the ISO 4217 currency
+	code: {"amount":1050,"currency":"EUR"}. The v1 API keeps the original representation(a number
+	in major units, 10.5) for compatibility. See rest package.
+*/
+
+const DefaultCurrency = "EUR"
+
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest value, ties away from zero
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest value, ties to the even value(banker's rounding)
+	RoundHalfEven
+	// RoundDown rounds towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+)
+
+// Currencies with a number of decimals other than 2
+var currencyExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"CLP": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns the sum of both amounts. A zero value without currency takes the other currency.
+// Adding amounts in different currencies is a bug, they must be converted first, so it panics.
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currencyWith(o)}
+}
+
+// Sub returns the difference of both amounts, with the currency rules of Add.
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currencyWith(o)}
+}
+
+func (m Money) Multiply(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Scale returns the amount multiplied by num/den, rounded with the given mode.
+func (m Money) Scale(num, den int64, mode RoundingMode) Money {
+	return Money{Amount: divRound(m.Amount*num, den, mode), Currency: m.Currency}
+}
+
+// Percent returns the given percentage of the amount. The percentage is taken with two
+// decimals of precision(12.55%).
+func (m Money) Percent(percentage float64, mode RoundingMode) Money {
+	basisPoints := int64(math.Round(percentage * 100))
+	return m.Scale(basisPoints, 10000, mode)
+}
+
+func (m Money) Min(o Money) Money {
+	if o.Amount < m.Amount {
+		return o
+	}
+	return m
+}
+
+func (m Money) Equal(o Money) bool {
+	return m.Amount == o.Amount && m.Currency == o.Currency
+}
+
+// Decimal returns the amount in major units without trailing zeros, like 10.5
+func (m Money) Decimal() string {
+	exp := currencyExponent(m.Currency)
+	if exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	unit := int64(math.Pow10(exp))
+	decimals := strings.TrimRight(fmt.Sprintf("%0*d", exp, amount%unit), "0")
+	if decimals == "" {
+		return fmt.Sprintf("%s%d", sign, amount/unit)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, amount/unit, decimals)
+}
+
+func (m Money) String() string {
+	exp := currencyExponent(m.Currency)
+	value := new(big.Rat).SetFrac64(m.Amount, int64(math.Pow10(exp)))
+	return strings.TrimSpace(fmt.Sprintf("%s %s", value.FloatString(exp), m.Currency))
+}
+
+// ParseMoney parses an amount in major units(10.5) into Money. Amounts with more decimals than
+// the currency minor unit are rejected.
+func ParseMoney(value string, currency string) (Money, error) {
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount: %s", value)
+	}
+
+	rat.Mul(rat, new(big.Rat).SetInt64(int64(math.Pow10(currencyExponent(currency)))))
+	if !rat.IsInt() || !rat.Num().IsInt64() {
+		return Money{}, fmt.Errorf("invalid amount for %s: %s", currency, value)
+	}
+
+	return Money{Amount: rat.Num().Int64(), Currency: currency}, nil
+}
+
+// UnmarshalJSON accepts both the object representation and the v1 representation(a number in
+// major units of the default currency).
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		type money Money
+		return json.Unmarshal(data, (*money)(m))
+	case len(data) == 0 || (data[0] != '-' && (data[0] < '0' || data[0] > '9')):
+		return fmt.Errorf("invalid money value: %s", data)
+	}
+
+	parsed, err := ParseMoney(string(data), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// currencyWith returns the currency of the result of an operation with both amounts. Only an
+// empty currency takes the other one.
+func (m Money) currencyWith(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	default:
+		panic(fmt.Sprintf("money currency mismatch: %s and %s", m.Currency, o.Currency))
+	}
+}
+
+func currencyExponent(currency string) int {
+	if exp, ok := currencyExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// divRound divides a by b(b > 0) rounding the result with the given mode.
+func divRound(a, b int64, mode RoundingMode) int64 {
+	quotient, remainder := a/b, a%b
+	if remainder == 0 {
+		return quotient
+	}
+
+	sign := int64(1)
+	if a < 0 {
+		sign = -1
+		remainder = -remainder
+	}
+
+	switch mode {
+	case RoundDown:
+		return quotient
+	case RoundUp:
+		return quotient + sign
+	case RoundHalfEven:
+		if 2*remainder > b || (2*remainder == b && quotient%2 != 0) {
+			return quotient + sign
+		}
+		return quotient
+	default: // RoundHalfUp
+		if 2*remainder >= b {
+			return quotient + sign
+		}
+		return quotient
+	}
+}
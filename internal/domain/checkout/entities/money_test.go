@@ -0,0 +1,133 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMoney_Arithmetic(t *testing.T) {
+	// Given
+	price := NewMoney(1050, "EUR")
+
+	// When
+	total := price.Multiply(3)
+	sum := total.Add(NewMoney(50, "EUR"))
+	sub := sum.Sub(price)
+
+	// Then
+	assert.Equal(t, NewMoney(3150, "EUR"), total)
+	assert.Equal(t, NewMoney(3200, "EUR"), sum)
+	assert.Equal(t, NewMoney(2150, "EUR"), sub)
+}
+
+func TestMoney_Add_ZeroWithoutCurrency(t *testing.T) {
+	// When
+	sum := Money{}.Add(NewMoney(100, "USD"))
+
+	// Then
+	assert.Equal(t, NewMoney(100, "USD"), sum)
+}
+
+func TestMoney_Add_OtherWithoutCurrency(t *testing.T) {
+	// When
+	sum := NewMoney(100, "USD").Add(Money{})
+	diff := NewMoney(100, "USD").Sub(Money{Amount: 50})
+
+	// Then
+	assert.Equal(t, NewMoney(100, "USD"), sum)
+	assert.Equal(t, NewMoney(50, "USD"), diff)
+}
+
+func TestMoney_CurrencyMismatch(t *testing.T) {
+	// Amounts in different currencies must be converted before they're added
+	assert.PanicsWithValue(t, "money currency mismatch: EUR and USD", func() {
+		NewMoney(100, "EUR").Add(NewMoney(100, "USD"))
+	})
+	assert.PanicsWithValue(t, "money currency mismatch: USD and EUR", func() {
+		NewMoney(100, "USD").Sub(Zero("EUR"))
+	})
+}
+
+func TestMoney_Percent_RoundingModes(t *testing.T) {
+	// 12.5% of 0.20 EUR = 2.5 cents
+	m := NewMoney(20, "EUR")
+	assert.Equal(t, int64(3), m.Percent(12.5, RoundHalfUp).Amount)
+	assert.Equal(t, int64(2), m.Percent(12.5, RoundHalfEven).Amount)
+	assert.Equal(t, int64(2), m.Percent(12.5, RoundDown).Amount)
+	assert.Equal(t, int64(3), m.Percent(12.5, RoundUp).Amount)
+
+	// 17.5% of 0.20 EUR = 3.5 cents
+	assert.Equal(t, int64(4), m.Percent(17.5, RoundHalfEven).Amount)
+
+	// Negative amounts round symmetrically
+	n := NewMoney(-20, "EUR")
+	assert.Equal(t, int64(-3), n.Percent(12.5, RoundHalfUp).Amount)
+	assert.Equal(t, int64(-2), n.Percent(12.5, RoundDown).Amount)
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	assert.Equal(t, "10.5", NewMoney(1050, "EUR").Decimal())
+	assert.Equal(t, "10.05", NewMoney(1005, "EUR").Decimal())
+	assert.Equal(t, "5", NewMoney(500, "EUR").Decimal())
+	assert.Equal(t, "0", NewMoney(0, "").Decimal())
+	assert.Equal(t, "-0.5", NewMoney(-50, "EUR").Decimal())
+	assert.Equal(t, "1500", NewMoney(1500, "JPY").Decimal())
+	assert.Equal(t, "1.5", NewMoney(1500, "KWD").Decimal())
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "10.50 EUR", NewMoney(1050, "EUR").String())
+	assert.Equal(t, "-0.05 EUR", NewMoney(-5, "EUR").String())
+}
+
+func TestParseMoney(t *testing.T) {
+	m, err := ParseMoney("10.5", "EUR")
+	assert.Nil(t, err)
+	assert.Equal(t, NewMoney(1050, "EUR"), m)
+
+	m, err = ParseMoney("0.1", "EUR")
+	assert.Nil(t, err)
+	assert.Equal(t, NewMoney(10, "EUR"), m)
+
+	_, err = ParseMoney("10.555", "EUR")
+	assert.EqualError(t, err, "invalid amount for EUR: 10.555")
+
+	_, err = ParseMoney("TEXT", "EUR")
+	assert.EqualError(t, err, "invalid amount: TEXT")
+}
+
+func TestMoney_JSON(t *testing.T) {
+	// Marshal
+	data, err := json.Marshal(NewMoney(1050, "EUR"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"amount":1050,"currency":"EUR"}`, string(data))
+
+	// Unmarshal object
+	m := Money{}
+	err = json.Unmarshal([]byte(`{"amount":1050,"currency":"USD"}`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, NewMoney(1050, "USD"), m)
+
+	// Unmarshal v1 number
+	err = json.Unmarshal([]byte(`10.5`), &m)
+	assert.Nil(t, err)
+	assert.Equal(t, NewMoney(1050, DefaultCurrency), m)
+
+	// Invalid
+	err = json.Unmarshal([]byte(`"10.5"`), &m)
+	assert.NotNil(t, err)
+}
+
+func TestMoney_NoDrift(t *testing.T) {
+	// Given: 0.10 added 1000 times accumulates errors with float64
+	total := Zero("EUR")
+
+	// When
+	for i := 0; i < 1000; i++ {
+		total = total.Add(NewMoney(10, "EUR"))
+	}
+
+	// Then
+	assert.Equal(t, NewMoney(10000, "EUR"), total)
+}
@@ -0,0 +1,83 @@
+package entities
+
+import (
+	"sort"
+	"time"
+)
+
+/*
+	An order is the immutable result of a basket checkout. The priced lines of the basket are
+	copied to the order, so later changes on products or promotions don't affect it.
+*/
+
+type OrderStatus string
+
+const (
+	OrderStatusCreated OrderStatus = "created"
+)
+
+type Order struct {
+	ID        string           `json:"id"`
+	BasketID  string           `json:"basket_id"`
+	Status    OrderStatus      `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Currency  string           `json:"currency,omitempty"`
+	Items     []OrderItem      `json:"items"`
+	Subtotal  Money            `json:"subtotal"`
+	Discount  Money            `json:"discount"`
+	Discounts []BasketDiscount `json:"discounts,omitempty"`
+	Coupons   []AppliedCoupon  `json:"coupons,omitempty"`
+	Total     Money            `json:"total"`
+	Taxes     *TaxAmounts      `json:"taxes,omitempty"`
+	Country   string           `json:"country,omitempty"`
+}
+
+type OrderItem struct {
+	ProductID string   `json:"product_id"`
+	Name      string   `json:"name"`
+	UnitPrice Money    `json:"unit_price"`
+	Quantity  uint     `json:"quantity"`
+	Total     Money    `json:"total"`
+	Discount  Money    `json:"discount"`
+	Taxes     *LineTax `json:"taxes,omitempty"`
+}
+
+func NewOrder(basket Basket) *Order {
+	o := &Order{
+		BasketID: basket.ID,
+		Status:   OrderStatusCreated,
+		Currency: basket.GetCurrency(),
+		Items:    make([]OrderItem, 0, len(basket.Items)),
+		Subtotal: basket.Subtotal,
+		Discount: basket.Discount,
+		Total:    basket.Total,
+		Taxes:    basket.Taxes,
+		Country:  basket.Country,
+	}
+	if len(basket.Discounts) > 0 {
+		o.Discounts = append([]BasketDiscount{}, basket.Discounts...)
+	}
+	if len(basket.Coupons) > 0 {
+		o.Coupons = append([]AppliedCoupon{}, basket.Coupons...)
+	}
+
+	for _, item := range basket.Items {
+		o.Items = append(o.Items, OrderItem{
+			ProductID: item.Product.ID,
+			Name:      item.Product.Name,
+			UnitPrice: item.Product.Price,
+			Quantity:  item.Quantity,
+			Total:     item.Total,
+			Discount:  item.Discount,
+			Taxes:     item.Taxes,
+		})
+	}
+
+	// Stable order of lines
+	sort.Slice(o.Items, func(i, j int) bool {
+		return o.Items[i].ProductID < o.Items[j].ProductID
+	})
+
+	return o
+}
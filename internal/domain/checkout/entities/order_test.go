@@ -0,0 +1,66 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewOrder(t *testing.T) {
+	// Given
+	b := NewBasket()
+	b.ID = "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	bi := NewBasketItem(Product{ID: "TSHIRT", Name: "Lana T-Shirt", Price: NewMoney(2000, DefaultCurrency)}, nil)
+	bi.AddQuantity(2)
+	b.SaveItem(bi)
+	bi = NewBasketItem(Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, DefaultCurrency)}, &Promotion{
+		RequiredItems: 2,
+		FreeItems:     1,
+	})
+	bi.AddQuantity(2)
+	b.SaveItem(bi)
+
+	// When
+	o := NewOrder(*b)
+
+	// Then
+	assert.Equal(t, b.ID, o.BasketID)
+	assert.Equal(t, OrderStatusCreated, o.Status)
+	assert.Equal(t, []OrderItem{
+		{
+			ProductID: "PEN",
+			Name:      "Lana Pen",
+			UnitPrice: NewMoney(500, DefaultCurrency),
+			Quantity:  2,
+			Total:     NewMoney(1000, DefaultCurrency),
+			Discount:  NewMoney(500, DefaultCurrency),
+		},
+		{
+			ProductID: "TSHIRT",
+			Name:      "Lana T-Shirt",
+			UnitPrice: NewMoney(2000, DefaultCurrency),
+			Quantity:  2,
+			Total:     NewMoney(4000, DefaultCurrency),
+			Discount:  NewMoney(0, DefaultCurrency),
+		},
+	}, o.Items)
+	assert.Equal(t, NewMoney(5000, DefaultCurrency), o.Subtotal)
+	assert.Equal(t, NewMoney(500, DefaultCurrency), o.Discount)
+	assert.Equal(t, NewMoney(4500, DefaultCurrency), o.Total)
+}
+
+func TestBasket_CheckOut(t *testing.T) {
+	// Given
+	b := NewBasket()
+	o := &Order{ID: "ORDER", CreatedAt: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)}
+
+	// When
+	checkedOut := b.IsCheckedOut()
+	b.CheckOut(o)
+
+	// Then
+	assert.False(t, checkedOut)
+	assert.True(t, b.IsCheckedOut())
+	assert.Equal(t, o.CreatedAt, *b.CheckedOutAt)
+	assert.Equal(t, "ORDER", b.OrderID)
+}
@@ -1,8 +1,138 @@
 package entities
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+)
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	PromotionID *string `json:"promotion_id"`
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Price        Money          `json:"price"`
+	Prices       CurrencyPrices `json:"prices,omitempty"` // Prices in other currencies
+	PromotionIDs []string       `json:"promotion_ids"`
+	TaxClass     string         `json:"tax_class,omitempty"` // Standard if empty
+}
+
+// CurrencyPrices are prices by currency code. Prices can be given as numbers in major units of
+// the currency of the key, like {"USD":5.9}.
+type CurrencyPrices map[string]Money
+
+func (p Product) Validate() error {
+	if p.ID == "" {
+		return lanaerr.New(errors.New("product id is required"), http.StatusBadRequest)
+	}
+	if p.Name == "" {
+		return lanaerr.New(fmt.Errorf("product %s name is required", p.ID), http.StatusBadRequest)
+	}
+	if p.Price.Currency == "" {
+		return lanaerr.New(fmt.Errorf("product %s price currency is required", p.ID), http.StatusBadRequest)
+	}
+	if p.Price.IsNegative() {
+		return lanaerr.New(fmt.Errorf("product %s price can't be negative", p.ID), http.StatusBadRequest)
+	}
+	for currency, price := range p.Prices {
+		if currency == p.Price.Currency {
+			err := fmt.Errorf("product %s has two prices in %s", p.ID, currency)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+		if price.Currency != currency {
+			err := fmt.Errorf("product %s price in %s has currency %s", p.ID, currency, price.Currency)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+		if price.IsNegative() {
+			err := fmt.Errorf("product %s price in %s can't be negative", p.ID, currency)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+	}
+	seen := make(map[string]bool, len(p.PromotionIDs))
+	for _, promotionID := range p.PromotionIDs {
+		if promotionID == "" || seen[promotionID] {
+			err := fmt.Errorf("product %s promotion ids must be unique and not empty", p.ID)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+		seen[promotionID] = true
+	}
+	return nil
+}
+
+func (p Product) HasPromotion(promotionID string) bool {
+	for _, id := range p.PromotionIDs {
+		if id == promotionID {
+			return true
+		}
+	}
+	return false
+}
+
+// InCurrency returns a copy of the product priced in the given currency, with its own price in
+// that currency or its price converted with the exchange rates.
+func (p Product) InCurrency(currency string, rates ExchangeRates) (*Product, error) {
+	price, ok := p.Prices[currency]
+	if p.Price.Currency == currency {
+		price, ok = p.Price, true
+	}
+	if !ok {
+		price, ok = rates.Convert(p.Price, currency)
+	}
+	if !ok {
+		err := fmt.Errorf("product %s has no price in %s", p.ID, currency)
+		return nil, lanaerr.New(err, http.StatusBadRequest)
+	}
+
+	p.Price = price
+	p.Prices = nil
+	return &p, nil
+}
+
+// UnmarshalJSON accepts the original single promotion field(promotion_id) besides the list.
+func (p *Product) UnmarshalJSON(data []byte) error {
+	type product Product
+	aux := struct {
+		*product
+		PromotionID *string `json:"promotion_id"`
+	}{product: (*product)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.PromotionID != nil && *aux.PromotionID != "" && !p.HasPromotion(*aux.PromotionID) {
+		p.PromotionIDs = append([]string{*aux.PromotionID}, p.PromotionIDs...)
+	}
+	return nil
+}
+
+func (c *CurrencyPrices) UnmarshalJSON(data []byte) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*c = nil
+		return nil
+	}
+
+	prices := make(CurrencyPrices, len(raw))
+	for currency, value := range raw {
+		value = bytes.TrimSpace(value)
+		if len(value) > 0 && value[0] == '{' {
+			price := Money{}
+			if err := json.Unmarshal(value, &price); err != nil {
+				return err
+			}
+			prices[currency] = price
+			continue
+		}
+		price, err := ParseMoney(string(value), currency)
+		if err != nil {
+			return err
+		}
+		prices[currency] = price
+	}
+	*c = prices
+	return nil
 }
@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProduct_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		product Product
+		err     string
+	}{
+		{"valid", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR")}, ""},
+		{"free", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(0, "EUR")}, ""},
+		{"without id", Product{Name: "Lana Pen", Price: NewMoney(500, "EUR")}, "product id is required"},
+		{"without name", Product{ID: "PEN", Price: NewMoney(500, "EUR")}, "product PEN name is required"},
+		{"without currency", Product{ID: "PEN", Name: "Lana Pen"}, "product PEN price currency is required"},
+		{"negative price", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(-1, "EUR")}, "product PEN price can't be negative"},
+		{"promotions", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			PromotionIDs: []string{"2X1", "10OFF"}}, ""},
+		{"repeated promotion", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			PromotionIDs: []string{"2X1", "2X1"}}, "product PEN promotion ids must be unique and not empty"},
+		{"currency prices", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			Prices: CurrencyPrices{"USD": NewMoney(590, "USD")}}, ""},
+		{"repeated currency", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			Prices: CurrencyPrices{"EUR": NewMoney(450, "EUR")}}, "product PEN has two prices in EUR"},
+		{"wrong currency", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			Prices: CurrencyPrices{"USD": NewMoney(590, "GBP")}}, "product PEN price in USD has currency GBP"},
+		{"negative currency price", Product{ID: "PEN", Name: "Lana Pen", Price: NewMoney(500, "EUR"),
+			Prices: CurrencyPrices{"USD": NewMoney(-1, "USD")}}, "product PEN price in USD can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.product.Validate()
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProduct_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		promotionIDs []string
+	}{
+		{"list", `{"id":"PEN","promotion_ids":["2X1","10OFF"]}`, []string{"2X1", "10OFF"}},
+		{"single promotion", `{"id":"PEN","promotion_id":"2X1"}`, []string{"2X1"}},
+		{"single promotion null", `{"id":"PEN","promotion_id":null}`, nil},
+		{"both", `{"id":"PEN","promotion_id":"2X1","promotion_ids":["10OFF"]}`, []string{"2X1", "10OFF"}},
+		{"both repeated", `{"id":"PEN","promotion_id":"2X1","promotion_ids":["2X1"]}`, []string{"2X1"}},
+		{"without promotions", `{"id":"PEN"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := Product{}
+			err := json.Unmarshal([]byte(tt.data), &product)
+			assert.Nil(t, err)
+			assert.Equal(t, "PEN", product.ID)
+			assert.Equal(t, tt.promotionIDs, product.PromotionIDs)
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package entities
 
-import "math"
+import (
+	"errors"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"time"
+)
 
 /*
 	The idea of a promotion entity is to have a configurable abstraction of promotions
@@ -9,33 +15,153 @@ import "math"
 	course more params would be needed to support other kind of promotions. In real
 	scenarios promotions apply to certain stock units and are valid for certain time span
 	and change often so it's a good idea having some configurable parameters.
+
+	Every promotion has a type and the parameters of that type. The discount of each type is
+	calculated by a PromotionRule(see promotionrules.go). Promotions without type are the
+	original promotions, which use RequiredItems, FreeItems & Reduction.
+
+	Most promotions are assigned to a product and only look at its basket item. Basket level
+	promotions(like cross product bundles) are not assigned to products, they apply to every
+	basket and look at all the items together(see basketpromotion.go).
+
+	Promotions can be limited to a time window with StartsAt and EndsAt(both optional). Whether
+	a promotion is active is decided with the time the basket is priced at(see Basket.Reprice).
 */
 
+type PromotionType string
+
+const (
+	PromotionTypeDefault     PromotionType = ""
+	PromotionTypeBuyXGetY    PromotionType = "buy_x_get_y"
+	PromotionTypePercentage  PromotionType = "percentage"
+	PromotionTypeFixedAmount PromotionType = "fixed_amount"
+	PromotionTypeBundlePrice PromotionType = "bundle_price"
+	PromotionTypeTiered      PromotionType = "tiered"
+
+	// Basket level
+	PromotionTypeCrossProductBundle PromotionType = "cross_product_bundle"
+)
+
 type Promotion struct {
-	ID            string  `json:"id"`
+	ID          string         `json:"id"`
+	Description string         `json:"description,omitempty"` // Generated from the params if empty
+	Type        PromotionType  `json:"type,omitempty"`
+	StartsAt    *time.Time     `json:"starts_at,omitempty"`
+	EndsAt      *time.Time     `json:"ends_at,omitempty"`
+	Priority    int            `json:"priority,omitempty"`
+	Stacking    StackingPolicy `json:"stacking,omitempty"` // See promotionstacking.go
+
+	// Default type params
 	RequiredItems uint    `json:"required_items"`
 	FreeItems     uint    `json:"free_items"`
 	Reduction     float64 `json:"reduction"`
+
+	// Typed params, only the ones of the promotion type are used
+	BuyXGetY    *BuyXGetYParams    `json:"buy_x_get_y,omitempty"`
+	Percentage  *PercentageParams  `json:"percentage,omitempty"`
+	FixedAmount *FixedAmountParams `json:"fixed_amount,omitempty"`
+	BundlePrice *BundlePriceParams `json:"bundle_price,omitempty"`
+	Tiered      *TieredParams      `json:"tiered,omitempty"`
+
+	// Basket level typed params
+	CrossProductBundle *CrossProductBundleParams `json:"cross_product_bundle,omitempty"`
 }
 
-type PromotionType string
+// BuyXGetYParams: for every Buy units paid, Get more units are free. Buy 2 get 1 means 3 units
+// for the price of 2.
+type BuyXGetYParams struct {
+	Buy uint `json:"buy"`
+	Get uint `json:"get"`
+}
+
+// PercentageParams: percentage off the line total when at least MinQuantity units are bought.
+type PercentageParams struct {
+	Percent     float64 `json:"percent"`
+	MinQuantity uint    `json:"min_quantity"`
+}
+
+// FixedAmountParams: fixed amount off every unit when at least MinQuantity units are bought.
+type FixedAmountParams struct {
+	Amount      Money `json:"amount"`
+	MinQuantity uint  `json:"min_quantity"`
+}
+
+// BundlePriceParams: every Quantity units cost Price, like 3 for 10€.
+type BundlePriceParams struct {
+	Quantity uint  `json:"quantity"`
+	Price    Money `json:"price"`
+}
 
-func (d Promotion) Apply(item *BasketItem) float64 {
-	amount := 0.0
+// TieredParams: volume pricing, the unit price of the highest tier reached applies to all the
+// units.
+type TieredParams struct {
+	Tiers []PriceTier `json:"tiers"`
+}
+
+type PriceTier struct {
+	MinQuantity uint  `json:"min_quantity"`
+	UnitPrice   Money `json:"unit_price"`
+}
+
+func (d Promotion) Validate() error {
+	if d.ID == "" {
+		return lanaerr.New(errors.New("promotion id is required"), http.StatusBadRequest)
+	}
+
+	if d.StartsAt != nil && d.EndsAt != nil && !d.EndsAt.After(*d.StartsAt) {
+		err := fmt.Errorf("promotion %s ends_at must be after starts_at", d.ID)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
+
+	switch d.Stacking {
+	case "", StackingExclusive, StackingStackable, StackingBestForCustomer:
+	default:
+		err := fmt.Errorf("promotion %s stacking %s is not supported", d.ID, d.Stacking)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
 
-	// Check required items
-	if item.Quantity < d.RequiredItems {
-		return amount
+	var validate func(Promotion) error
+	if rule, ok := getPromotionRule(d.Type); ok {
+		validate = rule.Validate
+	} else if rule, ok := getBasketPromotionRule(d.Type); ok {
+		validate = rule.Validate
+	} else {
+		err := fmt.Errorf("promotion %s type %s is not supported", d.ID, d.Type)
+		return lanaerr.New(err, http.StatusBadRequest)
 	}
 
-	// Apply free items discount
-	amount += float64(d.FreeItems) * math.Floor(float64(item.Quantity)/float64(d.RequiredItems)) * item.Product.Price
+	if err := validate(d); err != nil {
+		return lanaerr.New(fmt.Errorf("promotion %s %w", d.ID, err), http.StatusBadRequest)
+	}
 
-	// Apply reduction
-	amount += (d.Reduction / 100) * item.Total
+	return nil
+}
 
-	// Round to two decimals
-	amount = math.Round(amount*100) / 100
+// IsActive tells if the promotion applies at the given time. StartsAt is inclusive and EndsAt
+// exclusive.
+func (d Promotion) IsActive(now time.Time) bool {
+	if d.StartsAt != nil && now.Before(*d.StartsAt) {
+		return false
+	}
+	if d.EndsAt != nil && !now.Before(*d.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// IsBasketLevel tells if the promotion applies to the basket as a whole instead of a product.
+func (d Promotion) IsBasketLevel() bool {
+	_, ok := getBasketPromotionRule(d.Type)
+	return ok
+}
+
+// Apply returns the discount of the promotion for the basket item. Promotions of an unknown
+// type or basket level promotions don't apply any discount to a single item.
+func (d Promotion) Apply(item *BasketItem) Money {
+	rule, ok := getPromotionRule(d.Type)
+	if !ok {
+		return Zero(item.Product.Price.Currency)
+	}
 
-	return amount
+	return rule.Apply(d, item)
 }
@@ -3,6 +3,7 @@ package entities
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestPromotion_Apply_WithoutRequiredItems(t *testing.T) {
@@ -27,7 +28,7 @@ func TestPromotion_Apply_2X1(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 15.5,
+		Price: NewMoney(1550, DefaultCurrency),
 	}
 	bi := NewBasketItem(product, promotion)
 	bi.AddQuantity(3)
@@ -36,7 +37,7 @@ func TestPromotion_Apply_2X1(t *testing.T) {
 	amount := promotion.Apply(bi)
 
 	// Then
-	assert.Equal(t, 15.5, amount)
+	assert.Equal(t, NewMoney(1550, DefaultCurrency), amount)
 }
 
 func TestPromotion_Apply_25OFF3ORMORE(t *testing.T) {
@@ -49,7 +50,7 @@ func TestPromotion_Apply_25OFF3ORMORE(t *testing.T) {
 	product := Product{
 		ID:    "PEN",
 		Name:  "PEN",
-		Price: 50,
+		Price: NewMoney(5000, DefaultCurrency),
 	}
 	bi := NewBasketItem(product, promotion)
 	bi.AddQuantity(3)
@@ -58,5 +59,195 @@ func TestPromotion_Apply_25OFF3ORMORE(t *testing.T) {
 	amount := promotion.Apply(bi)
 
 	// Then
-	assert.Equal(t, 37.5, amount)
+	assert.Equal(t, NewMoney(3750, DefaultCurrency), amount)
+}
+
+func TestPromotion_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		err       string
+	}{
+		{"2x1", Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}, ""},
+		{"reduction", Promotion{ID: "25OFF", RequiredItems: 3, Reduction: 25}, ""},
+		{"reduction without required items", Promotion{ID: "10OFF", Reduction: 10}, ""},
+		{"without id", Promotion{RequiredItems: 2, FreeItems: 1}, "promotion id is required"},
+		{"free items without required items", Promotion{ID: "FREE", FreeItems: 1},
+			"promotion FREE required items must be greater than zero when free items are set"},
+		{"more free items than required", Promotion{ID: "FREE", RequiredItems: 1, FreeItems: 2},
+			"promotion FREE free items can't be greater than required items"},
+		{"negative reduction", Promotion{ID: "OFF", Reduction: -1}, "promotion OFF reduction must be between 0 and 100"},
+		{"reduction over 100", Promotion{ID: "OFF", Reduction: 100.5}, "promotion OFF reduction must be between 0 and 100"},
+		{"unknown type", Promotion{ID: "X", Type: "unknown"}, "promotion X type unknown is not supported"},
+		{"stacking", Promotion{ID: "X", Reduction: 10, Stacking: StackingBestForCustomer}, ""},
+		{"unknown stacking", Promotion{ID: "X", Stacking: "always"}, "promotion X stacking always is not supported"},
+		{"buy x get y", Promotion{ID: "3X2", Type: PromotionTypeBuyXGetY, BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}}, ""},
+		{"buy x get y without params", Promotion{ID: "3X2", Type: PromotionTypeBuyXGetY},
+			"promotion 3X2 buy_x_get_y params are required"},
+		{"buy x get y without get", Promotion{ID: "3X2", Type: PromotionTypeBuyXGetY, BuyXGetY: &BuyXGetYParams{Buy: 2}},
+			"promotion 3X2 buy and get must be greater than zero"},
+		{"percentage", Promotion{ID: "10OFF", Type: PromotionTypePercentage, Percentage: &PercentageParams{Percent: 10}}, ""},
+		{"percentage over 100", Promotion{ID: "OFF", Type: PromotionTypePercentage, Percentage: &PercentageParams{Percent: 101}},
+			"promotion OFF percent must be greater than 0 and up to 100"},
+		{"fixed amount", Promotion{ID: "1OFF", Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: NewMoney(100, DefaultCurrency)}}, ""},
+		{"fixed amount without currency", Promotion{ID: "1OFF", Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: Money{Amount: 100}}}, "promotion 1OFF amount currency is required"},
+		{"fixed amount zero", Promotion{ID: "1OFF", Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: Zero(DefaultCurrency)}}, "promotion 1OFF amount must be greater than zero"},
+		{"bundle price", Promotion{ID: "3FOR10", Type: PromotionTypeBundlePrice,
+			BundlePrice: &BundlePriceParams{Quantity: 3, Price: NewMoney(1000, DefaultCurrency)}}, ""},
+		{"bundle of one unit", Promotion{ID: "1FOR10", Type: PromotionTypeBundlePrice,
+			BundlePrice: &BundlePriceParams{Quantity: 1, Price: NewMoney(1000, DefaultCurrency)}},
+			"promotion 1FOR10 bundle quantity must be at least 2"},
+		{"tiered", Promotion{ID: "VOLUME", Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+			{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+			{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+		}}}, ""},
+		{"cross product bundle", buildBundlePromotion(), ""},
+		{"cross product bundle with one product", Promotion{ID: "PENMUG", Type: PromotionTypeCrossProductBundle,
+			CrossProductBundle: &CrossProductBundleParams{
+				Items:    []BundleItem{{ProductID: "PEN", Quantity: 1}},
+				Discount: NewMoney(200, DefaultCurrency),
+			}}, "promotion PENMUG bundle must have at least two products"},
+		{"cross product bundle without discount", Promotion{ID: "PENMUG", Type: PromotionTypeCrossProductBundle,
+			CrossProductBundle: &CrossProductBundleParams{
+				Items: []BundleItem{{ProductID: "PEN", Quantity: 1}, {ProductID: "MUG", Quantity: 1}},
+			}}, "promotion PENMUG discount currency is required"},
+		{"tiered without tiers", Promotion{ID: "VOLUME", Type: PromotionTypeTiered, Tiered: &TieredParams{}},
+			"promotion VOLUME tiered params with at least one tier are required"},
+		{"tiered unsorted", Promotion{ID: "VOLUME", Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+			{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+			{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+		}}}, "promotion VOLUME tiers must be sorted by min quantity without duplicates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.promotion.Validate()
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPromotion_Apply_Types(t *testing.T) {
+	price := NewMoney(500, DefaultCurrency)
+	tests := []struct {
+		name      string
+		promotion Promotion
+		quantity  uint
+		discount  Money
+	}{
+		{"unknown type", Promotion{Type: "unknown"}, 3, Zero(DefaultCurrency)},
+		{"buy 2 get 1 with 3 units", Promotion{Type: PromotionTypeBuyXGetY,
+			BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}}, 3, NewMoney(500, DefaultCurrency)},
+		{"buy 2 get 1 with 5 units", Promotion{Type: PromotionTypeBuyXGetY,
+			BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}}, 5, NewMoney(500, DefaultCurrency)},
+		{"buy 2 get 1 with 6 units", Promotion{Type: PromotionTypeBuyXGetY,
+			BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}}, 6, NewMoney(1000, DefaultCurrency)},
+		{"percentage", Promotion{Type: PromotionTypePercentage,
+			Percentage: &PercentageParams{Percent: 10}}, 3, NewMoney(150, DefaultCurrency)},
+		{"percentage below min quantity", Promotion{Type: PromotionTypePercentage,
+			Percentage: &PercentageParams{Percent: 10, MinQuantity: 4}}, 3, Zero(DefaultCurrency)},
+		{"fixed amount", Promotion{Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: NewMoney(100, DefaultCurrency)}}, 3, NewMoney(300, DefaultCurrency)},
+		{"fixed amount capped to total", Promotion{Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: NewMoney(800, DefaultCurrency)}}, 2, NewMoney(1000, DefaultCurrency)},
+		{"fixed amount other currency", Promotion{Type: PromotionTypeFixedAmount,
+			FixedAmount: &FixedAmountParams{Amount: NewMoney(100, "USD")}}, 3, Zero(DefaultCurrency)},
+		{"bundle price", Promotion{Type: PromotionTypeBundlePrice,
+			BundlePrice: &BundlePriceParams{Quantity: 3, Price: NewMoney(1000, DefaultCurrency)}}, 7, NewMoney(1000, DefaultCurrency)},
+		{"bundle price more expensive", Promotion{Type: PromotionTypeBundlePrice,
+			BundlePrice: &BundlePriceParams{Quantity: 3, Price: NewMoney(2000, DefaultCurrency)}}, 3, Zero(DefaultCurrency)},
+		{"tiered below first tier", Promotion{Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+			{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+			{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+		}}}, 4, Zero(DefaultCurrency)},
+		{"tiered first tier", Promotion{Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+			{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+			{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+		}}}, 6, NewMoney(300, DefaultCurrency)},
+		{"tiered highest tier", Promotion{Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+			{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+			{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+		}}}, 10, NewMoney(1000, DefaultCurrency)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			product := Product{ID: "PEN", Name: "PEN", Price: price}
+			bi := NewBasketItem(product, &tt.promotion)
+			bi.AddQuantity(tt.quantity)
+
+			// When
+			amount := tt.promotion.Apply(bi)
+
+			// Then
+			assert.Equal(t, tt.discount, amount)
+			assert.Equal(t, tt.discount, bi.Discount)
+		})
+	}
+}
+
+type fakePromotionRule struct{}
+
+func (fakePromotionRule) Validate(Promotion) error {
+	return nil
+}
+
+func (fakePromotionRule) Apply(_ Promotion, item *BasketItem) Money {
+	return item.Product.Price
+}
+
+func (fakePromotionRule) Describe(Promotion) string {
+	return "first unit free"
+}
+
+func (fakePromotionRule) Units(Promotion, *BasketItem) uint {
+	return 1
+}
+
+func (fakePromotionRule) NextThreshold(Promotion, *BasketItem) (uint, string) {
+	return 0, ""
+}
+
+func TestRegisterPromotionRule(t *testing.T) {
+	// Given
+	RegisterPromotionRule("first_unit_free", fakePromotionRule{})
+	promotion := &Promotion{ID: "FIRST", Type: "first_unit_free"}
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, promotion)
+
+	// When
+	bi.AddQuantity(2)
+
+	// Then
+	assert.Nil(t, promotion.Validate())
+	assert.Equal(t, NewMoney(500, DefaultCurrency), bi.Discount)
+}
+
+func TestPromotion_IsActive(t *testing.T) {
+	startsAt := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(24 * time.Hour)
+	promotion := Promotion{ID: "2X1", StartsAt: &startsAt, EndsAt: &endsAt}
+
+	assert.False(t, promotion.IsActive(startsAt.Add(-time.Second)))
+	assert.True(t, promotion.IsActive(startsAt))
+	assert.True(t, promotion.IsActive(endsAt.Add(-time.Second)))
+	assert.False(t, promotion.IsActive(endsAt))
+	assert.True(t, Promotion{ID: "2X1"}.IsActive(time.Time{}))
+}
+
+func TestPromotion_Validate_TimeWindow(t *testing.T) {
+	// Given
+	startsAt := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	promotion := Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1, StartsAt: &startsAt, EndsAt: &startsAt}
+
+	// When
+	err := promotion.Validate()
+
+	// Then
+	assert.EqualError(t, err, "promotion 2X1 ends_at must be after starts_at")
 }
@@ -0,0 +1,132 @@
+package entities
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+	Baskets explain their discounts, so clients can show the savings without knowing how
+	promotions are calculated:
+
+	- Every basket item lists its applied promotions(see promotionstacking.go) and the basket
+	  lists the promotions applied to all the items and to the basket as a whole.
+	- Every basket item has a hint with the closest threshold of its promotions, like
+	  "add 1 more TSHIRT for 25% off".
+
+	Descriptions, units and thresholds are provided by the promotion rules.
+*/
+
+// PromotionHint tells how many units of a product must be added to get the next discount.
+type PromotionHint struct {
+	PromotionID string `json:"promotion_id"`
+	Quantity    uint   `json:"quantity"`
+	Message     string `json:"message"`
+}
+
+// Describe returns the description of the promotion. If it has no description one is generated
+// from its params.
+func (d Promotion) Describe() string {
+	if d.Description != "" {
+		return d.Description
+	}
+
+	description := ""
+	if rule, ok := getPromotionRule(d.Type); ok {
+		description = rule.Describe(d)
+	} else if rule, ok := getBasketPromotionRule(d.Type); ok {
+		description = rule.Describe(d)
+	}
+	if description == "" {
+		return d.ID
+	}
+	return description
+}
+
+// Units returns the units of the basket item the promotion applies to.
+func (d Promotion) Units(item *BasketItem) uint {
+	rule, ok := getPromotionRule(d.Type)
+	if !ok {
+		return 0
+	}
+	return rule.Units(d, item)
+}
+
+// NextThreshold returns the hint to get the next discount of the promotion for the basket item,
+// nil if there is nothing else to get.
+func (d Promotion) NextThreshold(item *BasketItem) *PromotionHint {
+	rule, ok := getPromotionRule(d.Type)
+	if !ok {
+		return nil
+	}
+	quantity, benefit := rule.NextThreshold(d, item)
+	if quantity == 0 {
+		return nil
+	}
+	return &PromotionHint{
+		PromotionID: d.ID,
+		Quantity:    quantity,
+		Message:     fmt.Sprintf("add %d more %s for %s", quantity, item.Product.ID, benefit),
+	}
+}
+
+// nextThreshold returns the closest threshold of the promotions. On a tie the promotion with the
+// highest priority wins.
+func nextThreshold(promotions []Promotion, item *BasketItem) *PromotionHint {
+	if item.Quantity == 0 {
+		return nil
+	}
+
+	var best *PromotionHint
+	for _, promotion := range sortByPriority(promotions) {
+		hint := promotion.NextThreshold(item)
+		if hint != nil && (best == nil || hint.Quantity < best.Quantity) {
+			best = hint
+		}
+	}
+	return best
+}
+
+// summarizePromotions returns the promotions applied to the basket items and to the basket,
+// with the units and discounts of every promotion added up.
+func summarizePromotions(b *Basket) []AppliedPromotion {
+	summary := make(map[string]AppliedPromotion)
+	add := func(a AppliedPromotion) {
+		if current, ok := summary[a.PromotionID]; ok {
+			a.Units += current.Units
+			a.Discount = a.Discount.Add(current.Discount)
+		}
+		summary[a.PromotionID] = a
+	}
+
+	for _, item := range b.Items {
+		for _, a := range item.AppliedPromotions {
+			add(a)
+		}
+	}
+
+	descriptions := make(map[string]string, len(b.Promotions))
+	for _, promotion := range b.Promotions {
+		descriptions[promotion.ID] = promotion.Describe()
+	}
+	for _, d := range b.Discounts {
+		add(AppliedPromotion{
+			PromotionID: d.PromotionID,
+			Description: descriptions[d.PromotionID],
+			Units:       d.Units,
+			Discount:    d.Amount,
+		})
+	}
+
+	if len(summary) == 0 {
+		return nil
+	}
+	applied := make([]AppliedPromotion, 0, len(summary))
+	for _, a := range summary {
+		applied = append(applied, a)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].PromotionID < applied[j].PromotionID
+	})
+	return applied
+}
@@ -0,0 +1,194 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPromotion_Describe(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		expected  string
+	}{
+		{
+			name:      "custom description",
+			promotion: Promotion{ID: "2X1", Description: "2x1 on pens", RequiredItems: 2, FreeItems: 1},
+			expected:  "2x1 on pens",
+		},
+		{
+			name:      "default free items",
+			promotion: Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1},
+			expected:  "1 free every 2 units",
+		},
+		{
+			name:      "default reduction",
+			promotion: Promotion{ID: "25OFF", RequiredItems: 3, Reduction: 25},
+			expected:  "25% off buying 3 or more",
+		},
+		{
+			name:      "default without discount",
+			promotion: Promotion{ID: "NOTHING"},
+			expected:  "NOTHING",
+		},
+		{
+			name:      "buy x get y",
+			promotion: Promotion{ID: "3X2", Type: PromotionTypeBuyXGetY, BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}},
+			expected:  "buy 2 get 1 free",
+		},
+		{
+			name: "percentage",
+			promotion: Promotion{ID: "10OFF", Type: PromotionTypePercentage,
+				Percentage: &PercentageParams{Percent: 10.5, MinQuantity: 2}},
+			expected: "10.5% off buying 2 or more",
+		},
+		{
+			name: "fixed amount",
+			promotion: Promotion{ID: "1OFF", Type: PromotionTypeFixedAmount,
+				FixedAmount: &FixedAmountParams{Amount: NewMoney(100, DefaultCurrency)}},
+			expected: "1.00 EUR off every unit",
+		},
+		{
+			name: "bundle price",
+			promotion: Promotion{ID: "3FOR10", Type: PromotionTypeBundlePrice,
+				BundlePrice: &BundlePriceParams{Quantity: 3, Price: NewMoney(1000, DefaultCurrency)}},
+			expected: "3 for 10.00 EUR",
+		},
+		{
+			name: "tiered",
+			promotion: Promotion{ID: "VOLUME", Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+				{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+				{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+			}}},
+			expected: "4.50 EUR each from 5 units, 4.00 EUR each from 10 units",
+		},
+		{
+			name:      "cross product bundle",
+			promotion: buildBundlePromotion(),
+			expected:  "2.00 EUR off buying 1 PEN and 1 MUG",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.promotion.Describe())
+		})
+	}
+}
+
+func TestBasketItem_PromotionDetails(t *testing.T) {
+	tiered := Promotion{ID: "VOLUME", Type: PromotionTypeTiered, Tiered: &TieredParams{Tiers: []PriceTier{
+		{MinQuantity: 5, UnitPrice: NewMoney(450, DefaultCurrency)},
+		{MinQuantity: 10, UnitPrice: NewMoney(400, DefaultCurrency)},
+	}}}
+	tests := []struct {
+		name       string
+		promotions []Promotion
+		quantity   uint
+		units      uint
+		hint       *PromotionHint
+	}{
+		{
+			name:       "required items not reached",
+			promotions: []Promotion{{ID: "25OFF", RequiredItems: 3, Reduction: 25}},
+			quantity:   2,
+			hint:       &PromotionHint{PromotionID: "25OFF", Quantity: 1, Message: "add 1 more PEN for 25% off"},
+		},
+		{
+			name:       "required items reached",
+			promotions: []Promotion{{ID: "25OFF", RequiredItems: 3, Reduction: 25}},
+			quantity:   4,
+			units:      4,
+		},
+		{
+			name:       "next set of free items",
+			promotions: []Promotion{{ID: "2X1", RequiredItems: 2, FreeItems: 1}},
+			quantity:   3,
+			units:      2,
+			hint:       &PromotionHint{PromotionID: "2X1", Quantity: 1, Message: "add 1 more PEN for 1 free"},
+		},
+		{
+			name: "buy x get y",
+			promotions: []Promotion{{ID: "3X2", Type: PromotionTypeBuyXGetY,
+				BuyXGetY: &BuyXGetYParams{Buy: 2, Get: 1}}},
+			quantity: 4,
+			units:    3,
+			hint:     &PromotionHint{PromotionID: "3X2", Quantity: 2, Message: "add 2 more PEN for 1 free"},
+		},
+		{
+			name: "bundle price",
+			promotions: []Promotion{{ID: "3FOR10", Type: PromotionTypeBundlePrice,
+				BundlePrice: &BundlePriceParams{Quantity: 3, Price: NewMoney(1000, DefaultCurrency)}}},
+			quantity: 1,
+			hint:     &PromotionHint{PromotionID: "3FOR10", Quantity: 2, Message: "add 2 more PEN for 3 for 10.00 EUR"},
+		},
+		{
+			name:       "next tier",
+			promotions: []Promotion{tiered},
+			quantity:   6,
+			units:      6,
+			hint:       &PromotionHint{PromotionID: "VOLUME", Quantity: 4, Message: "add 4 more PEN for 4.00 EUR each"},
+		},
+		{
+			name:       "highest tier reached",
+			promotions: []Promotion{tiered},
+			quantity:   10,
+			units:      10,
+		},
+		{
+			name: "closest threshold",
+			promotions: []Promotion{
+				{ID: "25OFF", RequiredItems: 3, Reduction: 25},
+				{ID: "10OFF", Type: PromotionTypePercentage, Percentage: &PercentageParams{Percent: 10, MinQuantity: 2}},
+			},
+			quantity: 1,
+			hint:     &PromotionHint{PromotionID: "10OFF", Quantity: 1, Message: "add 1 more PEN for 10% off"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			promotions := make([]*Promotion, 0, len(tt.promotions))
+			for i := range tt.promotions {
+				promotions = append(promotions, &tt.promotions[i])
+			}
+			bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, promotions...)
+
+			// When
+			bi.AddQuantity(tt.quantity)
+
+			// Then
+			units := uint(0)
+			for _, a := range bi.AppliedPromotions {
+				units += a.Units
+			}
+			assert.Equal(t, tt.units, units)
+			assert.Equal(t, tt.hint, bi.NextThreshold)
+		})
+	}
+}
+
+func TestBasket_AppliedPromotions(t *testing.T) {
+	// Given
+	promotion2X1 := &Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	b := NewBasket()
+	b.SetPromotions([]Promotion{buildBundlePromotion()})
+	pen := NewBasketItem(Product{ID: "PEN", Price: NewMoney(500, DefaultCurrency)}, promotion2X1)
+	pen.AddQuantity(3)
+	b.SaveItem(pen)
+	book := NewBasketItem(Product{ID: "BOOK", Price: NewMoney(1000, DefaultCurrency)}, promotion2X1)
+	book.AddQuantity(2)
+	b.SaveItem(book)
+
+	// When
+	mug := NewBasketItem(Product{ID: "MUG", Price: NewMoney(750, DefaultCurrency)}, nil)
+	mug.AddQuantity(1)
+	b.SaveItem(mug)
+
+	// Then
+	assert.Equal(t, []AppliedPromotion{
+		{PromotionID: "2X1", Description: "1 free every 2 units", Units: 4, Discount: NewMoney(1500, DefaultCurrency)},
+		{PromotionID: "PENMUG", Description: "2.00 EUR off buying 1 PEN and 1 MUG", Units: 2,
+			Discount: NewMoney(200, DefaultCurrency)},
+	}, b.AppliedPromotions)
+	assert.Equal(t, NewMoney(1700, DefaultCurrency), b.Discount)
+}
@@ -0,0 +1,467 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PromotionRule calculates the discount of a promotion type. New promotion types are added by
+// registering a rule for them, the rest of the checkout doesn't need to know about them.
+type PromotionRule interface {
+	// Validate checks the params of the promotion. The error message is prefixed with the
+	// promotion id, like "promotion 2X1 <message>"
+	Validate(promotion Promotion) error
+	// Apply returns the discount of the promotion for the basket item
+	Apply(promotion Promotion, item *BasketItem) Money
+	// Describe returns a human readable description of the promotion, like "buy 2 get 1 free"
+	Describe(promotion Promotion) string
+	// Units returns the units of the basket item the discount applies to
+	Units(promotion Promotion, item *BasketItem) uint
+	// NextThreshold returns the units to add to the basket item to get the next discount and
+	// what is obtained with them, like 1 and "25% off". Zero units means there is nothing else
+	// to get
+	NextThreshold(promotion Promotion, item *BasketItem) (uint, string)
+}
+
+var promotionRules = struct {
+	sync.RWMutex
+	rules map[PromotionType]PromotionRule
+}{
+	rules: map[PromotionType]PromotionRule{
+		PromotionTypeDefault:     defaultRule{},
+		PromotionTypeBuyXGetY:    buyXGetYRule{},
+		PromotionTypePercentage:  percentageRule{},
+		PromotionTypeFixedAmount: fixedAmountRule{},
+		PromotionTypeBundlePrice: bundlePriceRule{},
+		PromotionTypeTiered:      tieredRule{},
+	},
+}
+
+// RegisterPromotionRule adds or replaces the rule of a promotion type.
+func RegisterPromotionRule(promotionType PromotionType, rule PromotionRule) {
+	promotionRules.Lock()
+	defer promotionRules.Unlock()
+	promotionRules.rules[promotionType] = rule
+}
+
+func getPromotionRule(promotionType PromotionType) (PromotionRule, bool) {
+	promotionRules.RLock()
+	defer promotionRules.RUnlock()
+	rule, ok := promotionRules.rules[promotionType]
+	return rule, ok
+}
+
+// ===========================================================================================
+// Default: N units required, M of them free and/or a percentage reduction
+// ===========================================================================================
+type defaultRule struct{}
+
+func (defaultRule) Validate(d Promotion) error {
+	if d.FreeItems > 0 && d.RequiredItems == 0 {
+		return errors.New("required items must be greater than zero when free items are set")
+	}
+	if d.FreeItems > d.RequiredItems {
+		return errors.New("free items can't be greater than required items")
+	}
+	if d.Reduction < 0 || d.Reduction > 100 {
+		return errors.New("reduction must be between 0 and 100")
+	}
+	return nil
+}
+
+func (defaultRule) Apply(d Promotion, item *BasketItem) Money {
+	amount := Zero(item.Product.Price.Currency)
+
+	// Check required items
+	if item.Quantity < d.RequiredItems {
+		return amount
+	}
+
+	// Apply free items discount
+	if d.RequiredItems > 0 {
+		sets := int64(item.Quantity / d.RequiredItems)
+		amount = amount.Add(item.Product.Price.Multiply(int64(d.FreeItems) * sets))
+	}
+
+	// Apply reduction
+	amount = amount.Add(item.Total.Percent(d.Reduction, RoundHalfUp))
+
+	return amount
+}
+
+func (defaultRule) Describe(d Promotion) string {
+	parts := make([]string, 0, 2)
+	if d.FreeItems > 0 {
+		parts = append(parts, fmt.Sprintf("%d free every %d units", d.FreeItems, d.RequiredItems))
+	}
+	if d.Reduction > 0 {
+		parts = append(parts, fmt.Sprintf("%g%% off", d.Reduction))
+	}
+	description := strings.Join(parts, " and ")
+	if d.FreeItems == 0 && description != "" {
+		description += buyingMinimum(d.RequiredItems)
+	}
+	return description
+}
+
+func (defaultRule) Units(d Promotion, item *BasketItem) uint {
+	if item.Quantity < d.RequiredItems {
+		return 0
+	}
+	if d.Reduction > 0 {
+		return item.Quantity
+	}
+	if d.RequiredItems > 0 && d.FreeItems > 0 {
+		return item.Quantity / d.RequiredItems * d.RequiredItems
+	}
+	return 0
+}
+
+func (defaultRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	if d.RequiredItems == 0 {
+		return 0, ""
+	}
+
+	// Required items not reached, everything is obtained with them
+	if item.Quantity < d.RequiredItems {
+		parts := make([]string, 0, 2)
+		if d.FreeItems > 0 {
+			parts = append(parts, fmt.Sprintf("%d free", d.FreeItems))
+		}
+		if d.Reduction > 0 {
+			parts = append(parts, fmt.Sprintf("%g%% off", d.Reduction))
+		}
+		if len(parts) == 0 {
+			return 0, ""
+		}
+		return d.RequiredItems - item.Quantity, strings.Join(parts, " and ")
+	}
+
+	// Next set of free items
+	if d.FreeItems > 0 {
+		return d.RequiredItems - item.Quantity%d.RequiredItems, fmt.Sprintf("%d free", d.FreeItems)
+	}
+	return 0, ""
+}
+
+// ===========================================================================================
+// Buy X get Y
+// ===========================================================================================
+type buyXGetYRule struct{}
+
+func (buyXGetYRule) Validate(d Promotion) error {
+	p := d.BuyXGetY
+	if p == nil {
+		return errors.New("buy_x_get_y params are required")
+	}
+	if p.Buy == 0 || p.Get == 0 {
+		return errors.New("buy and get must be greater than zero")
+	}
+	return nil
+}
+
+func (buyXGetYRule) Apply(d Promotion, item *BasketItem) Money {
+	p := d.BuyXGetY
+	if p == nil || p.Buy+p.Get == 0 {
+		return Zero(item.Product.Price.Currency)
+	}
+
+	sets := int64(item.Quantity / (p.Buy + p.Get))
+	return item.Product.Price.Multiply(sets * int64(p.Get))
+}
+
+func (buyXGetYRule) Describe(d Promotion) string {
+	p := d.BuyXGetY
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("buy %d get %d free", p.Buy, p.Get)
+}
+
+func (buyXGetYRule) Units(d Promotion, item *BasketItem) uint {
+	p := d.BuyXGetY
+	if p == nil || p.Buy+p.Get == 0 {
+		return 0
+	}
+	return item.Quantity / (p.Buy + p.Get) * (p.Buy + p.Get)
+}
+
+func (buyXGetYRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	p := d.BuyXGetY
+	if p == nil || p.Buy+p.Get == 0 {
+		return 0, ""
+	}
+	set := p.Buy + p.Get
+	return set - item.Quantity%set, fmt.Sprintf("%d free", p.Get)
+}
+
+// ===========================================================================================
+// Percentage off
+// ===========================================================================================
+type percentageRule struct{}
+
+func (percentageRule) Validate(d Promotion) error {
+	p := d.Percentage
+	if p == nil {
+		return errors.New("percentage params are required")
+	}
+	if p.Percent <= 0 || p.Percent > 100 {
+		return errors.New("percent must be greater than 0 and up to 100")
+	}
+	return nil
+}
+
+func (percentageRule) Apply(d Promotion, item *BasketItem) Money {
+	p := d.Percentage
+	if p == nil || item.Quantity == 0 || item.Quantity < p.MinQuantity {
+		return Zero(item.Product.Price.Currency)
+	}
+
+	return item.Total.Percent(p.Percent, RoundHalfUp)
+}
+
+func (percentageRule) Describe(d Promotion) string {
+	p := d.Percentage
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g%% off", p.Percent) + buyingMinimum(p.MinQuantity)
+}
+
+func (percentageRule) Units(d Promotion, item *BasketItem) uint {
+	p := d.Percentage
+	if p == nil || item.Quantity < p.MinQuantity {
+		return 0
+	}
+	return item.Quantity
+}
+
+func (percentageRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	p := d.Percentage
+	if p == nil || item.Quantity >= p.MinQuantity {
+		return 0, ""
+	}
+	return p.MinQuantity - item.Quantity, fmt.Sprintf("%g%% off", p.Percent)
+}
+
+// ===========================================================================================
+// Fixed amount off every unit
+// ===========================================================================================
+type fixedAmountRule struct{}
+
+func (fixedAmountRule) Validate(d Promotion) error {
+	p := d.FixedAmount
+	if p == nil {
+		return errors.New("fixed_amount params are required")
+	}
+	if p.Amount.Currency == "" {
+		return errors.New("amount currency is required")
+	}
+	if p.Amount.IsZero() || p.Amount.IsNegative() {
+		return errors.New("amount must be greater than zero")
+	}
+	return nil
+}
+
+func (fixedAmountRule) Apply(d Promotion, item *BasketItem) Money {
+	p := d.FixedAmount
+	if p == nil || !sameCurrency(p.Amount, item) || item.Quantity < p.MinQuantity {
+		return Zero(item.Product.Price.Currency)
+	}
+
+	// Never more than the price of the units
+	return p.Amount.Multiply(int64(item.Quantity)).Min(item.Total)
+}
+
+func (fixedAmountRule) Describe(d Promotion) string {
+	p := d.FixedAmount
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s off every unit", p.Amount) + buyingMinimum(p.MinQuantity)
+}
+
+func (fixedAmountRule) Units(d Promotion, item *BasketItem) uint {
+	p := d.FixedAmount
+	if p == nil || !sameCurrency(p.Amount, item) || item.Quantity < p.MinQuantity {
+		return 0
+	}
+	return item.Quantity
+}
+
+func (fixedAmountRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	p := d.FixedAmount
+	if p == nil || !sameCurrency(p.Amount, item) || item.Quantity >= p.MinQuantity {
+		return 0, ""
+	}
+	return p.MinQuantity - item.Quantity, fmt.Sprintf("%s off every unit", p.Amount)
+}
+
+// ===========================================================================================
+// Bundle price: N units for a fixed price
+// ===========================================================================================
+type bundlePriceRule struct{}
+
+func (bundlePriceRule) Validate(d Promotion) error {
+	p := d.BundlePrice
+	if p == nil {
+		return errors.New("bundle_price params are required")
+	}
+	if p.Quantity < 2 {
+		return errors.New("bundle quantity must be at least 2")
+	}
+	if p.Price.Currency == "" {
+		return errors.New("bundle price currency is required")
+	}
+	if p.Price.IsNegative() {
+		return errors.New("bundle price can't be negative")
+	}
+	return nil
+}
+
+func (bundlePriceRule) Apply(d Promotion, item *BasketItem) Money {
+	zero := Zero(item.Product.Price.Currency)
+	p := d.BundlePrice
+	if p == nil || p.Quantity == 0 || !sameCurrency(p.Price, item) {
+		return zero
+	}
+
+	// A bundle more expensive than its units doesn't apply
+	saving := item.Product.Price.Multiply(int64(p.Quantity)).Sub(p.Price)
+	if saving.IsNegative() || saving.IsZero() {
+		return zero
+	}
+
+	sets := int64(item.Quantity / p.Quantity)
+	return saving.Multiply(sets)
+}
+
+func (bundlePriceRule) Describe(d Promotion) string {
+	p := d.BundlePrice
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d for %s", p.Quantity, p.Price)
+}
+
+func (bundlePriceRule) Units(d Promotion, item *BasketItem) uint {
+	p := d.BundlePrice
+	if p == nil || p.Quantity == 0 {
+		return 0
+	}
+	return item.Quantity / p.Quantity * p.Quantity
+}
+
+func (r bundlePriceRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	p := d.BundlePrice
+	if p == nil || p.Quantity == 0 || !sameCurrency(p.Price, item) {
+		return 0, ""
+	}
+
+	// Only bundles cheaper than their units
+	if item.Product.Price.Multiply(int64(p.Quantity)).Amount > p.Price.Amount {
+		return p.Quantity - item.Quantity%p.Quantity, r.Describe(d)
+	}
+	return 0, ""
+}
+
+// ===========================================================================================
+// Tiered volume pricing
+// ===========================================================================================
+type tieredRule struct{}
+
+func (tieredRule) Validate(d Promotion) error {
+	p := d.Tiered
+	if p == nil || len(p.Tiers) == 0 {
+		return errors.New("tiered params with at least one tier are required")
+	}
+	for i, tier := range p.Tiers {
+		if tier.MinQuantity == 0 {
+			return errors.New("tier min quantity must be greater than zero")
+		}
+		if i > 0 && tier.MinQuantity <= p.Tiers[i-1].MinQuantity {
+			return errors.New("tiers must be sorted by min quantity without duplicates")
+		}
+		if tier.UnitPrice.Currency == "" {
+			return errors.New("tier unit price currency is required")
+		}
+		if tier.UnitPrice.IsNegative() {
+			return errors.New("tier unit price can't be negative")
+		}
+	}
+	return nil
+}
+
+func (tieredRule) Apply(d Promotion, item *BasketItem) Money {
+	zero := Zero(item.Product.Price.Currency)
+	if d.Tiered == nil {
+		return zero
+	}
+
+	// Highest tier reached
+	var tier *PriceTier
+	for i := range d.Tiered.Tiers {
+		if item.Quantity >= d.Tiered.Tiers[i].MinQuantity {
+			tier = &d.Tiered.Tiers[i]
+		}
+	}
+	if tier == nil || !sameCurrency(tier.UnitPrice, item) {
+		return zero
+	}
+
+	// A tier price higher than the product price doesn't apply
+	saving := item.Product.Price.Sub(tier.UnitPrice)
+	if saving.IsNegative() {
+		return zero
+	}
+
+	return saving.Multiply(int64(item.Quantity))
+}
+
+func (tieredRule) Describe(d Promotion) string {
+	if d.Tiered == nil {
+		return ""
+	}
+	tiers := make([]string, 0, len(d.Tiered.Tiers))
+	for _, tier := range d.Tiered.Tiers {
+		tiers = append(tiers, fmt.Sprintf("%s each from %d units", tier.UnitPrice, tier.MinQuantity))
+	}
+	return strings.Join(tiers, ", ")
+}
+
+func (r tieredRule) Units(d Promotion, item *BasketItem) uint {
+	if r.Apply(d, item).IsZero() {
+		return 0
+	}
+	return item.Quantity
+}
+
+func (tieredRule) NextThreshold(d Promotion, item *BasketItem) (uint, string) {
+	if d.Tiered == nil {
+		return 0, ""
+	}
+
+	// First tier not reached with a lower price than the product
+	for _, tier := range d.Tiered.Tiers {
+		if tier.MinQuantity > item.Quantity && sameCurrency(tier.UnitPrice, item) &&
+			tier.UnitPrice.Amount < item.Product.Price.Amount {
+			return tier.MinQuantity - item.Quantity, fmt.Sprintf("%s each", tier.UnitPrice)
+		}
+	}
+	return 0, ""
+}
+
+// Text for the minimum quantity of a promotion, like " buying 3 or more"
+func buyingMinimum(quantity uint) string {
+	if quantity <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" buying %d or more", quantity)
+}
+
+// Amounts in a currency other than the product's can't be applied
+func sameCurrency(amount Money, item *BasketItem) bool {
+	return amount.Currency == item.Product.Price.Currency
+}
@@ -0,0 +1,131 @@
+package entities
+
+import (
+	"sort"
+)
+
+/*
+	A product can reference several promotions. Every promotion has a priority(higher first) and
+	a stacking policy that decides how it combines with the other promotions of the product:
+
+	- exclusive(default): applies alone. If an exclusive promotion gives a discount, the exclusive
+	  promotion with the highest priority is the only one applied.
+	- stackable: applies together with the other stackable promotions. The discounts are added.
+	- best_for_customer: applies alone, but only when it's better for the customer than the
+	  stackable promotions together or any other best_for_customer promotion.
+
+	Only promotions giving a discount take part. Ties are won by the highest priority(and then
+	by ID, so the result is always the same).
+*/
+
+type StackingPolicy string
+
+const (
+	StackingExclusive       StackingPolicy = "exclusive"
+	StackingStackable       StackingPolicy = "stackable"
+	StackingBestForCustomer StackingPolicy = "best_for_customer"
+)
+
+// AppliedPromotion is a promotion that won the resolution with the discount it gives.
+type AppliedPromotion struct {
+	PromotionID string `json:"promotion_id"`
+	Description string `json:"description"`
+	Units       uint   `json:"units"` // Units the discount applies to
+	Discount    Money  `json:"discount"`
+}
+
+func (d Promotion) stackingPolicy() StackingPolicy {
+	if d.Stacking == "" {
+		return StackingExclusive
+	}
+	return d.Stacking
+}
+
+// resolvePromotions returns the discount of the combination of promotions allowed by the
+// stacking rules and the promotions applied. The discount is never greater than the item total.
+func resolvePromotions(promotions []Promotion, item *BasketItem) (Money, []AppliedPromotion) {
+	zero := Zero(item.Product.Price.Currency)
+
+	// Promotions giving a discount, by priority
+	candidates := make([]AppliedPromotion, 0, len(promotions))
+	policies := make(map[string]StackingPolicy, len(promotions))
+	for _, promotion := range sortByPriority(promotions) {
+		discount := promotion.Apply(item)
+		if discount.IsZero() || discount.IsNegative() {
+			continue
+		}
+		candidates = append(candidates, AppliedPromotion{
+			PromotionID: promotion.ID,
+			Description: promotion.Describe(),
+			Units:       promotion.Units(item),
+			Discount:    discount,
+		})
+		policies[promotion.ID] = promotion.stackingPolicy()
+	}
+
+	// Exclusive promotions win
+	for _, c := range candidates {
+		if policies[c.PromotionID] == StackingExclusive {
+			applied, discount := capDiscounts([]AppliedPromotion{c}, item.Total)
+			return discount, applied
+		}
+	}
+
+	// Best option between the stackable promotions together and every best for customer
+	// promotion. Options are built by priority, so on a tie the first one wins
+	var best []AppliedPromotion
+	bestDiscount := zero
+	stack := make([]AppliedPromotion, 0)
+	for _, c := range candidates {
+		if policies[c.PromotionID] == StackingStackable {
+			stack = append(stack, c)
+		}
+	}
+	stackAdded := false
+	for _, c := range candidates {
+		option := []AppliedPromotion{c}
+		if policies[c.PromotionID] == StackingStackable {
+			if stackAdded {
+				continue
+			}
+			option, stackAdded = stack, true
+		}
+		option, discount := capDiscounts(option, item.Total)
+		if best == nil || discount.Amount > bestDiscount.Amount {
+			best, bestDiscount = option, discount
+		}
+	}
+
+	if best == nil {
+		return zero, nil
+	}
+	return bestDiscount, best
+}
+
+// sortByPriority returns a copy of the promotions sorted by priority(higher first) and ID.
+func sortByPriority(promotions []Promotion) []Promotion {
+	sorted := append([]Promotion{}, promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// capDiscounts limits the discounts so they are not greater than the total. The last promotions
+// are reduced first.
+func capDiscounts(applied []AppliedPromotion, total Money) ([]AppliedPromotion, Money) {
+	result := make([]AppliedPromotion, 0, len(applied))
+	discount := Zero(total.Currency)
+	for _, a := range applied {
+		a.Discount = a.Discount.Min(total.Sub(discount))
+		if a.Discount.IsZero() || a.Discount.IsNegative() {
+			continue
+		}
+		discount = discount.Add(a.Discount)
+		result = append(result, a)
+	}
+	return result, discount
+}
@@ -0,0 +1,107 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBasketItem_PromotionStacking(t *testing.T) {
+	price := NewMoney(1000, DefaultCurrency)
+	percentage := func(id string, percent float64, priority int, stacking StackingPolicy) *Promotion {
+		return &Promotion{
+			ID:         id,
+			Type:       PromotionTypePercentage,
+			Percentage: &PercentageParams{Percent: percent},
+			Priority:   priority,
+			Stacking:   stacking,
+		}
+	}
+	tests := []struct {
+		name       string
+		promotions []*Promotion
+		discount   Money
+		applied    []string
+	}{
+		{"without promotions", nil, Zero(DefaultCurrency), nil},
+		{"single", []*Promotion{percentage("10OFF", 10, 0, "")}, NewMoney(200, DefaultCurrency), []string{"10OFF"}},
+		{"exclusive by priority", []*Promotion{
+			percentage("10OFF", 10, 2, StackingExclusive),
+			percentage("20OFF", 20, 1, StackingExclusive),
+		}, NewMoney(200, DefaultCurrency), []string{"10OFF"}},
+		{"exclusive same priority by id", []*Promotion{
+			percentage("B", 20, 0, ""),
+			percentage("A", 10, 0, ""),
+		}, NewMoney(200, DefaultCurrency), []string{"A"}},
+		{"exclusive beats stackable", []*Promotion{
+			percentage("10OFF", 10, 0, StackingExclusive),
+			percentage("20OFF", 20, 5, StackingStackable),
+			percentage("30OFF", 30, 5, StackingStackable),
+		}, NewMoney(200, DefaultCurrency), []string{"10OFF"}},
+		{"exclusive without discount doesn't apply", []*Promotion{
+			{ID: "3X2", RequiredItems: 3, FreeItems: 1},
+			percentage("20OFF", 20, 0, StackingStackable),
+		}, NewMoney(400, DefaultCurrency), []string{"20OFF"}},
+		{"stackable", []*Promotion{
+			percentage("10OFF", 10, 1, StackingStackable),
+			percentage("20OFF", 20, 2, StackingStackable),
+		}, NewMoney(600, DefaultCurrency), []string{"20OFF", "10OFF"}},
+		{"stackable capped to total", []*Promotion{
+			percentage("60OFF", 60, 2, StackingStackable),
+			percentage("70OFF", 70, 1, StackingStackable),
+		}, NewMoney(2000, DefaultCurrency), []string{"60OFF", "70OFF"}},
+		{"best for customer beats stack", []*Promotion{
+			percentage("10OFF", 10, 1, StackingStackable),
+			percentage("15OFF", 15, 1, StackingStackable),
+			percentage("30OFF", 30, 0, StackingBestForCustomer),
+		}, NewMoney(600, DefaultCurrency), []string{"30OFF"}},
+		{"stack beats best for customer", []*Promotion{
+			percentage("10OFF", 10, 1, StackingStackable),
+			percentage("15OFF", 15, 1, StackingStackable),
+			percentage("20OFF", 20, 0, StackingBestForCustomer),
+		}, NewMoney(500, DefaultCurrency), []string{"10OFF", "15OFF"}},
+		{"best of best for customer", []*Promotion{
+			percentage("10OFF", 10, 1, StackingBestForCustomer),
+			percentage("20OFF", 20, 0, StackingBestForCustomer),
+		}, NewMoney(400, DefaultCurrency), []string{"20OFF"}},
+		{"best for customer tie by priority", []*Promotion{
+			percentage("B", 20, 1, StackingBestForCustomer),
+			percentage("A", 20, 0, StackingBestForCustomer),
+		}, NewMoney(400, DefaultCurrency), []string{"B"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			bi := NewBasketItem(Product{ID: "PEN", Price: price}, tt.promotions...)
+
+			// When
+			bi.AddQuantity(2)
+
+			// Then
+			applied := []string(nil)
+			for _, a := range bi.AppliedPromotions {
+				applied = append(applied, a.PromotionID)
+			}
+			assert.Equal(t, tt.discount, bi.Discount)
+			assert.Equal(t, tt.applied, applied)
+		})
+	}
+}
+
+func TestBasketItem_PromotionStacking_AppliedDiscounts(t *testing.T) {
+	// Given
+	bi := NewBasketItem(Product{ID: "PEN", Price: NewMoney(1000, DefaultCurrency)},
+		&Promotion{ID: "60OFF", Type: PromotionTypePercentage, Percentage: &PercentageParams{Percent: 60},
+			Priority: 1, Stacking: StackingStackable},
+		&Promotion{ID: "70OFF", Type: PromotionTypePercentage, Percentage: &PercentageParams{Percent: 70},
+			Stacking: StackingStackable},
+	)
+
+	// When
+	bi.AddQuantity(1)
+
+	// Then: the last promotion is reduced to the remaining amount
+	assert.Equal(t, []AppliedPromotion{
+		{PromotionID: "60OFF", Description: "60% off", Units: 1, Discount: NewMoney(600, DefaultCurrency)},
+		{PromotionID: "70OFF", Description: "70% off", Units: 1, Discount: NewMoney(400, DefaultCurrency)},
+	}, bi.AppliedPromotions)
+}
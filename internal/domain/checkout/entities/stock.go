@@ -0,0 +1,113 @@
+package entities
+
+import (
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"time"
+)
+
+/*
+	Stock of a product. OnHand is the quantity in the warehouse and Reserved the quantity held by
+	open baskets, with one reservation per basket. A reservation expires some time after the
+	basket line last changed, so the stock held by abandoned baskets is available again. Expired
+	reservations are ignored and dropped the next time the stock is refreshed.
+
+	Checkout reserves every line again, so a basket whose reservation expired can still be
+	checked out while there is stock, and commits the reservation, taking it from the stock on
+	hand. Products without stock aren't limited.
+*/
+
+type Stock struct {
+	ProductID    string                      `json:"product_id"`
+	OnHand       uint                        `json:"on_hand"`
+	Reserved     uint                        `json:"reserved"`
+	Available    uint                        `json:"available"`
+	Reservations map[string]StockReservation `json:"reservations,omitempty"` // By basket ID
+}
+
+type StockReservation struct {
+	Quantity  uint      `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type StockDetail struct {
+	OnHand uint `json:"on_hand"`
+}
+
+func NewStock(productID string, onHand uint) *Stock {
+	return &Stock{
+		ProductID:    productID,
+		OnHand:       onHand,
+		Available:    onHand,
+		Reservations: make(map[string]StockReservation),
+	}
+}
+
+// Refresh drops the expired reservations and updates the reserved & available quantities.
+func (s *Stock) Refresh(now time.Time) {
+	s.Reserved = 0
+	for basketID, reservation := range s.Reservations {
+		if !now.Before(reservation.ExpiresAt) {
+			delete(s.Reservations, basketID)
+			continue
+		}
+		s.Reserved += reservation.Quantity
+	}
+
+	// The stock on hand can be lowered below the reserved quantity
+	s.Available = 0
+	if s.OnHand > s.Reserved {
+		s.Available = s.OnHand - s.Reserved
+	}
+}
+
+// Reserve sets the quantity reserved by the basket, until expiresAt. A zero quantity releases the
+// reservation. Fails if the basket needs more than the available quantity.
+func (s *Stock) Reserve(basketID string, quantity uint, now time.Time, expiresAt time.Time) error {
+	s.Refresh(now)
+
+	current := s.Reservations[basketID].Quantity
+	if quantity > current && quantity-current > s.Available {
+		err := fmt.Errorf("not enough stock of %s: %d available", s.ProductID, s.Available+current)
+		return lanaerr.New(err, http.StatusConflict)
+	}
+
+	if s.Reservations == nil {
+		s.Reservations = make(map[string]StockReservation)
+	}
+	if quantity == 0 {
+		delete(s.Reservations, basketID)
+	} else {
+		s.Reservations[basketID] = StockReservation{Quantity: quantity, ExpiresAt: expiresAt}
+	}
+
+	s.Refresh(now)
+	return nil
+}
+
+// Release drops the reservation of the basket.
+func (s *Stock) Release(basketID string, now time.Time) {
+	delete(s.Reservations, basketID)
+	s.Refresh(now)
+}
+
+// Commit takes the quantity reserved by the basket from the stock on hand.
+func (s *Stock) Commit(basketID string, now time.Time) error {
+	s.Refresh(now)
+
+	reservation, ok := s.Reservations[basketID]
+	if !ok {
+		err := fmt.Errorf("basket %s has no stock of %s reserved", basketID, s.ProductID)
+		return lanaerr.New(err, http.StatusConflict)
+	}
+	if reservation.Quantity > s.OnHand {
+		err := fmt.Errorf("not enough stock of %s: %d on hand", s.ProductID, s.OnHand)
+		return lanaerr.New(err, http.StatusConflict)
+	}
+	s.OnHand -= reservation.Quantity
+	delete(s.Reservations, basketID)
+
+	s.Refresh(now)
+	return nil
+}
@@ -0,0 +1,89 @@
+package entities
+
+import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStock_Reserve(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	stock := NewStock("PEN", 10)
+
+	// Reserve
+	assert.Nil(t, stock.Reserve("basket-1", 6, now, expiresAt))
+	assert.Equal(t, uint(6), stock.Reserved)
+	assert.Equal(t, uint(4), stock.Available)
+
+	// Not enough stock for another basket
+	err := stock.Reserve("basket-2", 5, now, expiresAt)
+	assert.EqualError(t, err, "not enough stock of PEN: 4 available")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+
+	// The basket own reservation counts as available
+	assert.Nil(t, stock.Reserve("basket-1", 10, now, expiresAt))
+	assert.Equal(t, uint(0), stock.Available)
+
+	// Lower quantity
+	assert.Nil(t, stock.Reserve("basket-1", 2, now, expiresAt))
+	assert.Equal(t, uint(2), stock.Reserved)
+
+	// Zero releases the reservation
+	assert.Nil(t, stock.Reserve("basket-1", 0, now, expiresAt))
+	assert.Equal(t, uint(0), stock.Reserved)
+	assert.Empty(t, stock.Reservations)
+}
+
+func TestStock_Expiry(t *testing.T) {
+	// Given
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	stock := NewStock("PEN", 10)
+	assert.Nil(t, stock.Reserve("abandoned", 8, now, now.Add(time.Minute)))
+	assert.Nil(t, stock.Reserve("active", 2, now, now.Add(time.Hour)))
+
+	// When
+	stock.Refresh(now.Add(time.Minute))
+
+	// Then: the abandoned basket stock is available again
+	assert.Equal(t, uint(2), stock.Reserved)
+	assert.Equal(t, uint(8), stock.Available)
+	assert.Nil(t, stock.Reserve("other", 8, now.Add(time.Minute), now.Add(time.Hour)))
+}
+
+func TestStock_Release(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	stock := NewStock("PEN", 10)
+	assert.Nil(t, stock.Reserve("basket-1", 3, now, now.Add(time.Hour)))
+
+	stock.Release("basket-1", now)
+
+	assert.Equal(t, uint(0), stock.Reserved)
+	assert.Equal(t, uint(10), stock.Available)
+}
+
+func TestStock_Commit(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	stock := NewStock("PEN", 10)
+	assert.Nil(t, stock.Reserve("basket-1", 3, now, now.Add(time.Hour)))
+
+	// Commit
+	assert.Nil(t, stock.Commit("basket-1", now))
+	assert.Equal(t, uint(7), stock.OnHand)
+	assert.Equal(t, uint(0), stock.Reserved)
+	assert.Equal(t, uint(7), stock.Available)
+
+	// Without reservation
+	err := stock.Commit("basket-1", now)
+	assert.EqualError(t, err, "basket basket-1 has no stock of PEN reserved")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+
+	// Stock on hand lowered below the reservation
+	assert.Nil(t, stock.Reserve("basket-2", 5, now, now.Add(time.Hour)))
+	stock.OnHand = 4
+	err = stock.Commit("basket-2", now)
+	assert.EqualError(t, err, "not enough stock of PEN: 4 on hand")
+	assert.Equal(t, uint(0), stock.Available)
+}
@@ -0,0 +1,224 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+	Taxes(VAT) are calculated on the amount paid for every basket line: the line total minus its
+	promotions and its share of the basket promotions and coupons. The rate depends on the tax
+	class of the product and the country of the basket.
+
+	The tax config says if prices include taxes or not:
+
+	- Tax inclusive: the amount paid is the gross amount, the net amount is obtained from it.
+	- Tax exclusive: the amount paid is the net amount, the tax is added on top of it.
+
+	Taxes are rounded per line(the total tax is the sum of the lines) or per total(the tax of
+	all the lines with the same rate is calculated and rounded once), as the jurisdiction
+	requires. Without rates there are no taxes and the basket doesn't show tax amounts.
+*/
+
+const DefaultTaxClass = "standard"
+
+type TaxRounding string
+
+const (
+	TaxRoundingLine  TaxRounding = "line"
+	TaxRoundingTotal TaxRounding = "total"
+)
+
+type TaxConfig struct {
+	Country          string                        // Default basket country
+	PricesIncludeTax bool                          // Prices are gross amounts
+	Rounding         TaxRounding                   // Line(default) or total
+	Rates            map[string]map[string]float64 // Percentage by country and tax class
+}
+
+type TaxAmounts struct {
+	Net   Money `json:"net"`
+	Tax   Money `json:"tax"`
+	Gross Money `json:"gross"`
+}
+
+// LineTax is the tax of a basket or order line.
+type LineTax struct {
+	Class string  `json:"class"`
+	Rate  float64 `json:"rate"`
+	TaxAmounts
+}
+
+func (c TaxConfig) IsEnabled() bool {
+	return len(c.Rates) > 0
+}
+
+// Validate checks the config. Every country must have the same tax classes, including the
+// default one, so any product can be sold to any country.
+func (c TaxConfig) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	switch c.Rounding {
+	case "", TaxRoundingLine, TaxRoundingTotal:
+	default:
+		return fmt.Errorf("tax rounding %s is not supported", c.Rounding)
+	}
+
+	if _, ok := c.Rates[c.Country]; !ok {
+		return fmt.Errorf("tax country %s has no rates", c.Country)
+	}
+	if _, ok := c.Rates[c.Country][DefaultTaxClass]; !ok {
+		return errors.New("tax rates require a standard class")
+	}
+
+	for country, rates := range c.Rates {
+		if len(rates) != len(c.Rates[c.Country]) {
+			return fmt.Errorf("tax country %s must have the same classes as %s", country, c.Country)
+		}
+		for class, rate := range rates {
+			if _, ok := c.Rates[c.Country][class]; !ok {
+				return fmt.Errorf("tax country %s must have the same classes as %s", country, c.Country)
+			}
+			if rate < 0 || rate > 100 {
+				return fmt.Errorf("tax rate of %s %s must be between 0 and 100", country, class)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c TaxConfig) HasCountry(country string) bool {
+	_, ok := c.Rates[country]
+	return ok
+}
+
+func (c TaxConfig) HasClass(class string) bool {
+	_, ok := c.Rates[c.Country][taxClass(class)]
+	return ok
+}
+
+// Rate returns the percentage of the tax class in the country. The default country is used if
+// none is given.
+func (c TaxConfig) Rate(country string, class string) float64 {
+	if country == "" {
+		country = c.Country
+	}
+	return c.Rates[country][taxClass(class)]
+}
+
+// calculate returns the amounts of the amount paid with the given rate.
+func (c TaxConfig) calculate(amount Money, rate float64) TaxAmounts {
+	basisPoints := int64(math.Round(rate * 100))
+	if c.PricesIncludeTax {
+		net := amount.Scale(10000, 10000+basisPoints, RoundHalfUp)
+		return TaxAmounts{Net: net, Tax: amount.Sub(net), Gross: amount}
+	}
+	tax := amount.Scale(basisPoints, 10000, RoundHalfUp)
+	return TaxAmounts{Net: amount, Tax: tax, Gross: amount.Add(tax)}
+}
+
+func (t TaxAmounts) add(o TaxAmounts) TaxAmounts {
+	return TaxAmounts{Net: t.Net.Add(o.Net), Tax: t.Tax.Add(o.Tax), Gross: t.Gross.Add(o.Gross)}
+}
+
+func taxClass(class string) string {
+	if class == "" {
+		return DefaultTaxClass
+	}
+	return class
+}
+
+// updateTaxes calculates the taxes of the basket lines and the basket. The basket total is the
+// gross amount.
+func (b *Basket) updateTaxes() {
+	b.Taxes = nil
+	if !b.TaxConfig.IsEnabled() {
+		for id, item := range b.Items {
+			item.Taxes = nil
+			b.Items[id] = item
+		}
+		return
+	}
+
+	// Amount paid for every line. Lines are sorted so the amounts split between lines are always
+	// the same
+	ids := make([]string, 0, len(b.Items))
+	for id := range b.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	paid := make(map[string]Money, len(ids))
+	for _, id := range ids {
+		paid[id] = b.Items[id].Total.Sub(b.Items[id].Discount)
+	}
+	for _, d := range b.Discounts {
+		splitDiscount(paid, d.ProductIDs, d.Amount)
+	}
+	for _, c := range b.Coupons {
+		splitDiscount(paid, ids, c.Discount)
+	}
+
+	// Line taxes
+	total := TaxAmounts{Net: Zero(b.Total.Currency), Tax: Zero(b.Total.Currency), Gross: Zero(b.Total.Currency)}
+	byRate := make(map[float64]Money)
+	for _, id := range ids {
+		item := b.Items[id]
+		rate := b.TaxConfig.Rate(b.Country, item.Product.TaxClass)
+		item.Taxes = &LineTax{
+			Class:      taxClass(item.Product.TaxClass),
+			Rate:       rate,
+			TaxAmounts: b.TaxConfig.calculate(paid[id], rate),
+		}
+		b.Items[id] = item
+		total = total.add(item.Taxes.TaxAmounts)
+		byRate[rate] = byRate[rate].Add(paid[id])
+	}
+
+	// Rounding per total: the tax of the lines with the same rate is calculated at once
+	if b.TaxConfig.Rounding == TaxRoundingTotal {
+		total = TaxAmounts{Net: Zero(b.Total.Currency), Tax: Zero(b.Total.Currency), Gross: Zero(b.Total.Currency)}
+		for rate, amount := range byRate {
+			total = total.add(b.TaxConfig.calculate(amount, rate))
+		}
+	}
+
+	b.Taxes = &total
+	b.Total = total.Gross
+}
+
+// splitDiscount subtracts the discount from the lines of the products, in proportion to the
+// amount paid for every line. The cents that can't be split are assigned to the first lines.
+func splitDiscount(paid map[string]Money, productIDs []string, discount Money) {
+	base := int64(0)
+	for _, id := range productIDs {
+		base += paid[id].Amount
+	}
+	if base <= 0 || discount.IsZero() {
+		return
+	}
+
+	remaining := discount.Amount
+	shares := make([]int64, len(productIDs))
+	for i, id := range productIDs {
+		shares[i] = discount.Amount * paid[id].Amount / base
+		remaining -= shares[i]
+	}
+	for i := range shares {
+		if remaining == 0 {
+			break
+		}
+		if shares[i] < paid[productIDs[i]].Amount {
+			shares[i]++
+			remaining--
+		}
+	}
+
+	for i, id := range productIDs {
+		paid[id] = paid[id].Sub(NewMoney(shares[i], discount.Currency))
+	}
+}
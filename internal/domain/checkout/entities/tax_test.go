@@ -0,0 +1,201 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func buildTestTaxConfig() TaxConfig {
+	return TaxConfig{
+		Country:          "ES",
+		PricesIncludeTax: true,
+		Rounding:         TaxRoundingLine,
+		Rates: map[string]map[string]float64{
+			"ES": {"standard": 21, "reduced": 10},
+			"PT": {"standard": 23, "reduced": 6},
+		},
+	}
+}
+
+func buildTaxBasket(config TaxConfig, country string, items ...*BasketItem) *Basket {
+	b := NewBasket()
+	b.TaxConfig = config
+	b.Country = country
+	for _, item := range items {
+		b.SaveItem(item)
+	}
+	return b
+}
+
+func buildTaxItem(id string, price int64, quantity uint, class string) *BasketItem {
+	item := NewBasketItem(Product{ID: id, Price: NewMoney(price, DefaultCurrency), TaxClass: class}, nil)
+	item.AddQuantity(quantity)
+	return item
+}
+
+func TestTaxConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(c *TaxConfig)
+		err    string
+	}{
+		{name: "valid", config: func(c *TaxConfig) {}},
+		{name: "disabled", config: func(c *TaxConfig) { *c = TaxConfig{} }},
+		{
+			name:   "unknown rounding",
+			config: func(c *TaxConfig) { c.Rounding = "item" },
+			err:    "tax rounding item is not supported",
+		},
+		{
+			name:   "default country without rates",
+			config: func(c *TaxConfig) { c.Country = "FR" },
+			err:    "tax country FR has no rates",
+		},
+		{
+			name:   "without standard class",
+			config: func(c *TaxConfig) { c.Rates = map[string]map[string]float64{"ES": {"reduced": 10}} },
+			err:    "tax rates require a standard class",
+		},
+		{
+			name:   "different classes",
+			config: func(c *TaxConfig) { c.Rates["PT"] = map[string]float64{"standard": 23, "other": 6} },
+			err:    "tax country PT must have the same classes as ES",
+		},
+		{
+			name:   "invalid rate",
+			config: func(c *TaxConfig) { c.Rates["PT"]["standard"] = 123 },
+			err:    "tax rate of PT standard must be between 0 and 100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := buildTestTaxConfig()
+			tt.config(&config)
+			err := config.Validate()
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBasket_Taxes_Disabled(t *testing.T) {
+	// When
+	b := buildTaxBasket(TaxConfig{}, "", buildTaxItem("PEN", 500, 2, ""))
+
+	// Then
+	assert.Nil(t, b.Taxes)
+	assert.Nil(t, b.Items["PEN"].Taxes)
+	assert.Equal(t, NewMoney(1000, DefaultCurrency), b.Total)
+}
+
+func TestBasket_Taxes_Inclusive(t *testing.T) {
+	// When
+	b := buildTaxBasket(buildTestTaxConfig(), "ES",
+		buildTaxItem("PEN", 500, 2, ""),
+		buildTaxItem("BOOK", 1100, 1, "reduced"),
+	)
+
+	// Then
+	assert.Equal(t, &LineTax{Class: "standard", Rate: 21, TaxAmounts: TaxAmounts{
+		Net:   NewMoney(826, DefaultCurrency),
+		Tax:   NewMoney(174, DefaultCurrency),
+		Gross: NewMoney(1000, DefaultCurrency),
+	}}, b.Items["PEN"].Taxes)
+	assert.Equal(t, &LineTax{Class: "reduced", Rate: 10, TaxAmounts: TaxAmounts{
+		Net:   NewMoney(1000, DefaultCurrency),
+		Tax:   NewMoney(100, DefaultCurrency),
+		Gross: NewMoney(1100, DefaultCurrency),
+	}}, b.Items["BOOK"].Taxes)
+	assert.Equal(t, &TaxAmounts{
+		Net:   NewMoney(1826, DefaultCurrency),
+		Tax:   NewMoney(274, DefaultCurrency),
+		Gross: NewMoney(2100, DefaultCurrency),
+	}, b.Taxes)
+	assert.Equal(t, NewMoney(2100, DefaultCurrency), b.Total)
+}
+
+func TestBasket_Taxes_Exclusive(t *testing.T) {
+	// Given
+	config := buildTestTaxConfig()
+	config.PricesIncludeTax = false
+
+	// When
+	b := buildTaxBasket(config, "PT", buildTaxItem("PEN", 500, 2, ""))
+
+	// Then
+	assert.Equal(t, &TaxAmounts{
+		Net:   NewMoney(1000, DefaultCurrency),
+		Tax:   NewMoney(230, DefaultCurrency),
+		Gross: NewMoney(1230, DefaultCurrency),
+	}, b.Taxes)
+	assert.Equal(t, NewMoney(1000, DefaultCurrency), b.Subtotal)
+	assert.Equal(t, NewMoney(1230, DefaultCurrency), b.Total)
+	assert.Equal(t, NewMoney(1000, DefaultCurrency), b.TotalBeforeCoupons())
+}
+
+func TestBasket_Taxes_Rounding(t *testing.T) {
+	tests := []struct {
+		name     string
+		rounding TaxRounding
+		tax      int64
+	}{
+		{name: "per line", rounding: TaxRoundingLine, tax: 51},
+		{name: "per total", rounding: TaxRoundingTotal, tax: 52},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			config := buildTestTaxConfig()
+			config.Rounding = tt.rounding
+
+			// When
+			b := buildTaxBasket(config, "ES",
+				buildTaxItem("PEN", 100, 1, ""),
+				buildTaxItem("MUG", 100, 1, ""),
+				buildTaxItem("CAP", 100, 1, ""),
+			)
+
+			// Then: every line is 0.83 + 0.17
+			for _, item := range b.Items {
+				assert.Equal(t, NewMoney(17, DefaultCurrency), item.Taxes.Tax)
+			}
+			assert.Equal(t, NewMoney(tt.tax, DefaultCurrency), b.Taxes.Tax)
+			assert.Equal(t, NewMoney(300-tt.tax, DefaultCurrency), b.Taxes.Net)
+			assert.Equal(t, NewMoney(300, DefaultCurrency), b.Taxes.Gross)
+		})
+	}
+}
+
+func TestBasket_Taxes_Discounts(t *testing.T) {
+	// Given
+	config := buildTestTaxConfig()
+	b := buildTaxBasket(config, "ES",
+		buildTaxItem("PEN", 500, 1, ""),
+		buildTaxItem("MUG", 1500, 1, "reduced"),
+	)
+
+	// When
+	b.AddCoupon(Coupon{Code: "10OFF", DiscountType: CouponDiscountPercentage, Percent: 10})
+
+	// Then: the coupon is split between the lines
+	assert.Equal(t, NewMoney(450, DefaultCurrency), b.Items["PEN"].Taxes.Gross)
+	assert.Equal(t, NewMoney(1350, DefaultCurrency), b.Items["MUG"].Taxes.Gross)
+	assert.Equal(t, NewMoney(1800, DefaultCurrency), b.Taxes.Gross)
+	assert.Equal(t, NewMoney(1800, DefaultCurrency), b.Total)
+}
+
+func TestNewOrder_Taxes(t *testing.T) {
+	// Given
+	b := buildTaxBasket(buildTestTaxConfig(), "ES", buildTaxItem("PEN", 500, 2, ""))
+
+	// When
+	order := NewOrder(*b)
+
+	// Then
+	assert.Equal(t, "ES", order.Country)
+	assert.Equal(t, b.Taxes, order.Taxes)
+	assert.Equal(t, b.Items["PEN"].Taxes, order.Items[0].Taxes)
+}
@@ -0,0 +1,141 @@
+package checkout
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
+	"log"
+	"sync"
+	"time"
+)
+
+// Open baskets not modified for BasketTTL expire. The janitor looks for idle baskets periodically
+// and expires them: the stock they reserved is released and they are deleted. Checked out baskets
+// never expire, like they can't be deleted, they're kept with their order. During BasketGrace
+// the storage still knows them, so requests for an expired basket fail with 410 Gone instead of
+// 404 Not Found and the client can tell an expired basket from a wrong ID.
+
+// BasketExpireIdle expires the baskets idle for longer than the basket TTL, returning how many
+// were expired.
+func (s *service) BasketExpireIdle(ctx context.Context) (int, error) {
+	if s.BasketTTL <= 0 {
+		return 0, nil
+	}
+
+	now := s.Clock.Now()
+	baskets, err := s.Storage.BasketListIdle(ctx, now.Add(-s.BasketTTL))
+	if err != nil {
+		return 0, err
+	}
+
+	// A basket that can't be expired(like a basket locked by a long request) doesn't stop the
+	// others, it's expired in a later run
+	expired := 0
+	for _, basket := range baskets {
+		ok, err := s.expireBasket(ctx, basket.ID, now)
+		if err != nil {
+			log.Printf("basket %s expiration error: %v", basket.ID, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+
+	// Metric
+	metrics.Counter(ctx, "basket_expired", float64(expired))
+
+	return expired, nil
+}
+
+// expireBasket expires the basket if it's still open & idle once locked.
+func (s *service) expireBasket(ctx context.Context, basketID string, now time.Time) (bool, error) {
+	// Lock basket
+	lockKey := s.getBasketLockKey(basketID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock(ctx)
+
+	// The basket could be changed, checked out or deleted since it was listed
+	basket, err := s.Storage.BasketGet(ctx, basketID)
+	if err != nil {
+		return false, nil
+	}
+	if basket.IsCheckedOut() || !basket.IdleSince().Before(now.Add(-s.BasketTTL)) {
+		return false, nil
+	}
+
+	// Release the stock reserved by the basket & expire the basket, all or nothing
+	events := s.newBasketEvents(basket)
+	events.record(entities.NewBasketExpiredEvent(basket))
+	unlockStock, err := s.lockBasketStock(ctx, basket)
+	if err != nil {
+		return false, err
+	}
+	defer unlockStock()
+	err = s.Storage.WithTx(ctx, func(tx Storage) error {
+		if err := s.releaseStock(ctx, tx, basket); err != nil {
+			return err
+		}
+		if err := tx.BasketExpire(ctx, basketID, now.Add(s.BasketGrace), lock.Token()); err != nil {
+			return err
+		}
+		return events.append(ctx, tx)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Janitor expires the idle baskets in the background.
+type Janitor struct {
+	srv      Service
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewJanitor(srv Service, interval time.Duration) *Janitor {
+	return &Janitor{
+		srv:      srv,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the janitor every interval until the context is done or Stop is called.
+func (j *Janitor) Start(ctx context.Context) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				if _, err := j.srv.BasketExpireIdle(ctx); err != nil {
+					log.Printf("basket janitor error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor and waits for a running expiration to finish.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+	j.wg.Wait()
+}
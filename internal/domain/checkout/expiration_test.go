@@ -0,0 +1,162 @@
+package checkout
+
+import (
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_service_BasketExpireIdle_Disabled(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+
+	// When
+	expired, err := st.Service.BasketExpireIdle(st.Ctx)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, expired)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketExpireIdle_ListError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.BasketTTL = time.Hour
+	st.Storage.On("BasketListIdle", st.Ctx, st.Clock.Now().Add(-time.Hour)).
+		Return([]entities.Basket{}, errors.New("list-error"))
+
+	// When
+	expired, err := st.Service.BasketExpireIdle(st.Ctx)
+
+	// Then
+	assert.EqualError(t, err, "list-error")
+	assert.Equal(t, 0, expired)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketExpireIdle_Success(t *testing.T) {
+	// Given: an idle basket and a basket modified since it was listed
+	st := buildTestDependencies()
+	st.Container.BasketTTL = time.Hour
+	st.Container.BasketGrace = 24 * time.Hour
+	idle := buildTestStockBasket("idle", 3)
+	idle.LastModifiedAt = st.Clock.Now().Add(-2 * time.Hour)
+	touched := buildTestStockBasket("touched", 1)
+	touched.LastModifiedAt = st.Clock.Now().Add(-2 * time.Hour)
+	current := *touched
+	current.LastModifiedAt = st.Clock.Now()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketListIdle", st.Ctx, st.Clock.Now().Add(-time.Hour)).
+		Return([]entities.Basket{*idle, *touched}, nil)
+	st.Storage.On("BasketGet", st.Ctx, "idle").Return(idle, nil)
+	st.Storage.On("BasketGet", st.Ctx, "touched").Return(&current, nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve("idle", 3, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		return s.Reserved == 0
+	})).Return(nil)
+	st.Storage.On("BasketExpire", st.Ctx, "idle", st.Clock.Now().Add(24*time.Hour), uint64(1)).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, "idle", mock.MatchedBy(func(events []entities.BasketEvent) bool {
+		return len(events) == 1 && events[0].Type == entities.BasketEventExpired
+	})).Return(nil)
+
+	// When
+	expired, err := st.Service.BasketExpireIdle(st.Ctx)
+
+	// Then: the stock of the idle basket is released
+	assert.Nil(t, err)
+	assert.Equal(t, 1, expired)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketExpireIdle_CheckedOut(t *testing.T) {
+	// Given: a basket checked out since it was listed
+	st := buildTestDependencies()
+	st.Container.BasketTTL = time.Hour
+	idle := buildTestStockBasket("idle", 3)
+	idle.LastModifiedAt = st.Clock.Now().Add(-2 * time.Hour)
+	checkedOut := *idle
+	checkedOut.CheckOut(&entities.Order{ID: "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11", CreatedAt: st.Clock.Now()})
+	st.Locker.On("Lock", st.Ctx, "basket-idle").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "basket-idle").Return(nil)
+	st.Storage.On("BasketListIdle", st.Ctx, st.Clock.Now().Add(-time.Hour)).Return([]entities.Basket{*idle}, nil)
+	st.Storage.On("BasketGet", st.Ctx, "idle").Return(&checkedOut, nil)
+
+	// When
+	expired, err := st.Service.BasketExpireIdle(st.Ctx)
+
+	// Then: checked out baskets never expire
+	assert.Nil(t, err)
+	assert.Equal(t, 0, expired)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketExpireIdle_BasketError(t *testing.T) {
+	// Given: a basket locked by another request, listed before an idle basket
+	st := buildTestDependencies()
+	st.Container.BasketTTL = time.Hour
+	st.Container.BasketGrace = 24 * time.Hour
+	locked := buildTestStockBasket("locked", 1)
+	locked.LastModifiedAt = st.Clock.Now().Add(-2 * time.Hour)
+	idle := buildTestStockBasket("idle", 3)
+	idle.LastModifiedAt = st.Clock.Now().Add(-2 * time.Hour)
+	lockErr := lanaerr.New(errors.New("resource basket-locked is locked"), http.StatusLocked)
+	st.Locker.On("Lock", st.Ctx, "basket-locked").Return(lockErr)
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketListIdle", st.Ctx, st.Clock.Now().Add(-time.Hour)).
+		Return([]entities.Basket{*locked, *idle}, nil)
+	st.Storage.On("BasketGet", st.Ctx, "idle").Return(idle, nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve("idle", 3, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("StockSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketExpire", st.Ctx, "idle", mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, "idle", mock.Anything).Return(nil)
+
+	// When
+	expired, err := st.Service.BasketExpireIdle(st.Ctx)
+
+	// Then: the idle basket is expired anyway, the locked one is left for a later run
+	assert.Nil(t, err)
+	assert.Equal(t, 1, expired)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func TestJanitor_StartStop(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.BasketTTL = time.Hour
+	called := make(chan struct{}, 1)
+	st.Storage.On("BasketListIdle", st.Ctx, mock.Anything).Run(func(args mock.Arguments) {
+		select {
+		case called <- struct{}{}:
+		default:
+		}
+	}).Return([]entities.Basket{}, nil)
+	janitor := NewJanitor(st.Service, time.Millisecond)
+
+	// When
+	janitor.Start(st.Ctx)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("janitor didn't run")
+	}
+	janitor.Stop()
+
+	// Then: stopping again doesn't block
+	janitor.Stop()
+	st.Storage.AssertExpectations(t)
+}
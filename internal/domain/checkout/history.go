@@ -0,0 +1,52 @@
+package checkout
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"time"
+)
+
+// Every change of a basket is recorded in its history(see entities/basketevent.go). The events of
+// a change are collected while the basket is changed and appended in the transaction saving the
+// basket, so the history always matches the saved baskets.
+
+func (s *service) BasketEventList(ctx context.Context, basketID string) ([]entities.BasketEvent, error) {
+	return s.Storage.BasketEventsGet(ctx, basketID)
+}
+
+func (s *service) BasketReplay(ctx context.Context, basketID string) (*entities.Basket, error) {
+	events, err := s.Storage.BasketEventsGet(ctx, basketID)
+	if err != nil {
+		return nil, err
+	}
+	return entities.ReplayBasket(events, s.Tax)
+}
+
+// basketEvents collects the events of a change of the basket, all occurred at the same time.
+type basketEvents struct {
+	basket *entities.Basket
+	now    time.Time
+	events []entities.BasketEvent
+}
+
+func (s *service) newBasketEvents(basket *entities.Basket) *basketEvents {
+	return &basketEvents{basket: basket, now: s.Clock.Now()}
+}
+
+func (e *basketEvents) record(event entities.BasketEvent) {
+	event.OccurredAt = e.now
+	e.events = append(e.events, event)
+}
+
+// empty tells if no change was recorded.
+func (e *basketEvents) empty() bool {
+	return len(e.events) == 0
+}
+
+// append appends the collected events to the history of the basket.
+func (e *basketEvents) append(ctx context.Context, tx Storage) error {
+	if len(e.events) == 0 {
+		return nil
+	}
+	return tx.BasketEventsAppend(ctx, e.basket.ID, e.events)
+}
@@ -0,0 +1,169 @@
+package checkout
+
+import (
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+func Test_service_BasketAddItem_RecordsEvent(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 2},
+		},
+	}, nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, basketID, mock.MatchedBy(func(events []entities.BasketEvent) bool {
+		return len(events) == 1 && events[0].Type == entities.BasketEventItemAdded &&
+			events[0].ProductID == "PEN" && events[0].Quantity == 3 &&
+			events[0].Product.Price.Equal(entities.NewMoney(500, entities.DefaultCurrency)) &&
+			events[0].Total.Equal(entities.NewMoney(2500, entities.DefaultCurrency)) &&
+			events[0].OccurredAt.Equal(st.Clock.Now())
+	})).Return(nil)
+
+	// When: the added units are recorded, not the line quantity
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 3})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_AppendEventsError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID:    basketID,
+		Items: make(map[string]entities.BasketItem),
+	}, nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, basketID, mock.Anything).Return(errors.New("append-error"))
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 3})
+
+	// Then: the basket save is rolled back with the transaction
+	assert.EqualError(t, err, "append-error")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketUpdateItems_RecordsEvents(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	withoutStock(st)
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(&entities.Basket{
+		ID: basketID,
+		Items: map[string]entities.BasketItem{
+			"PEN": {Product: entities.Product{ID: "PEN"}, Quantity: 5},
+		},
+	}, nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{
+		ID:    "MUG",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, basketID, mock.MatchedBy(func(events []entities.BasketEvent) bool {
+		return len(events) == 2 &&
+			events[0].Type == entities.BasketEventItemRemoved && events[0].Quantity == 3 &&
+			events[1].Type == entities.BasketEventItemAdded && events[1].ProductID == "MUG"
+	})).Return(nil).Once()
+	operations := []entities.ItemOperation{
+		{Op: entities.ItemOperationSet, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+		{Op: entities.ItemOperationAdd, ItemDetail: entities.ItemDetail{ProductID: "MUG", Quantity: 1}},
+	}
+
+	// When
+	err := st.Service.BasketUpdateItems(st.Ctx, basketID, operations)
+
+	// Then: all the events of the update are appended at once
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketEventList_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	events := []entities.BasketEvent{{BasketID: basketID, Sequence: 1, Type: entities.BasketEventCreated}}
+	st.Storage.On("BasketEventsGet", st.Ctx, basketID).Return(events, nil)
+
+	// When
+	sEvents, err := st.Service.BasketEventList(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, events, sEvents)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketReplay_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	pen := entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}
+	st.Storage.On("BasketEventsGet", st.Ctx, basketID).Return([]entities.BasketEvent{
+		{BasketID: basketID, Sequence: 1, Type: entities.BasketEventCreated, OccurredAt: st.Clock.Now()},
+		{BasketID: basketID, Sequence: 2, Type: entities.BasketEventItemAdded, OccurredAt: st.Clock.Now(),
+			ProductID: "PEN", Quantity: 3, Product: &pen},
+		{BasketID: basketID, Sequence: 3, Type: entities.BasketEventItemRemoved, OccurredAt: st.Clock.Now(),
+			ProductID: "PEN", Quantity: 1},
+	}, nil)
+
+	// When
+	basket, err := st.Service.BasketReplay(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, basketID, basket.ID)
+	assert.Equal(t, uint(2), basket.Items["PEN"].Quantity)
+	assert.Equal(t, entities.NewMoney(1000, entities.DefaultCurrency), basket.Total)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_BasketReplay_NotFound(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	notFound := lanaerr.New(errors.New("history of basket not found"), http.StatusNotFound)
+	st.Storage.On("BasketEventsGet", st.Ctx, basketID).Return(([]entities.BasketEvent)(nil), notFound)
+
+	// When
+	basket, err := st.Service.BasketReplay(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, basket)
+	assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+}
@@ -0,0 +1,10 @@
+package checkout
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+)
+
+func (s *service) OrderGet(ctx context.Context, orderID string) (*entities.Order, error) {
+	return s.Storage.OrderGet(ctx, orderID)
+}
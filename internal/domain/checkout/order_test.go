@@ -0,0 +1,23 @@
+package checkout
+
+import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_service_OrderGet_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	orderID := "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	st.Storage.On("OrderGet", st.Ctx, orderID).Return(&entities.Order{ID: orderID}, nil)
+
+	// When
+	order, err := st.Service.OrderGet(st.Ctx, orderID)
+
+	// Then
+	assert.NotNil(t, order)
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
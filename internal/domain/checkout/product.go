@@ -2,9 +2,20 @@ package checkout
 
 import (
 	"context"
+	"fmt"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
 )
 
+// Baskets keep a copy of the product(and its promotions) as it was when the item was added. When
+// a product is updated the baskets already holding it are not changed until more units of that
+// product are added, then the whole line is priced with the current product and promotions.
+// Promotions are an exception: baskets are always priced with their current version(see
+// priceBasket), so a promotion ended or changed applies to the baskets already holding it.
+// Deleted products remain in the baskets holding them and can be removed or checked out, but
+// no more units can be added.
+
 func (s *service) ProductList(ctx context.Context) ([]entities.Product, error) {
 	return s.Storage.ProductList(ctx)
 }
@@ -12,3 +23,139 @@ func (s *service) ProductList(ctx context.Context) ([]entities.Product, error) {
 func (s *service) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
 	return s.Storage.ProductGet(ctx, productID)
 }
+
+func (s *service) ProductCreate(ctx context.Context, product entities.Product) (*entities.Product, error) {
+	// Validate product
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkProductTaxClass(product); err != nil {
+		return nil, err
+	}
+
+	// Lock product
+	lockKey := s.getProductLockKey(product.ID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check unique ID
+	_, err = s.Storage.ProductGet(ctx, product.ID)
+	if err == nil {
+		err := fmt.Errorf("product %s already exists", product.ID)
+		return nil, lanaerr.New(err, http.StatusConflict)
+	}
+	if lanaerr.FromErr(err).GetStatusCode() != http.StatusNotFound {
+		return nil, err
+	}
+
+	// Lock & check promotions, so they stay as checked until the product is saved
+	unlockPromotions, err := s.lockPromotions(ctx, product.PromotionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPromotions()
+	if err := s.checkProductPromotions(ctx, product); err != nil {
+		return nil, err
+	}
+
+	// Save product
+	if err := s.Storage.ProductSave(ctx, &product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (s *service) ProductUpdate(ctx context.Context, productID string, product entities.Product) (*entities.Product, error) {
+	// Validate product
+	product.ID = productID
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkProductTaxClass(product); err != nil {
+		return nil, err
+	}
+
+	// Lock product
+	lockKey := s.getProductLockKey(productID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check product exists
+	if _, err := s.Storage.ProductGet(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	// Lock & check promotions, so they stay as checked until the product is saved
+	unlockPromotions, err := s.lockPromotions(ctx, product.PromotionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPromotions()
+	if err := s.checkProductPromotions(ctx, product); err != nil {
+		return nil, err
+	}
+
+	// Save product
+	if err := s.Storage.ProductSave(ctx, &product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (s *service) ProductDelete(ctx context.Context, productID string) error {
+	// Lock product
+	lockKey := s.getProductLockKey(productID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check product exists
+	if _, err := s.Storage.ProductGet(ctx, productID); err != nil {
+		return err
+	}
+
+	// Delete product
+	return s.Storage.ProductDelete(ctx, productID)
+}
+
+func (s *service) checkProductPromotions(ctx context.Context, product entities.Product) error {
+	for _, promotionID := range product.PromotionIDs {
+		promotion, err := s.Storage.PromotionGet(ctx, promotionID)
+		if err != nil && lanaerr.FromErr(err).GetStatusCode() == http.StatusNotFound {
+			// The promotion is part of the payload, so it's a bad request
+			return lanaerr.FromErr(err).WithCode(http.StatusBadRequest)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Basket level promotions apply to every basket, not to a product
+		if promotion.IsBasketLevel() {
+			err := fmt.Errorf("promotion %s is a basket promotion and can't be assigned to a product", promotion.ID)
+			return lanaerr.New(err, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+func (s *service) checkProductTaxClass(product entities.Product) error {
+	if s.Tax.IsEnabled() && !s.Tax.HasClass(product.TaxClass) {
+		err := fmt.Errorf("product %s tax class %s is not supported", product.ID, product.TaxClass)
+		return lanaerr.New(err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (s *service) getProductLockKey(productID string) string {
+	return fmt.Sprintf("product-%s", productID)
+}
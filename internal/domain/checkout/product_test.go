@@ -1,11 +1,28 @@
 package checkout
 
 import (
+	"errors"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
 	"testing"
 )
 
+func buildTestProduct() entities.Product {
+	return entities.Product{
+		ID:           "BOOK",
+		Name:         "Lana Book",
+		Price:        entities.NewMoney(1250, entities.DefaultCurrency),
+		PromotionIDs: []string{"BUY2GET1FREE"},
+	}
+}
+
+func notFound(msg string) error {
+	return lanaerr.New(errors.New(msg), http.StatusNotFound)
+}
+
 func Test_service_ProductList_Success(t *testing.T) {
 	// Given
 	st := buildTestDependencies()
@@ -36,3 +53,276 @@ func Test_service_ProductGet_Success(t *testing.T) {
 	st.Storage.AssertExpectations(t)
 	st.Locker.AssertExpectations(t)
 }
+
+func Test_service_ProductCreate_ValidationError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	product.Price = entities.NewMoney(-100, entities.DefaultCurrency)
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "product BOOK price can't be negative")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_TaxClassError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.Tax = buildTestTaxConfig()
+	product := buildTestProduct()
+	product.TaxClass = "reduced"
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "product BOOK tax class reduced is not supported")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_LockError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, "product-BOOK").Return(errors.New("lock-error"))
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "lock-error")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_AlreadyExistsError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).Return(&product, nil)
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "product BOOK already exists")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_GetProductError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).
+		Return(&entities.Product{}, errors.New("get-product-error"))
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "get-product-error")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_PromotionNotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).
+		Return(&entities.Product{}, notFound("product BOOK not found"))
+	st.Storage.On("PromotionGet", st.Ctx, product.PromotionIDs[0]).
+		Return(&entities.Promotion{}, notFound("promotion BUY2GET1FREE not found"))
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "promotion BUY2GET1FREE not found")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_BasketPromotionError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).
+		Return(&entities.Product{}, notFound("product BOOK not found"))
+	st.Storage.On("PromotionGet", st.Ctx, product.PromotionIDs[0]).Return(&entities.Promotion{
+		ID:   product.PromotionIDs[0],
+		Type: entities.PromotionTypeCrossProductBundle,
+	}, nil)
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "promotion BUY2GET1FREE is a basket promotion and can't be assigned to a product")
+	assert.Equal(t, http.StatusBadRequest, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_SaveError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).
+		Return(&entities.Product{}, notFound("product BOOK not found"))
+	st.Storage.On("PromotionGet", st.Ctx, product.PromotionIDs[0]).Return(&entities.Promotion{}, nil)
+	st.Storage.On("ProductSave", st.Ctx, &product).Return(errors.New("save-error"))
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.EqualError(t, err, "save-error")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductCreate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).
+		Return(&entities.Product{}, notFound("product BOOK not found"))
+	st.Storage.On("PromotionGet", st.Ctx, product.PromotionIDs[0]).Return(&entities.Promotion{}, nil)
+	st.Storage.On("ProductSave", st.Ctx, &product).Return(nil)
+
+	// When
+	p, err := st.Service.ProductCreate(st.Ctx, product)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, product, *p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductUpdate_LocksPromotions(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	product.PromotionIDs = []string{"BUY2GET1FREE", "10OFF"}
+	st.Locker.On("Lock", st.Ctx, "product-BOOK").Return(nil).Once()
+	st.Locker.On("Lock", st.Ctx, "promotion-10OFF").Return(nil).Once()
+	st.Locker.On("Lock", st.Ctx, "promotion-BUY2GET1FREE").Return(nil).Once()
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil).Times(3)
+	st.Storage.On("ProductGet", st.Ctx, product.ID).Return(&entities.Product{ID: product.ID}, nil)
+	st.Storage.On("PromotionGet", st.Ctx, mock.Anything).Return(&entities.Promotion{}, nil)
+	st.Storage.On("ProductSave", st.Ctx, &product).Return(nil)
+
+	// When
+	p, err := st.Service.ProductUpdate(st.Ctx, product.ID, product)
+
+	// Then: the promotions can't be deleted until the product is saved, & keep their order
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"BUY2GET1FREE", "10OFF"}, p.PromotionIDs)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductUpdate_NotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").
+		Return(&entities.Product{}, notFound("product MUG not found"))
+
+	// When
+	p, err := st.Service.ProductUpdate(st.Ctx, "MUG", product)
+
+	// Then
+	assert.EqualError(t, err, "product MUG not found")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductUpdate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	product := buildTestProduct()
+	product.PromotionIDs = nil
+	st.Locker.On("Lock", st.Ctx, "product-MUG").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "product-MUG").Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{ID: "MUG"}, nil)
+	st.Storage.On("ProductSave", st.Ctx, mock.Anything).Return(nil)
+
+	// When
+	p, err := st.Service.ProductUpdate(st.Ctx, "MUG", product)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, "MUG", p.ID)
+	assert.Equal(t, product.Price, p.Price)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductDelete_NotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, "product-MUG").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "product-MUG").Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").
+		Return(&entities.Product{}, notFound("product MUG not found"))
+
+	// When
+	err := st.Service.ProductDelete(st.Ctx, "MUG")
+
+	// Then
+	assert.EqualError(t, err, "product MUG not found")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductDelete_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, "product-MUG").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "product-MUG").Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "MUG").Return(&entities.Product{ID: "MUG"}, nil)
+	st.Storage.On("ProductDelete", st.Ctx, "MUG").Return(nil)
+
+	// When
+	err := st.Service.ProductDelete(st.Ctx, "MUG")
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
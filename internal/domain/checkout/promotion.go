@@ -0,0 +1,158 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"sort"
+)
+
+func (s *service) PromotionList(ctx context.Context) ([]entities.Promotion, error) {
+	return s.Storage.PromotionList(ctx)
+}
+
+func (s *service) PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error) {
+	return s.Storage.PromotionGet(ctx, promotionID)
+}
+
+func (s *service) PromotionCreate(ctx context.Context, promotion entities.Promotion) (*entities.Promotion, error) {
+	// Validate promotion
+	if err := promotion.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Lock promotion
+	lockKey := s.getPromotionLockKey(promotion.ID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check unique ID
+	_, err = s.Storage.PromotionGet(ctx, promotion.ID)
+	if err == nil {
+		err := fmt.Errorf("promotion %s already exists", promotion.ID)
+		return nil, lanaerr.New(err, http.StatusConflict)
+	}
+	if lanaerr.FromErr(err).GetStatusCode() != http.StatusNotFound {
+		return nil, err
+	}
+
+	// Save promotion
+	if err := s.Storage.PromotionSave(ctx, &promotion); err != nil {
+		return nil, err
+	}
+
+	return &promotion, nil
+}
+
+func (s *service) PromotionUpdate(ctx context.Context, promotionID string, promotion entities.Promotion) (*entities.Promotion, error) {
+	// Validate promotion
+	promotion.ID = promotionID
+	if err := promotion.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Lock promotion
+	lockKey := s.getPromotionLockKey(promotionID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check promotion exists
+	if _, err := s.Storage.PromotionGet(ctx, promotionID); err != nil {
+		return nil, err
+	}
+
+	// Basket level promotions can't be assigned to products, see checkProductPromotions
+	if promotion.IsBasketLevel() {
+		if err := s.checkPromotionUnused(ctx, promotionID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Save promotion
+	if err := s.Storage.PromotionSave(ctx, &promotion); err != nil {
+		return nil, err
+	}
+
+	return &promotion, nil
+}
+
+func (s *service) PromotionDelete(ctx context.Context, promotionID string) error {
+	// Lock promotion
+	lockKey := s.getPromotionLockKey(promotionID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check promotion exists
+	if _, err := s.Storage.PromotionGet(ctx, promotionID); err != nil {
+		return err
+	}
+
+	// Products referencing the promotion must be updated first
+	if err := s.checkPromotionUnused(ctx, promotionID); err != nil {
+		return err
+	}
+
+	// Delete promotion
+	return s.Storage.PromotionDelete(ctx, promotionID)
+}
+
+// checkPromotionUnused checks no product references the promotion. Must be called holding the
+// promotion lock, product writes take it to check their promotions(see lockPromotions).
+func (s *service) checkPromotionUnused(ctx context.Context, promotionID string) error {
+	products, err := s.Storage.ProductList(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		if p.HasPromotion(promotionID) {
+			err := fmt.Errorf("promotion %s is used by product %s", promotionID, p.ID)
+			return lanaerr.New(err, http.StatusConflict)
+		}
+	}
+	return nil
+}
+
+// lockPromotions locks the promotions, always in the same order, so they aren't deleted or
+// changed while a product referencing them is saved. The returned unlock function must be called
+// once the product is saved.
+func (s *service) lockPromotions(ctx context.Context, promotionIDs []string) (func(), error) {
+	locks := make([]Lock, 0, len(promotionIDs))
+	unlock := func() {
+		for _, lock := range locks {
+			lock.Unlock(ctx)
+		}
+	}
+
+	// Sort a copy, the order of the product promotions is kept
+	sorted := append([]string{}, promotionIDs...)
+	sort.Strings(sorted)
+	for i, promotionID := range sorted {
+		if i > 0 && sorted[i-1] == promotionID {
+			continue
+		}
+		lockKey := s.getPromotionLockKey(promotionID)
+		lock, err := s.Locker.Lock(ctx, lockKey)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return unlock, nil
+}
+
+func (s *service) getPromotionLockKey(promotionID string) string {
+	return fmt.Sprintf("promotion-%s", promotionID)
+}
@@ -0,0 +1,255 @@
+package checkout
+
+import (
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+func Test_service_PromotionList_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	promotions, err := st.Service.PromotionList(st.Ctx)
+
+	// Then
+	assert.NotNil(t, promotions)
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionGet_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{ID: "2X1"}, nil)
+
+	// When
+	promotion, err := st.Service.PromotionGet(st.Ctx, "2X1")
+
+	// Then
+	assert.NotNil(t, promotion)
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionCreate_ValidationError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{ID: "2X1", FreeItems: 1}
+
+	// When
+	p, err := st.Service.PromotionCreate(st.Ctx, promotion)
+
+	// Then
+	assert.EqualError(t, err, "promotion 2X1 required items must be greater than zero when free items are set")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionCreate_LockError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, "promotion-2X1").Return(errors.New("lock-error"))
+
+	// When
+	p, err := st.Service.PromotionCreate(st.Ctx, promotion)
+
+	// Then
+	assert.EqualError(t, err, "lock-error")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionCreate_AlreadyExistsError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).Return(&promotion, nil)
+
+	// When
+	p, err := st.Service.PromotionCreate(st.Ctx, promotion)
+
+	// Then
+	assert.EqualError(t, err, "promotion 2X1 already exists")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionCreate_SaveError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).
+		Return(&entities.Promotion{}, notFound("promotion 2X1 not found"))
+	st.Storage.On("PromotionSave", st.Ctx, &promotion).Return(errors.New("save-error"))
+
+	// When
+	p, err := st.Service.PromotionCreate(st.Ctx, promotion)
+
+	// Then
+	assert.EqualError(t, err, "save-error")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionCreate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{ID: "2X1", RequiredItems: 2, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, promotion.ID).
+		Return(&entities.Promotion{}, notFound("promotion 2X1 not found"))
+	st.Storage.On("PromotionSave", st.Ctx, &promotion).Return(nil)
+
+	// When
+	p, err := st.Service.PromotionCreate(st.Ctx, promotion)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, promotion, *p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionUpdate_NotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{RequiredItems: 2, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").
+		Return(&entities.Promotion{}, notFound("promotion 2X1 not found"))
+
+	// When
+	p, err := st.Service.PromotionUpdate(st.Ctx, "2X1", promotion)
+
+	// Then
+	assert.EqualError(t, err, "promotion 2X1 not found")
+	assert.Nil(t, p)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionUpdate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{RequiredItems: 3, FreeItems: 1}
+	st.Locker.On("Lock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{ID: "2X1"}, nil)
+	st.Storage.On("PromotionSave", st.Ctx, mock.Anything).Return(nil)
+
+	// When
+	p, err := st.Service.PromotionUpdate(st.Ctx, "2X1", promotion)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, "2X1", p.ID)
+	assert.Equal(t, uint(3), p.RequiredItems)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionUpdate_BasketLevelInUseError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotion := entities.Promotion{
+		Type: entities.PromotionTypeCrossProductBundle,
+		CrossProductBundle: &entities.CrossProductBundleParams{
+			Items:    []entities.BundleItem{{ProductID: "PEN", Quantity: 1}, {ProductID: "MUG", Quantity: 1}},
+			Discount: entities.NewMoney(200, entities.DefaultCurrency),
+		},
+	}
+	st.Locker.On("Lock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{ID: "2X1"}, nil)
+	st.Storage.On("ProductList", st.Ctx).Return([]entities.Product{
+		{ID: "PEN", PromotionIDs: []string{"2X1"}},
+	}, nil)
+
+	// When
+	p, err := st.Service.PromotionUpdate(st.Ctx, "2X1", promotion)
+
+	// Then
+	assert.Nil(t, p)
+	assert.EqualError(t, err, "promotion 2X1 is used by product PEN")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionDelete_InUseError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	promotionID := "2X1"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, promotionID).Return(&entities.Promotion{ID: promotionID}, nil)
+	st.Storage.On("ProductList", st.Ctx).Return([]entities.Product{
+		{ID: "MUG"},
+		{ID: "PEN", PromotionIDs: []string{promotionID}},
+	}, nil)
+
+	// When
+	err := st.Service.PromotionDelete(st.Ctx, promotionID)
+
+	// Then
+	assert.EqualError(t, err, "promotion 2X1 is used by product PEN")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionDelete_ProductListError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{ID: "2X1"}, nil)
+	st.Storage.On("ProductList", st.Ctx).Return([]entities.Product{}, errors.New("list-error"))
+
+	// When
+	err := st.Service.PromotionDelete(st.Ctx, "2X1")
+
+	// Then
+	assert.EqualError(t, err, "list-error")
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_PromotionDelete_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "promotion-2X1").Return(nil)
+	st.Storage.On("PromotionGet", st.Ctx, "2X1").Return(&entities.Promotion{ID: "2X1"}, nil)
+	st.Storage.On("ProductList", st.Ctx).Return([]entities.Product{{ID: "MUG"}}, nil)
+	st.Storage.On("PromotionDelete", st.Ctx, "2X1").Return(nil)
+
+	// When
+	err := st.Service.PromotionDelete(st.Ctx, "2X1")
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
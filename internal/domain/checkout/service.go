@@ -14,15 +14,43 @@ import (
 
 type Service interface {
 	// Basket
-	BasketCreate(ctx context.Context) (*entities.Basket, error)
+	BasketCreate(ctx context.Context, basketDetail entities.BasketDetail) (*entities.Basket, error)
 	BasketGet(ctx context.Context, basketID string) (*entities.Basket, error)
 	BasketDelete(ctx context.Context, basketID string) error
 	BasketAddItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error
 	BasketRemoveItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error
+	BasketSetItemQuantity(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error
+	BasketUpdateItems(ctx context.Context, basketID string, operations []entities.ItemOperation) error
+	BasketCheckout(ctx context.Context, basketID string) (*entities.Order, error)
+	BasketApplyCoupon(ctx context.Context, basketID string, couponDetail entities.CouponDetail) error
+	BasketRemoveCoupon(ctx context.Context, basketID string, code string) error
+	BasketExpireIdle(ctx context.Context) (int, error)
+	BasketEventList(ctx context.Context, basketID string) ([]entities.BasketEvent, error)
+	BasketReplay(ctx context.Context, basketID string) (*entities.Basket, error)
 
 	// Product
 	ProductList(ctx context.Context) ([]entities.Product, error)
 	ProductGet(ctx context.Context, productCode string) (*entities.Product, error)
+	ProductCreate(ctx context.Context, product entities.Product) (*entities.Product, error)
+	ProductUpdate(ctx context.Context, productID string, product entities.Product) (*entities.Product, error)
+	ProductDelete(ctx context.Context, productID string) error
+	ProductStockGet(ctx context.Context, productID string) (*entities.Stock, error)
+	ProductStockUpdate(ctx context.Context, productID string, stockDetail entities.StockDetail) (*entities.Stock, error)
+
+	// Promotion
+	PromotionList(ctx context.Context) ([]entities.Promotion, error)
+	PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error)
+	PromotionCreate(ctx context.Context, promotion entities.Promotion) (*entities.Promotion, error)
+	PromotionUpdate(ctx context.Context, promotionID string, promotion entities.Promotion) (*entities.Promotion, error)
+	PromotionDelete(ctx context.Context, promotionID string) error
+
+	// Coupon
+	CouponGet(ctx context.Context, code string) (*entities.Coupon, error)
+	CouponCreate(ctx context.Context, coupon entities.Coupon) (*entities.Coupon, error)
+	CouponUpdate(ctx context.Context, code string, coupon entities.Coupon) (*entities.Coupon, error)
+
+	// Order
+	OrderGet(ctx context.Context, orderID string) (*entities.Order, error)
 }
 
 type service struct {
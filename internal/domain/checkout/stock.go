@@ -0,0 +1,199 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Baskets reserve the stock of their lines when items are added or removed, and release it when
+// they are deleted. The reservation of a line expires ReservationTTL after its last change, so
+// the stock held by abandoned baskets is available again. Checkout reserves every line again and
+// commits the reservations once the order is saved.
+
+const defaultReservationTTL = 30 * time.Minute
+
+func (s *service) ProductStockGet(ctx context.Context, productID string) (*entities.Stock, error) {
+	stock, err := s.Storage.StockGet(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	stock.Refresh(s.Clock.Now())
+	return stock, nil
+}
+
+func (s *service) ProductStockUpdate(ctx context.Context, productID string, stockDetail entities.StockDetail) (*entities.Stock, error) {
+	// Lock stock
+	lockKey := s.getStockLockKey(productID)
+	lock, err := s.Locker.Lock(ctx, lockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock(ctx)
+
+	// Check product exists
+	if _, err := s.Storage.ProductGet(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	// Current stock, keeping its reservations
+	stock, err := s.Storage.StockGet(ctx, productID)
+	if lanaerr.FromErr(err).GetStatusCode() == http.StatusNotFound {
+		stock, err = entities.NewStock(productID, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Save stock
+	stock.OnHand = stockDetail.OnHand
+	stock.Refresh(s.Clock.Now())
+	if err := s.Storage.StockSave(ctx, stock); err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// reserveStock sets the quantity of the product reserved by the basket. A zero quantity releases
+// the reservation. Products without stock aren't limited. The stock must be locked with
+// lockProductsStock, before the transaction so it isn't held while waiting for the lock.
+func (s *service) reserveStock(ctx context.Context, tx Storage, basketID string, productID string, quantity uint) error {
+	stock, err := tx.StockGet(ctx, productID)
+	if lanaerr.FromErr(err).GetStatusCode() == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := s.Clock.Now()
+	if err := stock.Reserve(basketID, quantity, now, now.Add(s.reservationTTL())); err != nil {
+		return err
+	}
+	return tx.StockSave(ctx, stock)
+}
+
+// reserveItemStock reserves the quantity of the product in the basket, releasing the stock of
+// a removed line.
+func (s *service) reserveItemStock(ctx context.Context, tx Storage, basket *entities.Basket, productID string) error {
+	quantity := uint(0)
+	if item := basket.GetItem(productID); item != nil {
+		quantity = item.Quantity
+	}
+	return s.reserveStock(ctx, tx, basket.ID, productID, quantity)
+}
+
+// reserveItemsStock reserves the quantity in the basket of the given products. If a reservation
+// fails the product is returned, the reservations already made are rolled back with the
+// transaction.
+func (s *service) reserveItemsStock(ctx context.Context, tx Storage, basket *entities.Basket, productIDs []string) (string, error) {
+	for _, productID := range productIDs {
+		if err := s.reserveItemStock(ctx, tx, basket, productID); err != nil {
+			return productID, err
+		}
+	}
+	return "", nil
+}
+
+// releaseStock releases the stock reserved by every line of the basket, whose stock must be locked.
+func (s *service) releaseStock(ctx context.Context, tx Storage, basket *entities.Basket) error {
+	for productID := range basket.Items {
+		if err := s.reserveStock(ctx, tx, basket.ID, productID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockProductsStock locks the stock of the products, always in the same order. The returned
+// unlock function must be called once the stock is saved.
+func (s *service) lockProductsStock(ctx context.Context, productIDs []string) (func(), error) {
+	locks := make([]Lock, 0, len(productIDs))
+	unlock := func() {
+		for _, lock := range locks {
+			lock.Unlock(ctx)
+		}
+	}
+
+	sort.Strings(productIDs)
+	for _, productID := range productIDs {
+		lockKey := s.getStockLockKey(productID)
+		lock, err := s.Locker.Lock(ctx, lockKey)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return unlock, nil
+}
+
+// lockBasketStock locks the stock of every line of the basket, see lockProductsStock.
+func (s *service) lockBasketStock(ctx context.Context, basket *entities.Basket) (func(), error) {
+	productIDs := make([]string, 0, len(basket.Items))
+	for productID := range basket.Items {
+		productIDs = append(productIDs, productID)
+	}
+	return s.lockProductsStock(ctx, productIDs)
+}
+
+// lockStock locks the stock of every line of the basket and takes the lines from the stock on
+// hand, without saving it. The returned unlock function must be called once the stock is saved.
+func (s *service) lockStock(ctx context.Context, basket *entities.Basket) ([]*entities.Stock, func(), error) {
+	unlock, err := s.lockBasketStock(ctx, basket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stocks := make([]*entities.Stock, 0, len(basket.Items))
+	now := s.Clock.Now()
+	for productID, item := range basket.Items {
+		// Reserve the line again, the reservation could be expired
+		stock, err := s.Storage.StockGet(ctx, productID)
+		if lanaerr.FromErr(err).GetStatusCode() == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		if err := stock.Reserve(basket.ID, item.Quantity, now, now.Add(s.reservationTTL())); err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		if err := stock.Commit(basket.ID, now); err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		stocks = append(stocks, stock)
+	}
+
+	return stocks, unlock, nil
+}
+
+// commitStock saves the stock committed by lockStock.
+func (s *service) commitStock(ctx context.Context, tx Storage, stocks []*entities.Stock) error {
+	for _, stock := range stocks {
+		if err := tx.StockSave(ctx, stock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) reservationTTL() time.Duration {
+	if s.ReservationTTL <= 0 {
+		return defaultReservationTTL
+	}
+	return s.ReservationTTL
+}
+
+func (s *service) getStockLockKey(productID string) string {
+	return fmt.Sprintf("stock-%s", productID)
+}
@@ -0,0 +1,213 @@
+package checkout
+
+import (
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func buildTestStockBasket(basketID string, quantity uint) *entities.Basket {
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)})
+	item.AddQuantity(quantity)
+	basket.SaveItem(item)
+	return basket
+}
+
+func Test_service_BasketAddItem_StockReserved(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Container.ReservationTTL = 10 * time.Minute
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 2), nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(entities.NewStock("PEN", 10), nil)
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		reservation := s.Reservations[basketID]
+		return reservation.Quantity == 5 && reservation.ExpiresAt.Equal(st.Clock.Now().Add(10*time.Minute))
+	})).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 3})
+
+	// Then: the whole line is reserved
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketAddItem_NotEnoughStockError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 0), nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{
+		ID:    "PEN",
+		Price: entities.NewMoney(500, entities.DefaultCurrency),
+	}, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve("other-basket", 8, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+
+	// When
+	err := st.Service.BasketAddItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 3})
+
+	// Then
+	assert.EqualError(t, err, "not enough stock of PEN: 2 available")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketRemoveItem_StockReleased(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 5), nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve(basketID, 5, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		return s.Reserved == 0 && s.Available == 10
+	})).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+
+	// When
+	err := st.Service.BasketRemoveItem(st.Ctx, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 5})
+
+	// Then
+	assert.Nil(t, err)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_StockCommitted(t *testing.T) {
+	// Given: the reservation of the basket is expired
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Refresh", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 4), nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve(basketID, 4, st.Clock.Now().Add(-time.Hour), st.Clock.Now())
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("OrderSave", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("StockSave", st.Ctx, mock.MatchedBy(func(s *entities.Stock) bool {
+		return s.OnHand == 6 && s.Reserved == 0 && len(s.Reservations) == 0
+	})).Return(nil)
+	st.Storage.On("BasketSave", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("BasketEventsAppend", st.Ctx, mock.Anything, mock.Anything).Return(nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.NotNil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_BasketCheckout_NotEnoughStockError(t *testing.T) {
+	// Given: the stock held by the expired reservation was taken by another basket
+	st := buildTestDependencies()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	st.Locker.On("Lock", st.Ctx, mock.Anything).Return(nil)
+	st.Locker.On("Unlock", st.Ctx, mock.Anything).Return(nil)
+	st.Storage.On("BasketGet", st.Ctx, basketID).Return(buildTestStockBasket(basketID, 4), nil)
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve(basketID, 4, st.Clock.Now().Add(-time.Hour), st.Clock.Now())
+	stock.Reserve("other-basket", 8, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+	st.Storage.On("PromotionList", st.Ctx).Return([]entities.Promotion{}, nil)
+
+	// When
+	order, err := st.Service.BasketCheckout(st.Ctx, basketID)
+
+	// Then: no order is saved
+	assert.EqualError(t, err, "not enough stock of PEN: 2 available")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+	assert.Nil(t, order)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductStockGet_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	stock := entities.NewStock("PEN", 10)
+	stock.Reserve("basket", 4, st.Clock.Now().Add(-time.Hour), st.Clock.Now())
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(stock, nil)
+
+	// When
+	sStock, err := st.Service.ProductStockGet(st.Ctx, "PEN")
+
+	// Then: expired reservations aren't reserved
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), sStock.Reserved)
+	assert.Equal(t, uint(10), sStock.Available)
+	st.Storage.AssertExpectations(t)
+}
+
+func Test_service_ProductStockUpdate_ProductNotFoundError(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, "stock-PEN").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "stock-PEN").Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return((*entities.Product)(nil), errors.New("product-error"))
+
+	// When
+	stock, err := st.Service.ProductStockUpdate(st.Ctx, "PEN", entities.StockDetail{OnHand: 20})
+
+	// Then
+	assert.EqualError(t, err, "product-error")
+	assert.Nil(t, stock)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
+
+func Test_service_ProductStockUpdate_Success(t *testing.T) {
+	// Given
+	st := buildTestDependencies()
+	st.Locker.On("Lock", st.Ctx, "stock-PEN").Return(nil)
+	st.Locker.On("Unlock", st.Ctx, "stock-PEN").Return(nil)
+	st.Storage.On("ProductGet", st.Ctx, "PEN").Return(&entities.Product{ID: "PEN"}, nil)
+	current := entities.NewStock("PEN", 10)
+	current.Reserve("basket", 4, st.Clock.Now(), st.Clock.Now().Add(time.Hour))
+	st.Storage.On("StockGet", st.Ctx, "PEN").Return(current, nil)
+	st.Storage.On("StockSave", st.Ctx, mock.Anything).Return(nil)
+
+	// When
+	stock, err := st.Service.ProductStockUpdate(st.Ctx, "PEN", entities.StockDetail{OnHand: 20})
+
+	// Then: reservations are kept
+	assert.Nil(t, err)
+	assert.Equal(t, uint(20), stock.OnHand)
+	assert.Equal(t, uint(4), stock.Reserved)
+	assert.Equal(t, uint(16), stock.Available)
+	st.Storage.AssertExpectations(t)
+	st.Locker.AssertExpectations(t)
+}
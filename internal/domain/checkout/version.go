@@ -0,0 +1,49 @@
+package checkout
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+)
+
+// Every save of a basket increments its version, and the storage only saves a basket whose
+// version is still the stored one. Clients can send the versions they expect in the context, the
+// changes to a basket fail with 412 Precondition Failed if it's in another version, so edits made
+// on a stale view of the basket aren't applied.
+
+type ctxKey string
+
+const ctxKeyBasketVersions ctxKey = "basket-versions"
+
+// WithBasketVersions returns a context where the basket changes require the basket to be in one
+// of the given versions.
+func WithBasketVersions(ctx context.Context, versions []uint64) context.Context {
+	return context.WithValue(ctx, ctxKeyBasketVersions, versions)
+}
+
+// checkBasketMissing fails if the context requires a version of the basket that isn't found, a
+// missing basket isn't in any version.
+func (s *service) checkBasketMissing(ctx context.Context, basketID string) error {
+	if _, ok := ctx.Value(ctxKeyBasketVersions).([]uint64); !ok {
+		return nil
+	}
+	err := fmt.Errorf("basket %s not found, it isn't in the required version", basketID)
+	return lanaerr.New(err, http.StatusPreconditionFailed)
+}
+
+// checkBasketVersion checks the basket is in one of the versions of the context, if any.
+func (s *service) checkBasketVersion(ctx context.Context, basket *entities.Basket) error {
+	versions, ok := ctx.Value(ctxKeyBasketVersions).([]uint64)
+	if !ok {
+		return nil
+	}
+	for _, version := range versions {
+		if version == basket.Version {
+			return nil
+		}
+	}
+	err := fmt.Errorf("basket %s was modified, current version is %d", basket.ID, basket.Version)
+	return lanaerr.New(err, http.StatusPreconditionFailed)
+}
@@ -0,0 +1,17 @@
+package clock
+
+import "time"
+
+// NOTE: The domain never calls time.Now() directly, it asks the clock of the container. This way
+// time dependent rules(like promotions time windows or coupon expiry) can be tested with a fixed
+// time.
+
+func NewClock() *clock {
+	return &clock{}
+}
+
+type clock struct{}
+
+func (c *clock) Now() time.Time {
+	return time.Now()
+}
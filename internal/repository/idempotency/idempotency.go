@@ -0,0 +1,132 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NOTE: This is an in memory store of the responses to requests sent with an idempotency key.
+// Like the in memory lock, it only works with one instance. With multiple instances the
+// responses should be stored in a shared store like Redis, with the window as the TTL of keys.
+
+const (
+	defaultWindow        = 24 * time.Hour
+	defaultPurgeInterval = time.Minute
+)
+
+// Response is a stored response, replayed for the repeated requests.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func NewStore(ctx context.Context, window time.Duration) *store {
+	if window <= 0 {
+		window = defaultWindow
+	}
+	s := &store{
+		window:  window,
+		records: make(map[string]record, 0),
+	}
+
+	// The records out of the window are purged in the background, not on every request
+	interval := defaultPurgeInterval
+	if window < interval {
+		interval = window
+	}
+	go s.purgeLoop(ctx, interval)
+
+	return s
+}
+
+type store struct {
+	window  time.Duration
+	records map[string]record
+	mutex   sync.Mutex
+}
+
+type record struct {
+	Fingerprint string
+	Response    *Response // Nil while the first request is running
+	ExpiresAt   time.Time
+}
+
+// Start begins the request with the key. The response of a previous request with the key is
+// returned to be replayed, otherwise the request must run and be finished with Finish or Cancel.
+// Reusing a key for a request with another fingerprint fails with 422 Unprocessable Entity, and
+// repeating a request that is still running fails with 409 Conflict.
+func (s *store) Start(ctx context.Context, key string, fingerprint string) (*Response, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// A record out of the window that isn't purged yet is ignored
+	now := time.Now()
+	if rec, ok := s.records[key]; ok && now.Before(rec.ExpiresAt) {
+		if rec.Fingerprint != fingerprint {
+			err := errors.New("idempotency key already used for a different request")
+			return nil, lanaerr.New(err, http.StatusUnprocessableEntity)
+		}
+		if rec.Response == nil {
+			err := errors.New("a request with the same idempotency key is in progress")
+			return nil, lanaerr.New(err, http.StatusConflict)
+		}
+		return rec.Response, nil
+	}
+
+	// A running request is kept for the window too, it's released by Finish or Cancel
+	s.records[key] = record{Fingerprint: fingerprint, ExpiresAt: now.Add(s.window)}
+	return nil, nil
+}
+
+// Finish stores the response of the request with the key, replayed during the window.
+func (s *store) Finish(ctx context.Context, key string, response *Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return
+	}
+	rec.Response = response
+	rec.ExpiresAt = time.Now().Add(s.window)
+	s.records[key] = rec
+}
+
+// Cancel forgets the request with the key, so it can be sent again.
+func (s *store) Cancel(ctx context.Context, key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.records, key)
+}
+
+func (s *store) purgeLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.purge(now)
+		}
+	}
+}
+
+// purge removes the records out of the window.
+func (s *store) purge(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
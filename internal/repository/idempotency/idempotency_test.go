@@ -0,0 +1,111 @@
+package idempotency_test
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/idempotency"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_store_Start_Replay(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	s := idempotency.NewStore(ctx, time.Hour)
+	response := &idempotency.Response{StatusCode: http.StatusOK, Body: []byte("done")}
+
+	// When
+	first, err := s.Start(ctx, "key", "fingerprint")
+	s.Finish(ctx, "key", response)
+	replayed, errReplay := s.Start(ctx, "key", "fingerprint")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, first)
+	assert.Nil(t, errReplay)
+	assert.Equal(t, response, replayed)
+}
+
+func Test_store_Start_InProgressError(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	s := idempotency.NewStore(ctx, time.Hour)
+
+	// When
+	_, err := s.Start(ctx, "key", "fingerprint")
+	_, errRepeat := s.Start(ctx, "key", "fingerprint")
+
+	// Then
+	assert.Nil(t, err)
+	assert.EqualError(t, errRepeat, "a request with the same idempotency key is in progress")
+	assert.Equal(t, http.StatusConflict, lanaerr.FromErr(errRepeat).GetStatusCode())
+}
+
+func Test_store_Start_FingerprintError(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	s := idempotency.NewStore(ctx, time.Hour)
+
+	// When
+	_, err := s.Start(ctx, "key", "fingerprint")
+	s.Finish(ctx, "key", &idempotency.Response{StatusCode: http.StatusOK})
+	_, errOther := s.Start(ctx, "key", "other-fingerprint")
+
+	// Then
+	assert.Nil(t, err)
+	assert.EqualError(t, errOther, "idempotency key already used for a different request")
+	assert.Equal(t, http.StatusUnprocessableEntity, lanaerr.FromErr(errOther).GetStatusCode())
+}
+
+func Test_store_Cancel(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	s := idempotency.NewStore(ctx, time.Hour)
+
+	// When
+	_, err := s.Start(ctx, "key", "fingerprint")
+	s.Cancel(ctx, "key")
+	response, errRetry := s.Start(ctx, "key", "other-fingerprint")
+
+	// Then: the key can be used again
+	assert.Nil(t, err)
+	assert.Nil(t, errRetry)
+	assert.Nil(t, response)
+}
+
+func Test_store_Start_Expired(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	s := idempotency.NewStore(ctx, 10*time.Millisecond)
+
+	// When
+	_, err := s.Start(ctx, "key", "fingerprint")
+	s.Finish(ctx, "key", &idempotency.Response{StatusCode: http.StatusOK})
+	time.Sleep(20 * time.Millisecond) // Let the response expire
+	response, errAgain := s.Start(ctx, "key", "fingerprint")
+
+	// Then: the request runs again
+	assert.Nil(t, err)
+	assert.Nil(t, errAgain)
+	assert.Nil(t, response)
+}
+
+func Test_store_Start_ExpiredDifferentRequest(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := idempotency.NewStore(ctx, 10*time.Millisecond)
+
+	// When
+	_, err := s.Start(ctx, "key", "fingerprint")
+	s.Finish(ctx, "key", &idempotency.Response{StatusCode: http.StatusOK})
+	time.Sleep(20 * time.Millisecond) // Let the response expire
+	response, errAgain := s.Start(ctx, "key", "other-fingerprint")
+
+	// Then: the key can be used for another request
+	assert.Nil(t, err)
+	assert.Nil(t, errAgain)
+	assert.Nil(t, response)
+}
@@ -0,0 +1,117 @@
+package locker
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// A locked resource is tried again after a wait that grows exponentially, with some jitter so
+// the requests waiting for the same resource don't retry at the same time. After the backoff
+// MaxWait the lock fails with a LockedError(423 Locked). If the context is done first, the lock
+// fails with the context error, as the request was cancelled or timed out. The time waited for
+// locks and the contention are recorded as metrics.
+
+var DefaultBackoff = Backoff{
+	Initial:    50 * time.Millisecond,
+	Max:        500 * time.Millisecond,
+	Multiplier: 2,
+	Jitter:     0.2,
+	MaxWait:    time.Second,
+}
+
+// Backoff is the wait between the attempts to lock a resource: it starts at Initial and is
+// multiplied by Multiplier up to Max, randomized by +-Jitter(a fraction of the wait). No more
+// attempts are made after MaxWait. Zero values are taken from DefaultBackoff.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+	MaxWait    time.Duration
+}
+
+// LockedError is the error of a resource still locked by another owner when the wait is over.
+type LockedError struct {
+	Resource string
+}
+
+func (e LockedError) Error() string {
+	return fmt.Sprintf("the resource '%s' is locked", e.Resource)
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	if b.Jitter <= 0 || b.Jitter > 1 {
+		b.Jitter = DefaultBackoff.Jitter
+	}
+	if b.MaxWait <= 0 {
+		b.MaxWait = DefaultBackoff.MaxWait
+	}
+	return b
+}
+
+// wait returns the wait after the given failed attempt(0 the first one).
+func (b Backoff) wait(attempt int) time.Duration {
+	wait := float64(b.Initial)
+	for i := 0; i < attempt && wait < float64(b.Max); i++ {
+		wait *= b.Multiplier
+	}
+	if wait > float64(b.Max) {
+		wait = float64(b.Max)
+	}
+	return time.Duration(wait * (1 + b.Jitter*(2*rand.Float64()-1)))
+}
+
+// acquire calls doLock until the resource is locked, the context is done or the backoff MaxWait
+// is over. doLock must return a LockedError if the resource is locked.
+func acquire(ctx context.Context, resource string, backoff Backoff, doLock func() error) error {
+	start := time.Now()
+	deadline := start.Add(backoff.MaxWait)
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = doLock(); err == nil {
+			metrics.Histogram(ctx, "lock_wait_milliseconds", float64(time.Since(start).Milliseconds()))
+			return nil
+		}
+		if _, locked := err.(LockedError); locked {
+			metrics.Counter(ctx, "lock_contention", 1)
+		}
+
+		// Wait for the next attempt, if there is time for it
+		wait := backoff.wait(attempt)
+		if time.Now().Add(wait).After(deadline) {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = fmt.Errorf("lock of '%s' not acquired: %w", resource, ctx.Err())
+		case <-timer.C:
+			continue
+		}
+		break
+	}
+
+	// The wait is over
+	metrics.Histogram(ctx, "lock_wait_milliseconds", float64(time.Since(start).Milliseconds()))
+	if _, locked := err.(LockedError); locked {
+		metrics.Counter(ctx, "lock_timeout", 1)
+		return lanaerr.New(err, http.StatusLocked)
+	}
+	return err
+}
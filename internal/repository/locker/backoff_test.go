@@ -0,0 +1,97 @@
+package locker_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/locker"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMetrics records the metrics
+type fakeMetrics struct {
+	counters   map[string]float64
+	histograms map[string][]float64
+	mutex      sync.Mutex
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]float64),
+	}
+}
+
+func (f *fakeMetrics) Counter(name string, value float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.counters[name] += value
+}
+
+func (f *fakeMetrics) Histogram(name string, value float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.histograms[name] = append(f.histograms[name], value)
+}
+
+func (f *fakeMetrics) Request(path string, method string, statusCode int, duration int) {}
+
+func Test_locker_Lock_LockedError(t *testing.T) {
+	// Given
+	fm := newFakeMetrics()
+	ctx := metrics.WithMetrics(context.Background(), fm)
+	l := locker.NewLocker(ctx, testTTL, testBackoff)
+	l.Lock(ctx, "my-lock-key")
+
+	// When
+	lock, err := l.Lock(ctx, "my-lock-key")
+
+	// Then: locked after some attempts
+	assert.Nil(t, lock)
+	assert.EqualError(t, err, "the resource 'my-lock-key' is locked")
+	assert.Equal(t, http.StatusLocked, lanaerr.FromErr(err).GetStatusCode())
+	assert.True(t, errors.As(err, &locker.LockedError{}))
+	assert.Greater(t, fm.counters["lock_contention"], float64(1))
+	assert.Equal(t, float64(1), fm.counters["lock_timeout"])
+	assert.Len(t, fm.histograms["lock_wait_milliseconds"], 2)
+}
+
+func Test_locker_Lock_ContextDone(t *testing.T) {
+	// Given: a backoff longer than the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	l := locker.NewLocker(ctx, testTTL, locker.Backoff{Initial: 10 * time.Millisecond, MaxWait: time.Minute})
+	l.Lock(ctx, "my-lock-key")
+
+	// When
+	start := time.Now()
+	_, err := l.Lock(ctx, "my-lock-key")
+
+	// Then: the wait is over when the context is done, failing with the context error
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.EqualError(t, err, "lock of 'my-lock-key' not acquired: context deadline exceeded")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func Test_locker_Lock_WaitsForUnlock(t *testing.T) {
+	// Given: a lock released while waiting
+	ctx := context.Background()
+	l := locker.NewLocker(ctx, testTTL, locker.Backoff{Initial: 10 * time.Millisecond, MaxWait: time.Second})
+	held, _ := l.Lock(ctx, "my-lock-key")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.Unlock(ctx)
+	}()
+
+	// When
+	lock, err := l.Lock(ctx, "my-lock-key")
+
+	// Then
+	assert.Nil(t, err)
+	assert.NotNil(t, lock)
+}
@@ -2,7 +2,10 @@ package locker
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
 	"sync"
 	"time"
 )
@@ -12,26 +15,45 @@ import (
 // other instances and with concurrency we can have more than one instance working with
 // the same resource. An external distributed lock shared by all instances is the proper
 // way to do it, using something like Redis, Zookeeper, DynamoDB, etc...
+//
+// Every lock has a random owner token, returned in the lock handle. Only the handle with the
+// token can release the lock or extend its TTL, so a request whose lock expired can't release
+// the lock another request took since then.
+//
+// Every acquisition has a fencing token from a counter shared by all the resources. The counter
+// is moved forward to the current time in nanoseconds when it's behind, so the tokens keep
+// increasing across restarts and the last tokens accepted by a persistent storage don't reject
+// the writes of the new process. The redis lock issues its tokens the same way, so the lock can
+// be switched too.
 
 const (
-	defaultTTL       = 5 * time.Second
-	maxRetryAttempts = 3
-	retryWaitTime    = time.Millisecond * 100
+	defaultTTL = 5 * time.Second
+	tokenSize  = 16
 )
 
-func NewLocker(ctx context.Context) *locker {
+// NewLocker creates the locker with the TTL of the locks, the default TTL is used for zero.
+func NewLocker(ctx context.Context, ttl time.Duration, backoff Backoff) *locker {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
 	return &locker{
 		lockMap: make(map[string]lockValue, 0),
+		ttl:     ttl,
+		backoff: backoff.withDefaults(),
 	}
 }
 
 type locker struct {
 	lockMap map[string]lockValue
 	mutex   sync.Mutex
+	ttl     time.Duration
+	backoff Backoff
+	fence   uint64 // Last fencing token issued
 }
 
 type lockValue struct {
 	Key       string
+	Token     string
 	TTL       time.Duration
 	CreatedAt time.Time
 }
@@ -40,43 +62,96 @@ func (l lockValue) expired() bool {
 	return l.CreatedAt.Add(l.TTL).Before(time.Now())
 }
 
-func (l locker) Lock(ctx context.Context, resource string) error {
-	var err error
+func (l *locker) Lock(ctx context.Context, resource string) (checkout.Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
 
 	// Retry strategy
-	for i := 1; i <= maxRetryAttempts; i++ {
-		if err = l.doLock(ctx, resource); err == nil {
-			// Resource successfully locked
-			return nil
-		}
-		time.Sleep(retryWaitTime)
+	var fence uint64
+	err = acquire(ctx, resource, l.backoff, func() error {
+		fence, err = l.doLock(ctx, resource, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	return &lock{locker: l, resource: resource, token: token, fence: fence}, nil
 }
 
-func (l locker) doLock(ctx context.Context, resource string) error {
+func (l *locker) doLock(ctx context.Context, resource string, token string) (uint64, error) {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
 	value, ok := l.lockMap[resource]
 	if ok && !value.expired() {
-		return fmt.Errorf("the resource '%s' is locked", resource)
+		return 0, LockedError{Resource: resource}
 	}
 
 	l.lockMap[resource] = lockValue{
 		Key:       resource,
-		TTL:       defaultTTL,
+		Token:     token,
+		TTL:       l.ttl,
 		CreatedAt: time.Now(),
 	}
+	l.fence = nextFence(l.fence, time.Now())
+
+	return l.fence, nil
+}
+
+// lock is the handle of a lock held in the locker.
+type lock struct {
+	locker   *locker
+	resource string
+	token    string
+	fence    uint64
+}
 
+func (k *lock) Unlock(ctx context.Context) error {
+	k.locker.mutex.Lock()
+	defer k.locker.mutex.Unlock()
+
+	value, ok := k.locker.lockMap[k.resource]
+	if !ok || value.Token != k.token {
+		return fmt.Errorf("the lock of resource '%s' expired", k.resource)
+	}
+
+	delete(k.locker.lockMap, k.resource)
 	return nil
 }
 
-func (l locker) Unlock(ctx context.Context, resource string) error {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+func (k *lock) Refresh(ctx context.Context) error {
+	k.locker.mutex.Lock()
+	defer k.locker.mutex.Unlock()
 
-	delete(l.lockMap, resource)
+	value, ok := k.locker.lockMap[k.resource]
+	if !ok || value.Token != k.token || value.expired() {
+		return fmt.Errorf("the lock of resource '%s' expired", k.resource)
+	}
+
+	value.CreatedAt = time.Now()
+	k.locker.lockMap[k.resource] = value
 	return nil
 }
+
+func (k *lock) Token() uint64 {
+	return k.fence
+}
+
+// nextFence returns the fencing token after the last one, at least the time in nanoseconds.
+func nextFence(last uint64, now time.Time) uint64 {
+	if ns := uint64(now.UnixNano()); last < ns {
+		last = ns
+	}
+	return last + 1
+}
+
+func newToken() (string, error) {
+	token := make([]byte, tokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("lock token error: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
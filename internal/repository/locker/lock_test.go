@@ -8,31 +8,41 @@ import (
 	"time"
 )
 
+// testBackoff gives up soon, so the tests don't wait for locked resources
+var testBackoff = locker.Backoff{Initial: 10 * time.Millisecond, MaxWait: 50 * time.Millisecond}
+
+// testTTL outlasts the tests, shortTTL is used by the tests that let the locks expire
+const (
+	testTTL  = time.Minute
+	shortTTL = 100 * time.Millisecond
+)
+
 func Test_locker_Lock_Success(t *testing.T) {
 	// Given
 	ctx := context.Background()
-	l := locker.NewLocker(ctx)
+	l := locker.NewLocker(ctx, testTTL, testBackoff)
 	key := "my-lock-key"
 
 	// When
-	err := l.Lock(ctx, key)            // Lock
-	errAlreadyLock := l.Lock(ctx, key) // Already Lock
+	lock, err := l.Lock(ctx, key)         // Lock
+	_, errAlreadyLock := l.Lock(ctx, key) // Already Lock
 
 	// Then
 	assert.Nil(t, err)
+	assert.NotNil(t, lock)
 	assert.EqualError(t, errAlreadyLock, "the resource 'my-lock-key' is locked")
 }
 
 func Test_locker_Lock_Success_Expired(t *testing.T) {
 	// Given
 	ctx := context.Background()
-	l := locker.NewLocker(ctx)
+	l := locker.NewLocker(ctx, shortTTL, testBackoff)
 	key := "my-lock-key"
 
 	// When
-	err := l.Lock(ctx, key)        // Lock
-	time.Sleep(time.Second * 6)    // Let lock expire (5s default TTL)
-	errNewLock := l.Lock(ctx, key) // Lock again
+	_, err := l.Lock(ctx, key)        // Lock
+	time.Sleep(2 * shortTTL)          // Let lock expire
+	_, errNewLock := l.Lock(ctx, key) // Lock again
 
 	// Then
 	assert.Nil(t, err)
@@ -42,16 +52,73 @@ func Test_locker_Lock_Success_Expired(t *testing.T) {
 func Test_locker_Unlock_Success(t *testing.T) {
 	// Given
 	ctx := context.Background()
-	l := locker.NewLocker(ctx)
+	l := locker.NewLocker(ctx, testTTL, testBackoff)
 	key := "my-lock-key"
 
 	// When
-	err := l.Lock(ctx, key)         // Lock
-	errUnlock := l.Unlock(ctx, key) // Unlock
-	errNewLock := l.Lock(ctx, key)  // Lock again
+	lock, err := l.Lock(ctx, key)     // Lock
+	errUnlock := lock.Unlock(ctx)     // Unlock
+	_, errNewLock := l.Lock(ctx, key) // Lock again
 
 	// Then
 	assert.Nil(t, err)
 	assert.Nil(t, errUnlock)
 	assert.Nil(t, errNewLock)
 }
+
+func Test_locker_Unlock_NotOwner(t *testing.T) {
+	// Given: the lock expired and was taken by another owner
+	ctx := context.Background()
+	l := locker.NewLocker(ctx, shortTTL, testBackoff)
+	key := "my-lock-key"
+	lock, _ := l.Lock(ctx, key)
+	time.Sleep(2 * shortTTL) // Let lock expire
+	l.Lock(ctx, key)
+
+	// When
+	errUnlock := lock.Unlock(ctx)
+	errRefresh := lock.Refresh(ctx)
+	_, errLock := l.Lock(ctx, key)
+
+	// Then: the lock of the other owner is kept
+	assert.EqualError(t, errUnlock, "the lock of resource 'my-lock-key' expired")
+	assert.EqualError(t, errRefresh, "the lock of resource 'my-lock-key' expired")
+	assert.EqualError(t, errLock, "the resource 'my-lock-key' is locked")
+}
+
+func Test_locker_Refresh_Success(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	l := locker.NewLocker(ctx, shortTTL, testBackoff)
+	key := "my-lock-key"
+	lock, _ := l.Lock(ctx, key)
+	time.Sleep(shortTTL * 3 / 5)
+
+	// When: refreshed before it expires
+	err := lock.Refresh(ctx)
+	time.Sleep(shortTTL * 3 / 5)
+	_, errLock := l.Lock(ctx, key)
+
+	// Then: it's still locked after the initial TTL
+	assert.Nil(t, err)
+	assert.EqualError(t, errLock, "the resource 'my-lock-key' is locked")
+}
+
+func Test_locker_Token_Increases(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	l := locker.NewLocker(ctx, testTTL, testBackoff)
+	key := "my-lock-key"
+
+	// When
+	first, _ := l.Lock(ctx, key)
+	first.Unlock(ctx)
+	second, _ := l.Lock(ctx, key)
+	other, _ := l.Lock(ctx, "other-lock-key")
+	restarted, _ := locker.NewLocker(ctx, testTTL, testBackoff).Lock(ctx, key)
+
+	// Then: even after a restart
+	assert.Less(t, first.Token(), second.Token())
+	assert.Less(t, second.Token(), other.Token())
+	assert.Less(t, other.Token(), restarted.Token())
+}
@@ -0,0 +1,169 @@
+package locker
+
+import (
+	"context"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"strconv"
+	"time"
+)
+
+// NOTE: The redis lock is shared by all the instances using the same Redis server, so the service
+// can be scaled horizontally. A resource is locked setting its key only if it doesn't exist(NX)
+// with the lock TTL(PX), so a lock held by a crashed instance is released once expired. The value
+// is a random token of the owner: unlock deletes the key only if it still has the owner token, in
+// a Lua script so the check and the delete are atomic. That way an instance whose lock expired
+// doesn't release the lock taken by another instance since then.
+//
+// The fencing token is issued by the lock script too, so a lock is never taken without a token.
+// Like in the in memory lock, it's the next value of a counter shared by all the resources(a key
+// that doesn't expire), moved forward to the current time in nanoseconds if it's behind. So the
+// tokens of both locks are comparable, and they keep increasing if the lock is switched or the
+// Redis data is lost.
+
+const (
+	redisKeyPrefix = "lock:"
+	redisFenceKey  = "fence"
+)
+
+const (
+	// lockScript sets the key if it doesn't exist with the owner token and the TTL, and returns the
+	// next fencing token, at least the current time(ARGV[3]). 0 is returned if it's locked. Lua
+	// numbers are doubles, which lose precision with nanoseconds(even the INCR reply is converted
+	// to one), so the tokens are compared, incremented and returned as decimal strings
+	lockScript = `if not redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 0
+end
+local fence = redis.call("GET", KEYS[2])
+if not fence or #fence < #ARGV[3] or (#fence == #ARGV[3] and fence < ARGV[3]) then
+	fence = ARGV[3]
+end
+local i = #fence
+while i > 0 and fence:sub(i, i) == "9" do
+	i = i - 1
+end
+if i == 0 then
+	fence = "1" .. string.rep("0", #fence)
+else
+	fence = fence:sub(1, i - 1) .. string.char(fence:byte(i) + 1) .. string.rep("0", #fence - i)
+end
+redis.call("SET", KEYS[2], fence)
+return fence`
+
+	// unlockScript deletes the key only if it has the owner token
+	unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+else
+	return 0
+end`
+
+	// refreshScript sets the TTL of the key only if it has the owner token
+	refreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+	return 0
+end`
+)
+
+// NewRedisLocker creates the locker with the TTL of the locks, the default TTL is used for zero.
+func NewRedisLocker(ctx context.Context, addr string, password string, ttl time.Duration,
+	backoff Backoff) *redisLocker {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &redisLocker{
+		client:  newRespClient(addr, password),
+		ttl:     ttl,
+		backoff: backoff.withDefaults(),
+	}
+}
+
+type redisLocker struct {
+	client  *respClient
+	ttl     time.Duration
+	backoff Backoff
+}
+
+func (l *redisLocker) Lock(ctx context.Context, resource string) (checkout.Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Retry strategy
+	var fence uint64
+	err = acquire(ctx, resource, l.backoff, func() error {
+		fence, err = l.doLock(ctx, resource, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisLock{locker: l, resource: resource, token: token, fence: fence}, nil
+}
+
+func (l *redisLocker) doLock(ctx context.Context, resource string, token string) (uint64, error) {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	reply, err := l.client.Do(ctx, "EVAL", lockScript, "2", redisKeyPrefix+resource, redisFenceKey, token,
+		redisTTL(l.ttl), now)
+	if err != nil {
+		return 0, fmt.Errorf("lock error: %w", err)
+	}
+	if reply == int64(0) {
+		return 0, LockedError{Resource: resource}
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return 0, fmt.Errorf("lock error: unexpected reply %v", reply)
+	}
+	fence, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || fence == 0 {
+		return 0, fmt.Errorf("lock error: unexpected reply %v", reply)
+	}
+	return fence, nil
+}
+
+// redisLock is the handle of a lock held in the Redis server.
+type redisLock struct {
+	locker   *redisLocker
+	resource string
+	token    string
+	fence    uint64
+}
+
+func (k *redisLock) Token() uint64 {
+	return k.fence
+}
+
+func (k *redisLock) Unlock(ctx context.Context) error {
+	deleted, err := k.locker.client.Do(ctx, "EVAL", unlockScript, "1", redisKeyPrefix+k.resource, k.token)
+	if err != nil {
+		return fmt.Errorf("unlock error: %w", err)
+	}
+	if deleted != int64(1) {
+		return fmt.Errorf("the lock of resource '%s' expired", k.resource)
+	}
+	return nil
+}
+
+func (k *redisLock) Refresh(ctx context.Context) error {
+	refreshed, err := k.locker.client.Do(ctx, "EVAL", refreshScript, "1", redisKeyPrefix+k.resource, k.token,
+		redisTTL(k.locker.ttl))
+	if err != nil {
+		return fmt.Errorf("lock refresh error: %w", err)
+	}
+	if refreshed != int64(1) {
+		return fmt.Errorf("the lock of resource '%s' expired", k.resource)
+	}
+	return nil
+}
+
+// Close closes the connections to the server.
+func (l *redisLocker) Close() error {
+	return l.client.Close()
+}
+
+func redisTTL(ttl time.Duration) string {
+	return strconv.FormatInt(ttl.Milliseconds(), 10)
+}
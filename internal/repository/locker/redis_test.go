@@ -0,0 +1,190 @@
+package locker_test
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/locker"
+	"github.com/gbrlmza/lana-bechallenge-checkout/test/fake"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func buildRedisServer(t *testing.T) *fake.RedisServer {
+	server, err := fake.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func Test_redisLocker_Lock_Success(t *testing.T) {
+	// Given: two instances sharing the server
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	other := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	defer other.Close()
+	key := "my-lock-key"
+
+	// When
+	lock, err := l.Lock(ctx, key)             // Lock
+	_, errAlreadyLock := other.Lock(ctx, key) // Already Lock
+	_, locked := server.Get("lock:" + key)
+
+	// Then
+	assert.Nil(t, err)
+	assert.NotNil(t, lock)
+	assert.EqualError(t, errAlreadyLock, "the resource 'my-lock-key' is locked")
+	assert.True(t, locked)
+}
+
+func Test_redisLocker_Unlock_Success(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	other := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	defer other.Close()
+	key := "my-lock-key"
+
+	// When
+	lock, err := l.Lock(ctx, key)         // Lock
+	errUnlock := lock.Unlock(ctx)         // Unlock
+	_, errNewLock := other.Lock(ctx, key) // Lock again
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, errUnlock)
+	assert.Nil(t, errNewLock)
+}
+
+func Test_redisLocker_Unlock_NotOwner(t *testing.T) {
+	// Given: the lock expired and was taken by another instance
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	other := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	defer other.Close()
+	key := "my-lock-key"
+	lock, _ := l.Lock(ctx, key)
+	server.Expire("lock:" + key)
+	other.Lock(ctx, key)
+
+	// When
+	errUnlock := lock.Unlock(ctx)
+	errRefresh := lock.Refresh(ctx)
+	_, errLock := l.Lock(ctx, key)
+
+	// Then: the lock of the other instance is kept
+	assert.EqualError(t, errUnlock, "the lock of resource 'my-lock-key' expired")
+	assert.EqualError(t, errRefresh, "the lock of resource 'my-lock-key' expired")
+	assert.EqualError(t, errLock, "the resource 'my-lock-key' is locked")
+}
+
+func Test_redisLocker_Refresh_Success(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	key := "my-lock-key"
+	lock, _ := l.Lock(ctx, key)
+
+	// When
+	err := lock.Refresh(ctx)
+	errUnlock := lock.Unlock(ctx)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Nil(t, errUnlock)
+}
+
+func Test_redisLocker_Lock_ConnectionError(t *testing.T) {
+	// Given: a server that is down
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	server.Close()
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+
+	// When
+	lock, err := l.Lock(ctx, "my-lock-key")
+
+	// Then
+	assert.Error(t, err)
+	assert.Nil(t, lock)
+}
+
+func Test_redisLocker_Token_Increases(t *testing.T) {
+	// Given: two instances sharing the server
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	other := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	defer other.Close()
+	key := "my-lock-key"
+	start := uint64(time.Now().UnixNano())
+
+	// When
+	first, err := l.Lock(ctx, key)
+	first.Unlock(ctx)
+	second, errSecond := other.Lock(ctx, key)
+	third, errThird := l.Lock(ctx, "other-lock-key")
+	fence, _ := server.Get("fence")
+
+	// Then: the counter is shared by the resources and starts at the current time
+	assert.Nil(t, err)
+	assert.Nil(t, errSecond)
+	assert.Nil(t, errThird)
+	assert.Less(t, start, first.Token())
+	assert.Less(t, first.Token(), second.Token())
+	assert.Less(t, second.Token(), third.Token())
+	assert.Equal(t, strconv.FormatUint(third.Token(), 10), fence)
+}
+
+func Test_redisLocker_Token_AfterDataLoss(t *testing.T) {
+	// Given: tokens issued by the in memory lock and the redis lock, whose data is lost after it
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	key := "my-lock-key"
+	memory, _ := locker.NewLocker(ctx, testTTL, testBackoff).Lock(ctx, key)
+	first, _ := l.Lock(ctx, key)
+	first.Unlock(ctx)
+	server.Expire("fence")
+
+	// When
+	second, err := l.Lock(ctx, key)
+
+	// Then: the tokens keep increasing
+	assert.Nil(t, err)
+	assert.Less(t, memory.Token(), first.Token())
+	assert.Less(t, first.Token(), second.Token())
+}
+
+func Test_redisLocker_Token_AheadOfClock(t *testing.T) {
+	// Given: a counter set ahead of the clock of the instance by another instance
+	ctx := context.Background()
+	server := buildRedisServer(t)
+	l := locker.NewRedisLocker(ctx, server.Addr(), "", testTTL, testBackoff)
+	defer l.Close()
+	key := "my-lock-key"
+	server.Run("SET", "fence", "4000000000000000001")
+
+	// When
+	first, err := l.Lock(ctx, key)
+	first.Unlock(ctx)
+	second, errSecond := l.Lock(ctx, key)
+
+	// Then: the tokens are exact, every acquisition has its own
+	assert.Nil(t, err)
+	assert.Nil(t, errSecond)
+	assert.Equal(t, uint64(4000000000000000002), first.Token())
+	assert.Equal(t, uint64(4000000000000000003), second.Token())
+}
@@ -0,0 +1,210 @@
+package locker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// respClient is a minimal client of the Redis protocol(RESP), enough to run the lock commands.
+// Connections are reused through a small pool of idle connections.
+
+const (
+	respMaxIdleConns = 8
+	respIOTimeout    = 5 * time.Second
+)
+
+var errRespNil = errors.New("nil reply")
+
+type respClient struct {
+	addr     string
+	password string
+	idle     []*respConn
+	mutex    sync.Mutex
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRespClient(addr string, password string) *respClient {
+	return &respClient{
+		addr:     addr,
+		password: password,
+	}
+}
+
+// Do sends the command and returns its reply: a string, an int64, a []interface{} or errRespNil.
+// Error replies are returned as errors.
+func (c *respClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	if _, ok := err.(respError); err != nil && !ok && err != errRespNil {
+		// Connection in an unknown state
+		conn.conn.Close()
+		return nil, err
+	}
+
+	c.put(conn)
+	return reply, err
+}
+
+// Close closes the idle connections.
+func (c *respClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, conn := range c.idle {
+		conn.conn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *respClient) get(ctx context.Context) (*respConn, error) {
+	c.mutex.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mutex.Unlock()
+		return conn, nil
+	}
+	c.mutex.Unlock()
+
+	dialer := net.Dialer{Timeout: respIOTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis connection error: %w", err)
+	}
+	conn := &respConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.password != "" {
+		if _, err := conn.do(ctx, "AUTH", c.password); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis auth error: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *respClient) put(conn *respConn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.idle) >= respMaxIdleConns {
+		conn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+func (c *respConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(respIOTimeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as an array of bulk strings
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return readRespReply(c.reader)
+}
+
+// readRespReply reads a reply of the server.
+func readRespReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis protocol error: %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, respError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("redis protocol error: %q", line)
+		}
+		if size < 0 {
+			return nil, errRespNil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("redis protocol error: %q", line)
+		}
+		if size < 0 {
+			return nil, errRespNil
+		}
+		// The whole array is read even if it has error replies, so the connection is left at the
+		// start of the next reply
+		items := make([]interface{}, size)
+		var itemErr error
+		for i := range items {
+			item, err := readRespReply(r)
+			if _, ok := err.(respError); ok {
+				if itemErr == nil {
+					itemErr = err
+				}
+				continue
+			}
+			if err != nil && err != errRespNil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis protocol error: %q", line)
+	}
+}
@@ -0,0 +1,23 @@
+package locker
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_readRespReply_ArrayWithError(t *testing.T) {
+	// Given: an array with an error reply, followed by another reply
+	r := bufio.NewReader(strings.NewReader("*3\r\n:1\r\n-ERR failed\r\n$2\r\nok\r\n+PONG\r\n"))
+
+	// When
+	reply, err := readRespReply(r)
+	next, errNext := readRespReply(r)
+
+	// Then: the whole array is read
+	assert.Nil(t, reply)
+	assert.EqualError(t, err, "ERR failed")
+	assert.Nil(t, errNext)
+	assert.Equal(t, "PONG", next)
+}
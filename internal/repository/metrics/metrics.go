@@ -12,6 +12,7 @@ type Tag map[string]interface{}
 
 type Metrics interface {
 	Counter(name string, value float64)
+	Histogram(name string, value float64)
 	Request(path string, method string, statusCode int, duration int)
 }
 
@@ -25,6 +26,12 @@ func Counter(ctx context.Context, name string, value float64) {
 	}
 }
 
+func Histogram(ctx context.Context, name string, value float64) {
+	if metric, ok := ctx.Value(ctxKey).(Metrics); ok {
+		metric.Histogram(name, value)
+	}
+}
+
 func Request(ctx context.Context, path string, method string, statusCode int, duration int) {
 	if metric, ok := ctx.Value(ctxKey).(Metrics); ok {
 		metric.Request(path, method, statusCode, duration)
@@ -9,9 +9,12 @@ import (
 )
 
 var (
-	counters    map[string]prometheus.Counter
-	once        sync.Once
-	httpRequest *prometheus.HistogramVec
+	counters     map[string]prometheus.Counter
+	countersMu   sync.Mutex
+	histograms   map[string]prometheus.Histogram
+	histogramsMu sync.Mutex
+	once         sync.Once
+	httpRequest  *prometheus.HistogramVec
 )
 
 // Implementation of Metrics interface with Prometheus
@@ -21,6 +24,7 @@ func NewMetrics() metrics.Metrics {
 	once.Do(func() {
 		// Map counter dynamically created counter
 		counters = make(map[string]prometheus.Counter)
+		histograms = make(map[string]prometheus.Histogram)
 
 		// Standard request
 		httpRequest = prometheus.NewHistogramVec(prometheus.HistogramOpts{
@@ -35,7 +39,10 @@ func NewMetrics() metrics.Metrics {
 }
 
 func (p *Prometheus) Counter(name string, value float64) {
-	// Check if counter exists. Create it if new
+	// Check if counter exists. Create it if new. Counters are also used by background jobs,
+	// not only by requests
+	countersMu.Lock()
+	defer countersMu.Unlock()
 	if _, exists := counters[name]; !exists {
 		counters[name] = promauto.NewCounter(prometheus.CounterOpts{Name: name})
 	}
@@ -44,6 +51,18 @@ func (p *Prometheus) Counter(name string, value float64) {
 	counters[name].Add(value)
 }
 
+func (p *Prometheus) Histogram(name string, value float64) {
+	// Check if histogram exists. Create it if new
+	histogramsMu.Lock()
+	defer histogramsMu.Unlock()
+	if _, exists := histograms[name]; !exists {
+		histograms[name] = promauto.NewHistogram(prometheus.HistogramOpts{Name: name})
+	}
+
+	// Observe
+	histograms[name].Observe(value)
+}
+
 func (p *Prometheus) Request(path string, method string, statusCode int, duration int) {
 	httpRequest.With(prometheus.Labels{
 		"Handler":    path,
@@ -1,11 +1,21 @@
 package storage
 
-import "github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"time"
+)
 
 func (s *storage) initializeData() {
 	s.data.baskets = make(map[string]entities.Basket, 0)
+	s.data.expired = make(map[string]time.Time, 0)
+	s.data.fences = make(map[string]uint64, 0)
+	s.data.retired = make(map[string]time.Time, 0)
+	s.data.events = make(map[string][]entities.BasketEvent, 0)
 	s.data.products = make(map[string]entities.Product, 0)
 	s.data.promotions = make(map[string]entities.Promotion, 0)
+	s.data.coupons = make(map[string]entities.Coupon, 0)
+	s.data.orders = make(map[string]entities.Order, 0)
+	s.data.stocks = make(map[string]entities.Stock, 0)
 
 	//===========================================================================================
 	// Promotions
@@ -25,25 +35,48 @@ func (s *storage) initializeData() {
 		Reduction:     25,
 	}
 
+	//===========================================================================================
+	// Coupons
+	//===========================================================================================
+	s.data.coupons["WELCOME10"] = entities.Coupon{
+		Code:         "WELCOME10",
+		DiscountType: entities.CouponDiscountPercentage,
+		Percent:      10,
+		UsageLimit:   1000,
+	}
+	s.data.coupons["5OFF"] = entities.Coupon{
+		Code:           "5OFF",
+		DiscountType:   entities.CouponDiscountFixedAmount,
+		Amount:         entities.NewMoney(500, entities.DefaultCurrency),
+		MinBasketTotal: entities.NewMoney(2000, entities.DefaultCurrency),
+	}
+
 	//===========================================================================================
 	// Products
 	//===========================================================================================
 	s.data.products["PEN"] = entities.Product{
-		ID:          "PEN",
-		Name:        "Lana Pen",
-		Price:       5.0,
-		PromotionID: &promotion2X1,
+		ID:           "PEN",
+		Name:         "Lana Pen",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{promotion2X1},
 	}
 	s.data.products["TSHIRT"] = entities.Product{
-		ID:          "TSHIRT",
-		Name:        "Lana T-Shirt",
-		Price:       20.0,
-		PromotionID: &promotion25Off,
+		ID:           "TSHIRT",
+		Name:         "Lana T-Shirt",
+		Price:        entities.NewMoney(2000, entities.DefaultCurrency),
+		PromotionIDs: []string{promotion25Off},
 	}
 	s.data.products["MUG"] = entities.Product{
-		ID:          "MUG",
-		Name:        "Lana Coffee Mug",
-		Price:       7.50,
-		PromotionID: nil,
+		ID:           "MUG",
+		Name:         "Lana Coffee Mug",
+		Price:        entities.NewMoney(750, entities.DefaultCurrency),
+		PromotionIDs: nil,
+	}
+
+	//===========================================================================================
+	// Stock
+	//===========================================================================================
+	for _, productID := range []string{"PEN", "TSHIRT", "MUG"} {
+		s.data.stocks[productID] = *entities.NewStock(productID, 1000)
 	}
 }
@@ -0,0 +1,494 @@
+package storage
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NOTE: The file storage is a durable version of the in-memory storage. All the data is still
+// served from memory, but every write is also appended to a write-ahead log(wal) on the data
+// directory before it is acknowledged. Periodically a snapshot with the whole data set is written
+// and the log truncated, so the log doesn't grow forever and the startup doesn't need to replay
+// the full history.
+//
+// On startup the last snapshot is loaded and the log replayed on top of it. Records in the log
+// are the full state of the written entity, so replaying a record already contained in the
+// snapshot(a crash between the snapshot and the log truncation) is harmless.
+//
+// Every write runs as a transaction(see tx.go) and is logged once it succeeds: if the log can't be
+// written the write is rolled back, so the memory never serves a write that would be lost on
+// restart. The writes of a transaction are logged in a single record, so after a crash they are
+// replayed all or none.
+
+const (
+	snapshotFileName = "snapshot.gob"
+	walFileName      = "wal.log"
+)
+
+type walOperation string
+
+const (
+	walOpBasketSave      walOperation = "basket_save"
+	walOpBasketDelete    walOperation = "basket_delete"
+	walOpBasketExpire    walOperation = "basket_expire"
+	walOpBasketEvents    walOperation = "basket_events"
+	walOpOrderSave       walOperation = "order_save"
+	walOpProductSave     walOperation = "product_save"
+	walOpProductDelete   walOperation = "product_delete"
+	walOpPromotionSave   walOperation = "promotion_save"
+	walOpPromotionDelete walOperation = "promotion_delete"
+	walOpCouponSave      walOperation = "coupon_save"
+	walOpStockSave       walOperation = "stock_save"
+	walOpTx              walOperation = "tx"
+)
+
+type walRecord struct {
+	Operation    walOperation
+	Key          string
+	Basket       *entities.Basket
+	Order        *entities.Order
+	Product      *entities.Product
+	Promotion    *entities.Promotion
+	Coupon       *entities.Coupon
+	Stock        *entities.Stock
+	GraceUntil   time.Time
+	FencingToken uint64
+	Events       []entities.BasketEvent
+	Records      []walRecord // Writes of a transaction
+}
+
+type snapshotData struct {
+	Products   map[string]entities.Product
+	Baskets    map[string]entities.Basket
+	Expired    map[string]time.Time
+	Fences     map[string]uint64
+	Retired    map[string]time.Time
+	Events     map[string][]entities.BasketEvent
+	Promotions map[string]entities.Promotion
+	Coupons    map[string]entities.Coupon
+	Orders     map[string]entities.Order
+	Stocks     map[string]entities.Stock
+}
+
+type fileStorage struct {
+	*storage
+	dir       string
+	wal       *os.File
+	walMutex  sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewFileStorage(ctx context.Context, dir string, snapshotInterval time.Duration, clock checkout.Clock) (*fileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &fileStorage{
+		storage: &storage{clock: clock},
+		dir:     dir,
+		done:    make(chan struct{}),
+	}
+
+	// Load last snapshot & replay the log
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	// Periodic snapshots
+	if snapshotInterval > 0 {
+		go s.snapshotLoop(ctx, snapshotInterval)
+	}
+
+	return s, nil
+}
+
+func (s *fileStorage) BasketSave(ctx context.Context, basket *entities.Basket, fencingToken uint64) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.BasketSave(ctx, basket, fencingToken)
+	})
+}
+
+func (s *fileStorage) BasketDelete(ctx context.Context, basketID string, fencingToken uint64) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.BasketDelete(ctx, basketID, fencingToken)
+	})
+}
+
+func (s *fileStorage) BasketExpire(ctx context.Context, basketID string, graceUntil time.Time, fencingToken uint64) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.BasketExpire(ctx, basketID, graceUntil, fencingToken)
+	})
+}
+
+func (s *fileStorage) BasketEventsAppend(ctx context.Context, basketID string, events []entities.BasketEvent) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.BasketEventsAppend(ctx, basketID, events)
+	})
+}
+
+func (s *fileStorage) OrderSave(ctx context.Context, order *entities.Order) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.OrderSave(ctx, order)
+	})
+}
+
+func (s *fileStorage) ProductSave(ctx context.Context, product *entities.Product) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.ProductSave(ctx, product)
+	})
+}
+
+func (s *fileStorage) ProductDelete(ctx context.Context, productID string) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.ProductDelete(ctx, productID)
+	})
+}
+
+func (s *fileStorage) PromotionSave(ctx context.Context, promotion *entities.Promotion) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.PromotionSave(ctx, promotion)
+	})
+}
+
+func (s *fileStorage) PromotionDelete(ctx context.Context, promotionID string) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.PromotionDelete(ctx, promotionID)
+	})
+}
+
+func (s *fileStorage) CouponSave(ctx context.Context, coupon *entities.Coupon) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.CouponSave(ctx, coupon)
+	})
+}
+
+func (s *fileStorage) StockSave(ctx context.Context, stock *entities.Stock) error {
+	return s.write(func(tx checkout.Storage) error {
+		return tx.StockSave(ctx, stock)
+	})
+}
+
+func (s *fileStorage) WithTx(ctx context.Context, fn func(tx checkout.Storage) error) error {
+	return s.write(fn)
+}
+
+// write runs the writes in a transaction and logs them once they succeed. If the log can't be
+// written the writes are rolled back, so a write is never served without being durable.
+func (s *fileStorage) write(fn func(tx checkout.Storage) error) error {
+	// No other write is logged until the transaction ends
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	return s.storage.runTx(fn, func(redo []walRecord) error {
+		switch len(redo) {
+		case 0:
+			return nil
+		case 1:
+			return s.append(redo[0])
+		default:
+			return s.append(walRecord{Operation: walOpTx, Records: redo})
+		}
+	})
+}
+
+// Snapshot writes the whole data set to the snapshot file and truncates the log.
+func (s *fileStorage) Snapshot() error {
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	return s.snapshot()
+}
+
+// Close takes a last snapshot and releases the log file.
+func (s *fileStorage) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.walMutex.Lock()
+		defer s.walMutex.Unlock()
+
+		err = s.snapshot()
+		if closeErr := s.wal.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (s *fileStorage) snapshotLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Close(); err != nil {
+				log.Printf("file storage close error: %v", err)
+			}
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				log.Printf("file storage snapshot error: %v", err)
+			}
+		}
+	}
+}
+
+func (s *fileStorage) append(rec walRecord) error {
+	frame, err := encodeWalRecord(rec)
+	if err != nil {
+		return fmt.Errorf("storage write error: %w", err)
+	}
+
+	offset, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("storage write error: %w", err)
+	}
+
+	_, err = s.wal.Write(frame)
+	if err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// Drop what was written of the record, the write is rolled back. Otherwise the records
+		// after a torn one would be discarded on recovery
+		s.wal.Truncate(offset)
+		s.wal.Seek(offset, io.SeekStart)
+		return fmt.Errorf("storage write error: %w", err)
+	}
+
+	return nil
+}
+
+func (s *fileStorage) recover() error {
+	// Load snapshot. Without a snapshot the storage starts with the initial data set
+	if err := s.loadSnapshot(); os.IsNotExist(err) {
+		s.initializeData()
+	} else if err != nil {
+		return fmt.Errorf("error loading snapshot: %w", err)
+	}
+
+	// Open log
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	s.wal = wal
+
+	// Read valid records & discard any torn record left by a crash
+	records, offset, err := readWal(wal)
+	if err != nil {
+		return fmt.Errorf("error reading wal: %w", err)
+	}
+	if err := wal.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Replay
+	for _, rec := range records {
+		s.replay(rec)
+	}
+
+	return nil
+}
+
+func (s *fileStorage) replay(rec walRecord) {
+	switch rec.Operation {
+	case walOpBasketSave:
+		s.data.baskets[rec.Key] = *rec.Basket
+		delete(s.data.expired, rec.Key)
+		delete(s.data.retired, rec.Key)
+		s.acceptFencingToken(rec.Key, rec.FencingToken)
+	case walOpBasketDelete:
+		// The retention of the token starts again on recovery, as the log has no write times
+		delete(s.data.baskets, rec.Key)
+		s.acceptFencingToken(rec.Key, rec.FencingToken)
+		s.retireFencingToken(rec.Key)
+	case walOpBasketExpire:
+		delete(s.data.baskets, rec.Key)
+		s.data.expired[rec.Key] = rec.GraceUntil
+		s.acceptFencingToken(rec.Key, rec.FencingToken)
+		s.retireFencingToken(rec.Key)
+	case walOpBasketEvents:
+		// Events already in the snapshot are skipped
+		history := s.data.events[rec.Key]
+		for _, event := range rec.Events {
+			if event.Sequence > uint64(len(history)) {
+				history = append(history, event)
+			}
+		}
+		s.data.events[rec.Key] = history
+	case walOpOrderSave:
+		s.data.orders[rec.Key] = *rec.Order
+	case walOpProductSave:
+		s.data.products[rec.Key] = *rec.Product
+	case walOpProductDelete:
+		delete(s.data.products, rec.Key)
+	case walOpPromotionSave:
+		s.data.promotions[rec.Key] = *rec.Promotion
+	case walOpPromotionDelete:
+		delete(s.data.promotions, rec.Key)
+	case walOpCouponSave:
+		s.data.coupons[rec.Key] = *rec.Coupon
+	case walOpStockSave:
+		s.data.stocks[rec.Key] = *rec.Stock
+	case walOpTx:
+		for _, txRec := range rec.Records {
+			s.replay(txRec)
+		}
+	}
+}
+
+func (s *fileStorage) loadSnapshot() error {
+	file, err := os.Open(filepath.Join(s.dir, snapshotFileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := snapshotData{}
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return err
+	}
+
+	s.data.products = data.Products
+	s.data.baskets = data.Baskets
+	s.data.expired = data.Expired
+	s.data.fences = data.Fences
+	s.data.retired = data.Retired
+	s.data.events = data.Events
+	s.data.promotions = data.Promotions
+	s.data.coupons = data.Coupons
+	s.data.orders = data.Orders
+	s.data.stocks = data.Stocks
+	if s.data.products == nil {
+		s.data.products = make(map[string]entities.Product, 0)
+	}
+	if s.data.baskets == nil {
+		s.data.baskets = make(map[string]entities.Basket, 0)
+	}
+	if s.data.expired == nil {
+		s.data.expired = make(map[string]time.Time, 0)
+	}
+	if s.data.fences == nil {
+		s.data.fences = make(map[string]uint64, 0)
+	}
+	if s.data.retired == nil {
+		s.data.retired = make(map[string]time.Time, 0)
+	}
+	// Snapshots written before the retention have the fences of the baskets no longer stored
+	for id := range s.data.fences {
+		if _, ok := s.data.baskets[id]; !ok {
+			if _, ok := s.data.retired[id]; !ok {
+				s.retireFencingToken(id)
+			}
+		}
+	}
+	if s.data.events == nil {
+		s.data.events = make(map[string][]entities.BasketEvent, 0)
+	}
+	if s.data.promotions == nil {
+		s.data.promotions = make(map[string]entities.Promotion, 0)
+	}
+	if s.data.coupons == nil {
+		s.data.coupons = make(map[string]entities.Coupon, 0)
+	}
+	if s.data.orders == nil {
+		s.data.orders = make(map[string]entities.Order, 0)
+	}
+	if s.data.stocks == nil {
+		s.data.stocks = make(map[string]entities.Stock, 0)
+	}
+
+	return nil
+}
+
+// snapshot must be called holding the wal mutex, so no writes happen until the log is truncated.
+func (s *fileStorage) snapshot() error {
+	s.mutex.product.Lock()
+	s.mutex.basket.Lock()
+	s.mutex.event.Lock()
+	s.mutex.promotion.Lock()
+	s.mutex.coupon.Lock()
+	s.mutex.order.Lock()
+	s.mutex.stock.Lock()
+	data := snapshotData{
+		Products:   s.data.products,
+		Baskets:    s.data.baskets,
+		Expired:    s.data.expired,
+		Fences:     s.data.fences,
+		Retired:    s.data.retired,
+		Events:     s.data.events,
+		Promotions: s.data.promotions,
+		Coupons:    s.data.coupons,
+		Orders:     s.data.orders,
+		Stocks:     s.data.stocks,
+	}
+	err := s.writeSnapshot(data)
+	s.mutex.stock.Unlock()
+	s.mutex.order.Unlock()
+	s.mutex.coupon.Unlock()
+	s.mutex.promotion.Unlock()
+	s.mutex.event.Unlock()
+	s.mutex.basket.Unlock()
+	s.mutex.product.Unlock()
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	// Everything in the log is now in the snapshot
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	_, err = s.wal.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *fileStorage) writeSnapshot(data snapshotData) error {
+	// Write to a temporary file and rename it, so a crash never leaves a half written snapshot
+	path := filepath.Join(s.dir, snapshotFileName)
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,262 @@
+package storage_test
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/clock"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func buildDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "filestorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func buildBasket(id string) *entities.Basket {
+	basket := entities.NewBasket()
+	basket.ID = id
+	basket.CreatedAt = time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	item := entities.NewBasketItem(entities.Product{ID: "PEN", Price: entities.NewMoney(500, entities.DefaultCurrency)}, &entities.Promotion{
+		ID:            "BUY2GET1FREE",
+		RequiredItems: 2,
+		FreeItems:     1,
+	})
+	item.AddQuantity(3)
+	basket.SaveItem(item)
+	return basket
+}
+
+func Test_fileStorage_Recover_FromLog(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	deleted := buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6")
+	s.BasketSave(ctx, basket, 0)
+	s.BasketSave(ctx, deleted, 0)
+	s.BasketDelete(ctx, deleted.ID, 0)
+	expired := buildBasket("0c0d6f1e-1b0e-4b8f-9d53-3e0f8a4a7c21")
+	s.BasketSave(ctx, expired, 0)
+	s.BasketExpire(ctx, expired.ID, time.Now().Add(time.Hour), 0)
+	order := entities.NewOrder(*basket)
+	s.OrderSave(ctx, order)
+	book := &entities.Product{ID: "BOOK", Name: "Lana Book", Price: entities.NewMoney(1250, entities.DefaultCurrency)}
+	s.ProductSave(ctx, book)
+	s.ProductDelete(ctx, "MUG")
+	promotion := &entities.Promotion{ID: "10OFF", Reduction: 10}
+	s.PromotionSave(ctx, promotion)
+	s.PromotionDelete(ctx, "BUY3+GET25OFF")
+	coupon, _ := s.CouponGet(ctx, "WELCOME10")
+	coupon.Used = 3
+	s.CouponSave(ctx, coupon)
+	stock, _ := s.StockGet(ctx, "PEN")
+	stock.Reserve(basket.ID, 3, time.Now(), time.Now().Add(time.Hour))
+	s.StockSave(ctx, stock)
+
+	// When: reopen without closing, as after a crash
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sBasket, _ := recovered.BasketGet(ctx, basket.ID)
+	sDeleted, _ := recovered.BasketGet(ctx, deleted.ID)
+	_, expiredErr := recovered.BasketGet(ctx, expired.ID)
+	sOrder, _ := recovered.OrderGet(ctx, order.ID)
+	sBook, _ := recovered.ProductGet(ctx, book.ID)
+	sMug, _ := recovered.ProductGet(ctx, "MUG")
+	sPromotion, _ := recovered.PromotionGet(ctx, promotion.ID)
+	sDeletedPromotion, _ := recovered.PromotionGet(ctx, "BUY3+GET25OFF")
+	sCoupon, _ := recovered.CouponGet(ctx, coupon.Code)
+	sStock, _ := recovered.StockGet(ctx, stock.ProductID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, *basket, *sBasket)
+	assert.Equal(t, order.Items, sOrder.Items)
+	assert.Equal(t, *book, *sBook)
+	assert.Nil(t, sMug)
+	assert.Equal(t, *promotion, *sPromotion)
+	assert.Nil(t, sDeletedPromotion)
+	assert.Equal(t, *coupon, *sCoupon)
+	assert.Equal(t, stock.Reservations[basket.ID].Quantity, sStock.Reservations[basket.ID].Quantity)
+	assert.Equal(t, uint(3), sStock.Reserved)
+	assert.Equal(t, entities.NewMoney(500, entities.DefaultCurrency), sBasket.Items["PEN"].Discount)
+	assert.Nil(t, sDeleted)
+	assert.EqualError(t, expiredErr, "basket 0c0d6f1e-1b0e-4b8f-9d53-3e0f8a4a7c21 expired")
+}
+
+func Test_fileStorage_Recover_FromSnapshotAndLog(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	first := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	second := buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6")
+	s.BasketSave(ctx, first, 0)
+	errSnapshot := s.Snapshot()
+	s.BasketSave(ctx, second, 0)
+
+	// When
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sFirst, _ := recovered.BasketGet(ctx, first.ID)
+	sSecond, _ := recovered.BasketGet(ctx, second.ID)
+	products, _ := recovered.ProductList(ctx)
+
+	// Then
+	assert.Nil(t, errSnapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, *first, *sFirst)
+	assert.Equal(t, *second, *sSecond)
+	assert.Equal(t, 3, len(products))
+}
+
+func Test_fileStorage_Recover_FencingTokens(t *testing.T) {
+	// Given: one basket written before the snapshot and another after it
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	first := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	second := buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6")
+	s.BasketSave(ctx, first, 3)
+	s.Snapshot()
+	s.BasketSave(ctx, second, 7)
+
+	// When
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	errFirst := recovered.BasketSave(ctx, first, 2)
+	errSecond := recovered.BasketSave(ctx, second, 6)
+	errCurrent := recovered.BasketSave(ctx, second, 7)
+
+	// Then: the last accepted tokens are recovered
+	assert.Nil(t, err)
+	assert.EqualError(t, errFirst, "stale fencing token 2 for basket "+first.ID+", last accepted is 3")
+	assert.EqualError(t, errSecond, "stale fencing token 6 for basket "+second.ID+", last accepted is 7")
+	assert.Nil(t, errCurrent)
+}
+
+func Test_fileStorage_Recover_BasketEvents(t *testing.T) {
+	// Given: events appended before the snapshot, after it and in a transaction
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	s.BasketEventsAppend(ctx, basket.ID, []entities.BasketEvent{entities.NewBasketCreatedEvent(basket)})
+	s.Snapshot()
+	s.BasketEventsAppend(ctx, basket.ID, []entities.BasketEvent{entities.NewItemRemovedEvent(basket, "PEN", 1)})
+	s.WithTx(ctx, func(tx checkout.Storage) error {
+		return tx.BasketEventsAppend(ctx, basket.ID, []entities.BasketEvent{entities.NewBasketDeletedEvent(basket)})
+	})
+
+	// When
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	events, _ := recovered.BasketEventsGet(ctx, basket.ID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, entities.BasketEventCreated, events[0].Type)
+	assert.Equal(t, entities.BasketEventItemRemoved, events[1].Type)
+	assert.Equal(t, entities.BasketEventDeleted, events[2].Type)
+	assert.Equal(t, uint64(3), events[2].Sequence)
+}
+
+func Test_fileStorage_Recover_TornRecord(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	s.BasketSave(ctx, basket, 0)
+
+	// Simulate a crash in the middle of an append
+	wal, _ := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	wal.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	wal.Close()
+
+	// When
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sBasket, _ := recovered.BasketGet(ctx, basket.ID)
+	errSave := recovered.BasketSave(ctx, buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6"), 0)
+	again, errAgain := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sAgain, _ := again.BasketGet(ctx, "78235217-43fe-4e7a-8f18-e5f83df01ca6")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, *basket, *sBasket)
+	assert.Nil(t, errSave)
+	assert.Nil(t, errAgain)
+	assert.NotNil(t, sAgain)
+}
+
+func Test_fileStorage_WriteError_RollsBack(t *testing.T) {
+	// Given: a log that can't be written anymore
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	s.BasketSave(ctx, basket, 0)
+	stock, _ := s.StockGet(ctx, "PEN")
+	s.Close()
+
+	// When
+	errDelete := s.BasketDelete(ctx, basket.ID, 0)
+	changed := *stock
+	changed.OnHand = 0
+	errStock := s.StockSave(ctx, &changed)
+	sBasket, _ := s.BasketGet(ctx, basket.ID)
+	sStock, _ := s.StockGet(ctx, "PEN")
+
+	// Then: the writes failed & aren't served
+	assert.NotNil(t, errDelete)
+	assert.NotNil(t, errStock)
+	assert.NotNil(t, sBasket)
+	assert.Equal(t, stock.OnHand, sStock.OnHand)
+}
+
+func Test_fileStorage_Close_Snapshot(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	s.BasketSave(ctx, basket, 0)
+
+	// When
+	err := s.Close()
+	wal, _ := os.Stat(filepath.Join(dir, "wal.log"))
+	recovered, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sBasket, _ := recovered.BasketGet(ctx, basket.ID)
+
+	// Then
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), wal.Size())
+	assert.Equal(t, *basket, *sBasket)
+}
+
+func Test_fileStorage_SnapshotLoop_StopsOnContextDone(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 10*time.Millisecond, clock.NewClock())
+	s.BasketSave(ctx, buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"), 0)
+
+	// When
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	err := s.BasketSave(ctx, buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6"), 0)
+
+	// Then
+	_, errSnapshot := os.Stat(filepath.Join(dir, "snapshot.gob"))
+	assert.Nil(t, errSnapshot)
+	assert.NotNil(t, err)
+}
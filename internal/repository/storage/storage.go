@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/google/uuid"
@@ -11,38 +12,77 @@ import (
 	"time"
 )
 
+// fenceRetention is how long the fencing token of a deleted or expired basket is kept. It's far
+// longer than a lock TTL, so a lock holder paused until its lock expired can't write the basket
+// once the token is forgotten.
+const fenceRetention = time.Hour
+
 type storage struct {
-	data struct {
-		products   map[string]entities.Product
-		baskets    map[string]entities.Basket
-		promotions map[string]entities.Promotion
-	}
+	data  storageData
+	clock checkout.Clock // Same clock as the domain, so expirations agree with it
 	mutex struct {
 		product   sync.Mutex
 		basket    sync.Mutex
+		event     sync.Mutex
 		promotion sync.Mutex
+		coupon    sync.Mutex
+		order     sync.Mutex
+		stock     sync.Mutex
+		tx        sync.Mutex // Held by the running transaction
 	}
 }
 
-func NewStorage(ctx context.Context) *storage {
-	s := &storage{}
+type storageData struct {
+	products   map[string]entities.Product
+	baskets    map[string]entities.Basket
+	expired    map[string]time.Time // Expired baskets, until the end of their grace period
+	fences     map[string]uint64    // Last fencing token accepted by every basket
+	retired    map[string]time.Time // Fences of the deleted & expired baskets, until forgotten
+	events     map[string][]entities.BasketEvent
+	promotions map[string]entities.Promotion
+	coupons    map[string]entities.Coupon
+	orders     map[string]entities.Order
+	stocks     map[string]entities.Stock
+}
+
+func NewStorage(ctx context.Context, clock checkout.Clock) *storage {
+	s := &storage{clock: clock}
 	s.initializeData()
 	return s
 }
 
-func (s *storage) BasketSave(ctx context.Context, basket *entities.Basket) error {
+func (s *storage) BasketSave(ctx context.Context, basket *entities.Basket, fencingToken uint64) error {
 	// Lock basket map
 	s.mutex.basket.Lock()
 	defer s.mutex.basket.Unlock()
 
+	// Reject writes of a lock holder whose lock was taken since by another one
+	if err := s.checkFencingToken(basket.ID, fencingToken); err != nil {
+		return err
+	}
+
 	// Generate ID if needed
 	if basket.ID == "" {
 		basket.ID = uuid.New().String()
-		basket.CreatedAt = time.Now()
+		basket.CreatedAt = s.clock.Now()
+	}
+
+	// Compare & swap: the basket must be in the stored version, so a basket changed or deleted
+	// since it was read isn't overwritten
+	stored, ok := s.data.baskets[basket.ID]
+	if (ok && stored.Version != basket.Version) || (!ok && basket.Version != 0) {
+		err := fmt.Errorf("basket %s was modified concurrently, version %d is stale", basket.ID, basket.Version)
+		return lanaerr.New(err, http.StatusConflict)
 	}
+	basket.Version++
+	basket.LastModifiedAt = s.clock.Now().Round(0) // Without monotonic clock, as once persisted
 
-	// Save basket
-	s.data.baskets[basket.ID] = *basket
+	// Save basket. A copy is stored so later changes made by the caller doesn't affect the
+	// stored basket
+	s.data.baskets[basket.ID] = cloneBasket(*basket)
+	delete(s.data.expired, basket.ID)
+	delete(s.data.retired, basket.ID)
+	s.acceptFencingToken(basket.ID, fencingToken)
 
 	return nil
 }
@@ -54,24 +94,150 @@ func (s *storage) BasketGet(ctx context.Context, basketID string) (*entities.Bas
 
 	// Get basket from storage data
 	if basket, ok := s.data.baskets[basketID]; ok {
+		basket = cloneBasket(basket)
 		return &basket, nil
 	}
 
+	// Expired basket, during its grace period
+	if until, ok := s.data.expired[basketID]; ok && s.clock.Now().Before(until) {
+		return nil, lanaerr.New(fmt.Errorf("basket %s expired", basketID), http.StatusGone)
+	}
+
 	// Basket not found
 	return nil, lanaerr.New(fmt.Errorf("basket %s not found", basketID), http.StatusNotFound)
 }
 
-func (s *storage) BasketDelete(ctx context.Context, basketID string) error {
+func (s *storage) BasketDelete(ctx context.Context, basketID string, fencingToken uint64) error {
 	// Lock basket map
 	s.mutex.basket.Lock()
 	defer s.mutex.basket.Unlock()
 
-	// Delete
+	// Reject writes of a lock holder whose lock was taken since by another one
+	if err := s.checkFencingToken(basketID, fencingToken); err != nil {
+		return err
+	}
+
+	// Delete. The fencing token is kept for a while, so an older holder can't save the basket again
 	delete(s.data.baskets, basketID)
+	s.acceptFencingToken(basketID, fencingToken)
+	s.retireFencingToken(basketID)
+	s.forgetBaskets()
+
+	return nil
+}
+
+func (s *storage) BasketListIdle(ctx context.Context, since time.Time) ([]entities.Basket, error) {
+	// Lock basket map
+	s.mutex.basket.Lock()
+	defer s.mutex.basket.Unlock()
+
+	// Get the open baskets not modified since the given time. Checked out baskets are kept
+	baskets := make([]entities.Basket, 0)
+	for _, basket := range s.data.baskets {
+		if !basket.IsCheckedOut() && basket.IdleSince().Before(since) {
+			baskets = append(baskets, cloneBasket(basket))
+		}
+	}
+
+	return baskets, nil
+}
+
+func (s *storage) BasketExpire(ctx context.Context, basketID string, graceUntil time.Time, fencingToken uint64) error {
+	// Lock basket map
+	s.mutex.basket.Lock()
+	defer s.mutex.basket.Unlock()
+
+	// Reject writes of a lock holder whose lock was taken since by another one
+	if err := s.checkFencingToken(basketID, fencingToken); err != nil {
+		return err
+	}
+
+	// Delete basket, remembering it expired until the end of the grace period
+	delete(s.data.baskets, basketID)
+	s.data.expired[basketID] = graceUntil
+	s.acceptFencingToken(basketID, fencingToken)
+	s.retireFencingToken(basketID)
+	s.forgetBaskets()
+
+	return nil
+}
+
+// forgetBaskets forgets the expired baskets whose grace period ended, and the fencing tokens of
+// the deleted & expired baskets after the retention. Must be called holding the basket mutex.
+func (s *storage) forgetBaskets() {
+	now := s.clock.Now()
+	for id, until := range s.data.expired {
+		if !now.Before(until) {
+			delete(s.data.expired, id)
+		}
+	}
+	for id, until := range s.data.retired {
+		if !now.Before(until) {
+			delete(s.data.retired, id)
+			delete(s.data.fences, id)
+		}
+	}
+}
+
+func (s *storage) BasketEventsAppend(ctx context.Context, basketID string, events []entities.BasketEvent) error {
+	// Lock event map
+	s.mutex.event.Lock()
+	defer s.mutex.event.Unlock()
+
+	// Number the events after the last one of the basket
+	history := s.data.events[basketID]
+	for i := range events {
+		events[i].BasketID = basketID
+		events[i].Sequence = uint64(len(history) + i + 1)
+	}
+
+	// Append. The stored history is never changed in place, a new slice is stored so the
+	// histories returned before aren't affected
+	appended := make([]entities.BasketEvent, 0, len(history)+len(events))
+	appended = append(append(appended, history...), events...)
+	s.data.events[basketID] = appended
 
 	return nil
 }
 
+func (s *storage) BasketEventsGet(ctx context.Context, basketID string) ([]entities.BasketEvent, error) {
+	// Lock event map
+	s.mutex.event.Lock()
+	defer s.mutex.event.Unlock()
+
+	// Get basket history from storage data
+	if history, ok := s.data.events[basketID]; ok {
+		return append([]entities.BasketEvent{}, history...), nil
+	}
+
+	// History not found
+	return nil, lanaerr.New(fmt.Errorf("history of basket %s not found", basketID), http.StatusNotFound)
+}
+
+// checkFencingToken checks the token isn't older than the last one accepted by the basket. Must
+// be called holding the basket mutex.
+func (s *storage) checkFencingToken(basketID string, fencingToken uint64) error {
+	if last := s.data.fences[basketID]; fencingToken < last {
+		err := fmt.Errorf("stale fencing token %d for basket %s, last accepted is %d", fencingToken, basketID, last)
+		return lanaerr.New(err, http.StatusConflict)
+	}
+	return nil
+}
+
+// acceptFencingToken records the token as the last accepted by the basket. Must be called
+// holding the basket mutex.
+func (s *storage) acceptFencingToken(basketID string, fencingToken uint64) {
+	if fencingToken > s.data.fences[basketID] {
+		s.data.fences[basketID] = fencingToken
+	}
+}
+
+// retireFencingToken keeps the token of a basket no longer stored until the end of the
+// retention. Must be called holding the basket mutex.
+func (s *storage) retireFencingToken(basketID string) {
+	s.data.retired[basketID] = s.clock.Now().Add(fenceRetention)
+}
+
 func (s *storage) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
 	// Lock product map
 	s.mutex.product.Lock()
@@ -100,6 +266,28 @@ func (s *storage) ProductList(ctx context.Context) ([]entities.Product, error) {
 	return products, nil
 }
 
+func (s *storage) ProductSave(ctx context.Context, product *entities.Product) error {
+	// Lock product map
+	s.mutex.product.Lock()
+	defer s.mutex.product.Unlock()
+
+	// Save product
+	s.data.products[product.ID] = *product
+
+	return nil
+}
+
+func (s *storage) ProductDelete(ctx context.Context, productID string) error {
+	// Lock product map
+	s.mutex.product.Lock()
+	defer s.mutex.product.Unlock()
+
+	// Delete
+	delete(s.data.products, productID)
+
+	return nil
+}
+
 func (s *storage) PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error) {
 	// Lock promotion map
 	s.mutex.promotion.Lock()
@@ -113,3 +301,170 @@ func (s *storage) PromotionGet(ctx context.Context, promotionID string) (*entiti
 	// Promotion not found
 	return nil, lanaerr.New(fmt.Errorf("promotion %s not found", promotionID), http.StatusNotFound)
 }
+
+func (s *storage) PromotionList(ctx context.Context) ([]entities.Promotion, error) {
+	// Lock promotion map
+	s.mutex.promotion.Lock()
+	defer s.mutex.promotion.Unlock()
+
+	// Get all promotions
+	promotions := make([]entities.Promotion, 0)
+	for _, p := range s.data.promotions {
+		promotions = append(promotions, p)
+	}
+
+	return promotions, nil
+}
+
+func (s *storage) PromotionSave(ctx context.Context, promotion *entities.Promotion) error {
+	// Lock promotion map
+	s.mutex.promotion.Lock()
+	defer s.mutex.promotion.Unlock()
+
+	// Save promotion
+	s.data.promotions[promotion.ID] = *promotion
+
+	return nil
+}
+
+func (s *storage) PromotionDelete(ctx context.Context, promotionID string) error {
+	// Lock promotion map
+	s.mutex.promotion.Lock()
+	defer s.mutex.promotion.Unlock()
+
+	// Delete
+	delete(s.data.promotions, promotionID)
+
+	return nil
+}
+
+func (s *storage) CouponGet(ctx context.Context, code string) (*entities.Coupon, error) {
+	// Lock coupon map
+	s.mutex.coupon.Lock()
+	defer s.mutex.coupon.Unlock()
+
+	// Get coupon from storage data
+	if coupon, ok := s.data.coupons[code]; ok {
+		return &coupon, nil
+	}
+
+	// Coupon not found
+	return nil, lanaerr.New(fmt.Errorf("coupon %s not found", code), http.StatusNotFound)
+}
+
+func (s *storage) CouponSave(ctx context.Context, coupon *entities.Coupon) error {
+	// Lock coupon map
+	s.mutex.coupon.Lock()
+	defer s.mutex.coupon.Unlock()
+
+	// Save coupon
+	s.data.coupons[coupon.Code] = *coupon
+
+	return nil
+}
+
+func (s *storage) OrderSave(ctx context.Context, order *entities.Order) error {
+	// Lock order map
+	s.mutex.order.Lock()
+	defer s.mutex.order.Unlock()
+
+	// Generate ID if needed
+	if order.ID == "" {
+		order.ID = uuid.New().String()
+		order.CreatedAt = s.clock.Now()
+	}
+	order.UpdatedAt = s.clock.Now()
+
+	// Save order
+	s.data.orders[order.ID] = cloneOrder(*order)
+
+	return nil
+}
+
+func (s *storage) OrderGet(ctx context.Context, orderID string) (*entities.Order, error) {
+	// Lock order map
+	s.mutex.order.Lock()
+	defer s.mutex.order.Unlock()
+
+	// Get order from storage data
+	if order, ok := s.data.orders[orderID]; ok {
+		order = cloneOrder(order)
+		return &order, nil
+	}
+
+	// Order not found
+	return nil, lanaerr.New(fmt.Errorf("order %s not found", orderID), http.StatusNotFound)
+}
+
+func (s *storage) StockGet(ctx context.Context, productID string) (*entities.Stock, error) {
+	// Lock stock map
+	s.mutex.stock.Lock()
+	defer s.mutex.stock.Unlock()
+
+	// Get stock from storage data
+	if stock, ok := s.data.stocks[productID]; ok {
+		stock = cloneStock(stock)
+		return &stock, nil
+	}
+
+	// Stock not found
+	return nil, lanaerr.New(fmt.Errorf("stock of product %s not found", productID), http.StatusNotFound)
+}
+
+func (s *storage) StockSave(ctx context.Context, stock *entities.Stock) error {
+	// Lock stock map
+	s.mutex.stock.Lock()
+	defer s.mutex.stock.Unlock()
+
+	// Save stock
+	s.data.stocks[stock.ProductID] = cloneStock(*stock)
+
+	return nil
+}
+
+func cloneBasket(basket entities.Basket) entities.Basket {
+	if basket.Items != nil {
+		items := make(map[string]entities.BasketItem, len(basket.Items))
+		for id, item := range basket.Items {
+			items[id] = item
+		}
+		basket.Items = items
+	}
+	if basket.Discounts != nil {
+		basket.Discounts = append([]entities.BasketDiscount{}, basket.Discounts...)
+	}
+	if basket.Promotions != nil {
+		basket.Promotions = append([]entities.Promotion{}, basket.Promotions...)
+	}
+	if basket.Coupons != nil {
+		basket.Coupons = append([]entities.AppliedCoupon{}, basket.Coupons...)
+	}
+	if basket.AppliedPromotions != nil {
+		basket.AppliedPromotions = append([]entities.AppliedPromotion{}, basket.AppliedPromotions...)
+	}
+	return basket
+}
+
+func cloneOrder(order entities.Order) entities.Order {
+	if order.Items != nil {
+		order.Items = append([]entities.OrderItem{}, order.Items...)
+	}
+	if order.Discounts != nil {
+		order.Discounts = append([]entities.BasketDiscount{}, order.Discounts...)
+	}
+	if order.Coupons != nil {
+		order.Coupons = append([]entities.AppliedCoupon{}, order.Coupons...)
+	}
+	return order
+}
+
+func cloneStock(stock entities.Stock) entities.Stock {
+	if stock.Reservations != nil {
+		reservations := make(map[string]entities.StockReservation, len(stock.Reservations))
+		for basketID, reservation := range stock.Reservations {
+			reservations[basketID] = reservation
+		}
+		stock.Reservations = reservations
+	}
+	return stock
+}
@@ -3,146 +3,632 @@ package storage_test
 import (
 	"context"
 	"encoding/json"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/clock"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/storage"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"testing"
 	"time"
 )
 
-func Test_storage_BasketGet_NotFound(t *testing.T) {
-	// Given
+// fakeClock is a clock at the time set by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// buildStorages returns all the Storage implementations, so every test runs against each of them.
+func buildStorages(t *testing.T) map[string]checkout.Storage {
+	return buildStoragesWithClock(t, clock.NewClock())
+}
+
+func buildStoragesWithClock(t *testing.T, clock checkout.Clock) map[string]checkout.Storage {
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
 
-	// When
-	b, err := s.BasketGet(ctx, "78235217-43fe-4e7a-8f18-e5f83df01ca6")
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fileStorage, err := storage.NewFileStorage(ctx, dir, 0, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fileStorage.Close() })
 
-	// Then
-	assert.EqualError(t, err, "basket 78235217-43fe-4e7a-8f18-e5f83df01ca6 not found")
-	assert.Nil(t, b)
+	return map[string]checkout.Storage{
+		"memory": storage.NewStorage(ctx, clock),
+		"file":   fileStorage,
+	}
+}
+
+func Test_storage_BasketGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			b, err := s.BasketGet(ctx, "78235217-43fe-4e7a-8f18-e5f83df01ca6")
+
+			// Then
+			assert.EqualError(t, err, "basket 78235217-43fe-4e7a-8f18-e5f83df01ca6 not found")
+			assert.Nil(t, b)
+		})
+	}
 }
 
 func Test_storage_BasketSave_NewBasket_Success(t *testing.T) {
-	// Given
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
-	basket := &entities.Basket{}
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{}
 
-	// When
-	err := s.BasketSave(ctx, basket)
-	sBasket, _ := s.BasketGet(ctx, basket.ID)
+			// When
+			err := s.BasketSave(ctx, basket, 0)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
 
-	// Then
-	assert.Nil(t, err)
-	assert.NotEmpty(t, basket.ID)
-	assert.Equal(t, *basket, *sBasket)
+			// Then
+			assert.Nil(t, err)
+			assert.NotEmpty(t, basket.ID)
+			assert.Equal(t, *basket, *sBasket)
+		})
+	}
 }
 
 func Test_storage_BasketSave_ExistingBasket_Success(t *testing.T) {
-	// Given
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
-	basket := &entities.Basket{
-		ID:        "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f",
-		CreatedAt: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
-		Total:     100,
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{
+				ID:        "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f",
+				CreatedAt: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+				Total:     entities.NewMoney(10000, entities.DefaultCurrency),
+			}
+
+			// When
+			err := s.BasketSave(ctx, basket, 0)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then
+			assert.Nil(t, err)
+			assert.Equal(t, *basket, *sBasket)
+		})
+	}
+}
+
+func Test_storage_BasketSave_Version(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given: two copies of the same version
+			basket := &entities.Basket{}
+			err := s.BasketSave(ctx, basket, 0)
+			stale := *basket
+
+			// When
+			err = s.BasketSave(ctx, basket, 0)
+			staleErr := s.BasketSave(ctx, &stale, 0)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then: the stale copy isn't saved
+			assert.Nil(t, err)
+			assert.Equal(t, uint64(2), basket.Version)
+			assert.EqualError(t, staleErr, "basket "+basket.ID+" was modified concurrently, version 1 is stale")
+			assert.Equal(t, http.StatusConflict, lanaerr.FromErr(staleErr).GetStatusCode())
+			assert.Equal(t, *basket, *sBasket)
+		})
+	}
+}
+
+func Test_storage_BasketSave_DeletedBasket_Conflict(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{}
+			err := s.BasketSave(ctx, basket, 0)
+			err = s.BasketDelete(ctx, basket.ID, 0)
+
+			// When
+			err = s.BasketSave(ctx, basket, 0)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then: the deleted basket isn't saved again
+			assert.Equal(t, http.StatusConflict, lanaerr.FromErr(err).GetStatusCode())
+			assert.Nil(t, sBasket)
+		})
 	}
+}
 
-	// When
-	err := s.BasketSave(ctx, basket)
-	sBasket, _ := s.BasketGet(ctx, basket.ID)
+func Test_storage_BasketSave_StaleFencingToken(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given: a basket saved by the holder of the lock with token 2
+			basket := &entities.Basket{}
+			err := s.BasketSave(ctx, basket, 2)
+			stale := *basket
+
+			// When: the holder of the previous lock saves, then the current holder again
+			staleErr := s.BasketSave(ctx, &stale, 1)
+			err = s.BasketSave(ctx, basket, 2)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
 
-	// Then
-	assert.Nil(t, err)
-	assert.Equal(t, *basket, *sBasket)
+			// Then
+			assert.EqualError(t, staleErr, "stale fencing token 1 for basket "+basket.ID+", last accepted is 2")
+			assert.Equal(t, http.StatusConflict, lanaerr.FromErr(staleErr).GetStatusCode())
+			assert.Nil(t, err)
+			assert.Equal(t, *basket, *sBasket)
+		})
+	}
+}
+
+func Test_storage_BasketDelete_StaleFencingToken(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{}
+			err := s.BasketSave(ctx, basket, 5)
+
+			// When
+			staleErr := s.BasketDelete(ctx, basket.ID, 4)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+			err = s.BasketDelete(ctx, basket.ID, 6)
+			saveErr := s.BasketSave(ctx, &entities.Basket{ID: basket.ID}, 5)
+
+			// Then: the basket is deleted only with a newer token, which is kept after the delete
+			assert.Equal(t, http.StatusConflict, lanaerr.FromErr(staleErr).GetStatusCode())
+			assert.NotNil(t, sBasket)
+			assert.Nil(t, err)
+			assert.EqualError(t, saveErr, "stale fencing token 5 for basket "+basket.ID+", last accepted is 6")
+		})
+	}
 }
 
 func Test_storage_BasketDelete_Success(t *testing.T) {
-	// Given
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
-	basket := &entities.Basket{
-		ID:        "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f",
-		CreatedAt: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
-		Total:     100,
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{
+				ID:        "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f",
+				CreatedAt: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+				Total:     entities.NewMoney(10000, entities.DefaultCurrency),
+			}
+			err := s.BasketSave(ctx, basket, 0)
+
+			// When
+			err = s.BasketDelete(ctx, basket.ID, 0)
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then
+			assert.Nil(t, err)
+			assert.Nil(t, sBasket)
+		})
 	}
-	err := s.BasketSave(ctx, basket)
+}
+
+func Test_storage_BasketListIdle_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			idle := &entities.Basket{ID: "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"}
+			s.BasketSave(ctx, idle, 0)
+			checkedOutAt := time.Now()
+			checkedOut := &entities.Basket{ID: "5c1e0b4f-2a7d-4f0e-9d8a-6b3c2e1f0a9b", CheckedOutAt: &checkedOutAt}
+			s.BasketSave(ctx, checkedOut, 0)
+			since := time.Now()
+			active := &entities.Basket{ID: "78235217-43fe-4e7a-8f18-e5f83df01ca6"}
+			s.BasketSave(ctx, active, 0)
 
-	// When
-	err = s.BasketDelete(ctx, basket.ID)
-	sBasket, _ := s.BasketGet(ctx, basket.ID)
+			// When
+			baskets, err := s.BasketListIdle(ctx, since)
 
-	// Then
-	assert.Nil(t, err)
-	assert.Nil(t, sBasket)
+			// Then: only the open idle basket is listed
+			assert.Nil(t, err)
+			assert.Len(t, baskets, 1)
+			assert.Equal(t, idle.ID, baskets[0].ID)
+			assert.False(t, active.LastModifiedAt.Before(since))
+		})
+	}
 }
 
-func Test_storage_ProductGet_Success(t *testing.T) {
-	// Given
+func Test_storage_BasketExpire_Success(t *testing.T) {
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			expired := &entities.Basket{ID: "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"}
+			forgotten := &entities.Basket{ID: "78235217-43fe-4e7a-8f18-e5f83df01ca6"}
+			s.BasketSave(ctx, expired, 0)
+			s.BasketSave(ctx, forgotten, 0)
 
-	// When
-	p, err := s.ProductGet(ctx, "PEN")
-	jsonP, _ := json.Marshal(p)
+			// When
+			err := s.BasketExpire(ctx, expired.ID, time.Now().Add(time.Hour), 0)
+			s.BasketExpire(ctx, forgotten.ID, time.Now(), 0)
+			sExpired, expiredErr := s.BasketGet(ctx, expired.ID)
+			sForgotten, forgottenErr := s.BasketGet(ctx, forgotten.ID)
 
-	// Then
-	expectedProduct := `{"id":"PEN","name":"Lana Pen","price":5,"promotion_id":"BUY2GET1FREE"}`
-	assert.Equal(t, expectedProduct, string(jsonP))
-	assert.Nil(t, err)
+			// Then: 410 during the grace period, 404 after it
+			assert.Nil(t, err)
+			assert.Nil(t, sExpired)
+			assert.EqualError(t, expiredErr, "basket cf31bf2b-42a3-4cb5-ae51-34fbe30d163f expired")
+			assert.Equal(t, http.StatusGone, lanaerr.FromErr(expiredErr).GetStatusCode())
+			assert.Nil(t, sForgotten)
+			assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(forgottenErr).GetStatusCode())
+		})
+	}
 }
 
-func Test_storage_ProductGet_NotFound(t *testing.T) {
-	// Given
+func Test_storage_BasketExpire_Clock(t *testing.T) {
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
+	c := &fakeClock{now: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)}
+	for name, s := range buildStoragesWithClock(t, c) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			c.now = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+			basket := &entities.Basket{ID: "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"}
+			s.BasketSave(ctx, basket, 0)
+			s.BasketExpire(ctx, basket.ID, c.now.Add(time.Hour), 0)
 
-	// When
-	p, err := s.ProductGet(ctx, "BOOK")
+			// When
+			_, duringGraceErr := s.BasketGet(ctx, basket.ID)
+			c.now = c.now.Add(2 * time.Hour)
+			_, afterGraceErr := s.BasketGet(ctx, basket.ID)
 
-	// Then
-	assert.EqualError(t, err, "product BOOK not found")
-	assert.Nil(t, p)
+			// Then: the times are taken from the clock
+			assert.Equal(t, time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC), basket.LastModifiedAt)
+			assert.Equal(t, http.StatusGone, lanaerr.FromErr(duringGraceErr).GetStatusCode())
+			assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(afterGraceErr).GetStatusCode())
+		})
+	}
 }
 
-func Test_storage_ProductList_Success(t *testing.T) {
-	// Given
+func Test_storage_BasketDelete_FencingTokenForgotten(t *testing.T) {
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
+	c := &fakeClock{now: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)}
+	for name, s := range buildStoragesWithClock(t, c) {
+		t.Run(name, func(t *testing.T) {
+			// Given: a deleted basket
+			c.now = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+			basket := &entities.Basket{ID: "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"}
+			other := &entities.Basket{ID: "78235217-43fe-4e7a-8f18-e5f83df01ca6"}
+			s.BasketSave(ctx, basket, 5)
+			s.BasketSave(ctx, other, 5)
+			s.BasketDelete(ctx, basket.ID, 6)
 
-	// When
-	list, err := s.ProductList(ctx)
+			// When: another basket is deleted after the retention
+			retainedErr := s.BasketSave(ctx, &entities.Basket{ID: basket.ID}, 5)
+			c.now = c.now.Add(2 * time.Hour)
+			s.BasketDelete(ctx, other.ID, 6)
+			forgottenErr := s.BasketSave(ctx, &entities.Basket{ID: basket.ID}, 5)
 
-	// Then
-	assert.Equal(t, 3, len(list))
-	assert.Nil(t, err)
+			// Then: the token of the basket is forgotten
+			assert.EqualError(t, retainedErr, "stale fencing token 5 for basket "+basket.ID+", last accepted is 6")
+			assert.Nil(t, forgottenErr)
+		})
+	}
 }
 
-func Test_storage_PromotionGet_Success(t *testing.T) {
-	// Given
+func Test_storage_BasketEventsAppend_Success(t *testing.T) {
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basketID := "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f"
+			s.BasketEventsAppend(ctx, basketID, []entities.BasketEvent{{Type: entities.BasketEventCreated}})
+			before, _ := s.BasketEventsGet(ctx, basketID)
 
-	// When
-	promotion, err := s.PromotionGet(ctx, "BUY2GET1FREE")
-	jsonPromotion, _ := json.Marshal(promotion)
+			// When
+			err := s.BasketEventsAppend(ctx, basketID, []entities.BasketEvent{
+				{Type: entities.BasketEventItemAdded, ProductID: "PEN", Quantity: 3},
+				{Type: entities.BasketEventItemRemoved, ProductID: "PEN", Quantity: 1},
+			})
+			events, getErr := s.BasketEventsGet(ctx, basketID)
 
-	// Then
-	expectedDiscount := `{"id":"BUY2GET1FREE","required_items":2,"free_items":1,"reduction":0}`
-	assert.Equal(t, expectedDiscount, string(jsonPromotion))
-	assert.Nil(t, err)
+			// Then: numbered after the last event, without changing the histories got before
+			assert.Nil(t, err)
+			assert.Nil(t, getErr)
+			assert.Equal(t, 1, len(before))
+			assert.Equal(t, 3, len(events))
+			for i, event := range events {
+				assert.Equal(t, basketID, event.BasketID)
+				assert.Equal(t, uint64(i+1), event.Sequence)
+			}
+			assert.Equal(t, entities.BasketEventItemRemoved, events[2].Type)
+		})
+	}
+}
+
+func Test_storage_BasketEventsGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			events, err := s.BasketEventsGet(ctx, "cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+
+			// Then
+			assert.Nil(t, events)
+			assert.EqualError(t, err, "history of basket cf31bf2b-42a3-4cb5-ae51-34fbe30d163f not found")
+			assert.Equal(t, http.StatusNotFound, lanaerr.FromErr(err).GetStatusCode())
+		})
+	}
+}
+
+func Test_storage_ProductGet_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			p, err := s.ProductGet(ctx, "PEN")
+			jsonP, _ := json.Marshal(p)
+
+			// Then
+			expectedProduct := `{"id":"PEN","name":"Lana Pen","price":{"amount":500,"currency":"EUR"},"promotion_ids":["BUY2GET1FREE"]}`
+			assert.Equal(t, expectedProduct, string(jsonP))
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_storage_ProductGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			p, err := s.ProductGet(ctx, "BOOK")
+
+			// Then
+			assert.EqualError(t, err, "product BOOK not found")
+			assert.Nil(t, p)
+		})
+	}
+}
+
+func Test_storage_ProductList_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			list, err := s.ProductList(ctx)
+
+			// Then
+			assert.Equal(t, 3, len(list))
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_storage_PromotionGet_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			promotion, err := s.PromotionGet(ctx, "BUY2GET1FREE")
+			jsonPromotion, _ := json.Marshal(promotion)
+
+			// Then
+			expectedDiscount := `{"id":"BUY2GET1FREE","required_items":2,"free_items":1,"reduction":0}`
+			assert.Equal(t, expectedDiscount, string(jsonPromotion))
+			assert.Nil(t, err)
+		})
+	}
 }
 
 func Test_storage_PromotionGet_NotFound(t *testing.T) {
-	// Given
 	ctx := context.Background()
-	s := storage.NewStorage(ctx)
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			d, err := s.PromotionGet(ctx, "3X2")
+
+			// Then
+			assert.EqualError(t, err, "promotion 3X2 not found")
+			assert.Nil(t, d)
+		})
+	}
+}
+
+func Test_storage_OrderSave_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			order := entities.NewOrder(*entities.NewBasket())
+
+			// When
+			err := s.OrderSave(ctx, order)
+			sOrder, _ := s.OrderGet(ctx, order.ID)
+
+			// Then
+			assert.Nil(t, err)
+			assert.NotEmpty(t, order.ID)
+			assert.False(t, order.CreatedAt.IsZero())
+			assert.Equal(t, *order, *sOrder)
+		})
+	}
+}
+
+func Test_storage_OrderGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			o, err := s.OrderGet(ctx, "78235217-43fe-4e7a-8f18-e5f83df01ca6")
+
+			// Then
+			assert.EqualError(t, err, "order 78235217-43fe-4e7a-8f18-e5f83df01ca6 not found")
+			assert.Nil(t, o)
+		})
+	}
+}
+
+func Test_storage_ProductSave_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			product := &entities.Product{
+				ID:    "BOOK",
+				Name:  "Lana Book",
+				Price: entities.NewMoney(1250, entities.DefaultCurrency),
+			}
+
+			// When
+			err := s.ProductSave(ctx, product)
+			sProduct, _ := s.ProductGet(ctx, product.ID)
+			list, _ := s.ProductList(ctx)
+
+			// Then
+			assert.Nil(t, err)
+			assert.Equal(t, *product, *sProduct)
+			assert.Equal(t, 4, len(list))
+		})
+	}
+}
+
+func Test_storage_ProductDelete_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			err := s.ProductDelete(ctx, "PEN")
+			p, errGet := s.ProductGet(ctx, "PEN")
+
+			// Then
+			assert.Nil(t, err)
+			assert.EqualError(t, errGet, "product PEN not found")
+			assert.Nil(t, p)
+		})
+	}
+}
+
+func Test_storage_PromotionList_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			list, err := s.PromotionList(ctx)
+
+			// Then
+			assert.Equal(t, 2, len(list))
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_storage_PromotionSave_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			promotion := &entities.Promotion{ID: "10OFF", Reduction: 10}
+
+			// When
+			err := s.PromotionSave(ctx, promotion)
+			sPromotion, _ := s.PromotionGet(ctx, promotion.ID)
+
+			// Then
+			assert.Nil(t, err)
+			assert.Equal(t, *promotion, *sPromotion)
+		})
+	}
+}
+
+func Test_storage_PromotionDelete_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			err := s.PromotionDelete(ctx, "BUY2GET1FREE")
+			p, errGet := s.PromotionGet(ctx, "BUY2GET1FREE")
+
+			// Then
+			assert.Nil(t, err)
+			assert.EqualError(t, errGet, "promotion BUY2GET1FREE not found")
+			assert.Nil(t, p)
+		})
+	}
+}
+
+func Test_storage_CouponGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			coupon, err := s.CouponGet(ctx, "UNKNOWN")
+
+			// Then
+			assert.EqualError(t, err, "coupon UNKNOWN not found")
+			assert.Nil(t, coupon)
+		})
+	}
+}
+
+func Test_storage_CouponSave_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			coupon, _ := s.CouponGet(ctx, "WELCOME10")
+			coupon.Used++
+
+			// When
+			err := s.CouponSave(ctx, coupon)
+			sCoupon, _ := s.CouponGet(ctx, coupon.Code)
+
+			// Then
+			assert.Nil(t, err)
+			assert.Equal(t, uint(1), sCoupon.Used)
+		})
+	}
+}
+
+func Test_storage_StockGet_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// When
+			stock, err := s.StockGet(ctx, "UNKNOWN")
 
-	// When
-	d, err := s.PromotionGet(ctx, "3X2")
+			// Then
+			assert.EqualError(t, err, "stock of product UNKNOWN not found")
+			assert.Nil(t, stock)
+		})
+	}
+}
 
-	// Then
-	assert.EqualError(t, err, "promotion 3X2 not found")
-	assert.Nil(t, d)
+func Test_storage_StockSave_Success(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			now := time.Now()
+			stock, _ := s.StockGet(ctx, "PEN")
+			stock.Reserve("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f", 3, now, now.Add(time.Hour))
+
+			// When
+			err := s.StockSave(ctx, stock)
+			stock.Release("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f", now)
+			sStock, _ := s.StockGet(ctx, "PEN")
+
+			// Then: later changes of the caller don't affect the stored stock
+			assert.Nil(t, err)
+			assert.Equal(t, uint(1000), sStock.OnHand)
+			assert.Equal(t, uint(3), sStock.Reserved)
+			assert.Len(t, sStock.Reservations, 1)
+		})
+	}
 }
@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"context"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/google/uuid"
+	"time"
+)
+
+// NOTE: A transaction(WithTx) writes straight to the storage data, keeping for every write a
+// function that restores the previous state of the entity. If the unit of work fails or panics
+// the undo functions are run in reverse order, so no half written state is left. Transactions
+// are run one at a time, but their writes are seen by the readers outside of them before they
+// finish: the domain locks the entities it changes for that. Fencing tokens aren't rolled back,
+// the lock holder of the transaction is still the last one.
+
+type tx struct {
+	*storage
+	undo []func()
+	redo []walRecord // Writes of the transaction, logged by the file storage once it succeeds
+}
+
+func (s *storage) WithTx(ctx context.Context, fn func(tx checkout.Storage) error) error {
+	return s.runTx(fn, nil)
+}
+
+// runTx runs the unit of work in a transaction. If it succeeds, commit is called with its writes
+// and the transaction is rolled back if commit fails.
+func (s *storage) runTx(fn func(tx checkout.Storage) error, commit func(redo []walRecord) error) error {
+	s.mutex.tx.Lock()
+	defer s.mutex.tx.Unlock()
+
+	t := &tx{storage: s}
+	defer func() {
+		if r := recover(); r != nil {
+			t.rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(t); err != nil {
+		t.rollback()
+		return err
+	}
+
+	if commit != nil {
+		if err := commit(t.redo); err != nil {
+			t.rollback()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithTx runs the unit of work as part of the transaction, so it's rolled back with it.
+func (t *tx) WithTx(ctx context.Context, fn func(tx checkout.Storage) error) error {
+	return fn(t)
+}
+
+func (t *tx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo, t.redo = nil, nil
+}
+
+// written records a successful write of the transaction.
+func (t *tx) written(undo func(), rec walRecord) {
+	t.undo = append(t.undo, undo)
+	t.redo = append(t.redo, rec)
+}
+
+func (t *tx) BasketSave(ctx context.Context, basket *entities.Basket, fencingToken uint64) error {
+	// Generate ID here, so the basket to restore is known
+	if basket.ID == "" {
+		basket.ID = uuid.New().String()
+		basket.CreatedAt = t.clock.Now()
+	}
+
+	undo := t.basketUndo(basket.ID)
+	if err := t.storage.BasketSave(ctx, basket, fencingToken); err != nil {
+		return err
+	}
+
+	saved := cloneBasket(*basket)
+	t.written(undo, walRecord{Operation: walOpBasketSave, Key: basket.ID, Basket: &saved, FencingToken: fencingToken})
+	return nil
+}
+
+func (t *tx) BasketDelete(ctx context.Context, basketID string, fencingToken uint64) error {
+	undo := t.basketUndo(basketID)
+	if err := t.storage.BasketDelete(ctx, basketID, fencingToken); err != nil {
+		return err
+	}
+
+	t.written(undo, walRecord{Operation: walOpBasketDelete, Key: basketID, FencingToken: fencingToken})
+	return nil
+}
+
+func (t *tx) BasketExpire(ctx context.Context, basketID string, graceUntil time.Time, fencingToken uint64) error {
+	undo := t.basketUndo(basketID)
+	if err := t.storage.BasketExpire(ctx, basketID, graceUntil, fencingToken); err != nil {
+		return err
+	}
+
+	t.written(undo, walRecord{
+		Operation:    walOpBasketExpire,
+		Key:          basketID,
+		GraceUntil:   graceUntil,
+		FencingToken: fencingToken,
+	})
+	return nil
+}
+
+func (t *tx) BasketEventsAppend(ctx context.Context, basketID string, events []entities.BasketEvent) error {
+	undo := t.eventsUndo(basketID)
+	if err := t.storage.BasketEventsAppend(ctx, basketID, events); err != nil {
+		return err
+	}
+
+	appended := append([]entities.BasketEvent{}, events...)
+	t.written(undo, walRecord{Operation: walOpBasketEvents, Key: basketID, Events: appended})
+	return nil
+}
+
+func (t *tx) ProductSave(ctx context.Context, product *entities.Product) error {
+	undo := t.productUndo(product.ID)
+	if err := t.storage.ProductSave(ctx, product); err != nil {
+		return err
+	}
+
+	saved := *product
+	t.written(undo, walRecord{Operation: walOpProductSave, Key: product.ID, Product: &saved})
+	return nil
+}
+
+func (t *tx) ProductDelete(ctx context.Context, productID string) error {
+	undo := t.productUndo(productID)
+	if err := t.storage.ProductDelete(ctx, productID); err != nil {
+		return err
+	}
+
+	t.written(undo, walRecord{Operation: walOpProductDelete, Key: productID})
+	return nil
+}
+
+func (t *tx) PromotionSave(ctx context.Context, promotion *entities.Promotion) error {
+	undo := t.promotionUndo(promotion.ID)
+	if err := t.storage.PromotionSave(ctx, promotion); err != nil {
+		return err
+	}
+
+	saved := *promotion
+	t.written(undo, walRecord{Operation: walOpPromotionSave, Key: promotion.ID, Promotion: &saved})
+	return nil
+}
+
+func (t *tx) PromotionDelete(ctx context.Context, promotionID string) error {
+	undo := t.promotionUndo(promotionID)
+	if err := t.storage.PromotionDelete(ctx, promotionID); err != nil {
+		return err
+	}
+
+	t.written(undo, walRecord{Operation: walOpPromotionDelete, Key: promotionID})
+	return nil
+}
+
+func (t *tx) CouponSave(ctx context.Context, coupon *entities.Coupon) error {
+	undo := t.couponUndo(coupon.Code)
+	if err := t.storage.CouponSave(ctx, coupon); err != nil {
+		return err
+	}
+
+	saved := *coupon
+	t.written(undo, walRecord{Operation: walOpCouponSave, Key: coupon.Code, Coupon: &saved})
+	return nil
+}
+
+func (t *tx) OrderSave(ctx context.Context, order *entities.Order) error {
+	// Generate ID here, so the order to restore is known
+	if order.ID == "" {
+		order.ID = uuid.New().String()
+		order.CreatedAt = t.clock.Now()
+	}
+
+	undo := t.orderUndo(order.ID)
+	if err := t.storage.OrderSave(ctx, order); err != nil {
+		return err
+	}
+
+	saved := cloneOrder(*order)
+	t.written(undo, walRecord{Operation: walOpOrderSave, Key: order.ID, Order: &saved})
+	return nil
+}
+
+func (t *tx) StockSave(ctx context.Context, stock *entities.Stock) error {
+	undo := t.stockUndo(stock.ProductID)
+	if err := t.storage.StockSave(ctx, stock); err != nil {
+		return err
+	}
+
+	saved := cloneStock(*stock)
+	t.written(undo, walRecord{Operation: walOpStockSave, Key: stock.ProductID, Stock: &saved})
+	return nil
+}
+
+// The undo functions restore the state of the entity when they were created. Stored entities are
+// never changed in place, every write stores a new copy, so keeping the stored value is enough.
+
+func (s *storage) basketUndo(basketID string) func() {
+	s.mutex.basket.Lock()
+	defer s.mutex.basket.Unlock()
+
+	basket, saved := s.data.baskets[basketID]
+	graceUntil, expired := s.data.expired[basketID]
+	retainUntil, retired := s.data.retired[basketID]
+	return func() {
+		s.mutex.basket.Lock()
+		defer s.mutex.basket.Unlock()
+
+		delete(s.data.baskets, basketID)
+		delete(s.data.expired, basketID)
+		delete(s.data.retired, basketID)
+		if saved {
+			s.data.baskets[basketID] = basket
+		}
+		if expired {
+			s.data.expired[basketID] = graceUntil
+		}
+		if retired {
+			s.data.retired[basketID] = retainUntil
+		}
+	}
+}
+
+func (s *storage) eventsUndo(basketID string) func() {
+	s.mutex.event.Lock()
+	defer s.mutex.event.Unlock()
+
+	history, saved := s.data.events[basketID]
+	return func() {
+		s.mutex.event.Lock()
+		defer s.mutex.event.Unlock()
+
+		delete(s.data.events, basketID)
+		if saved {
+			s.data.events[basketID] = history
+		}
+	}
+}
+
+func (s *storage) productUndo(productID string) func() {
+	s.mutex.product.Lock()
+	defer s.mutex.product.Unlock()
+
+	product, saved := s.data.products[productID]
+	return func() {
+		s.mutex.product.Lock()
+		defer s.mutex.product.Unlock()
+
+		delete(s.data.products, productID)
+		if saved {
+			s.data.products[productID] = product
+		}
+	}
+}
+
+func (s *storage) promotionUndo(promotionID string) func() {
+	s.mutex.promotion.Lock()
+	defer s.mutex.promotion.Unlock()
+
+	promotion, saved := s.data.promotions[promotionID]
+	return func() {
+		s.mutex.promotion.Lock()
+		defer s.mutex.promotion.Unlock()
+
+		delete(s.data.promotions, promotionID)
+		if saved {
+			s.data.promotions[promotionID] = promotion
+		}
+	}
+}
+
+func (s *storage) couponUndo(code string) func() {
+	s.mutex.coupon.Lock()
+	defer s.mutex.coupon.Unlock()
+
+	coupon, saved := s.data.coupons[code]
+	return func() {
+		s.mutex.coupon.Lock()
+		defer s.mutex.coupon.Unlock()
+
+		delete(s.data.coupons, code)
+		if saved {
+			s.data.coupons[code] = coupon
+		}
+	}
+}
+
+func (s *storage) orderUndo(orderID string) func() {
+	s.mutex.order.Lock()
+	defer s.mutex.order.Unlock()
+
+	order, saved := s.data.orders[orderID]
+	return func() {
+		s.mutex.order.Lock()
+		defer s.mutex.order.Unlock()
+
+		delete(s.data.orders, orderID)
+		if saved {
+			s.data.orders[orderID] = order
+		}
+	}
+}
+
+func (s *storage) stockUndo(productID string) func() {
+	s.mutex.stock.Lock()
+	defer s.mutex.stock.Unlock()
+
+	stock, saved := s.data.stocks[productID]
+	return func() {
+		s.mutex.stock.Lock()
+		defer s.mutex.stock.Unlock()
+
+		delete(s.data.stocks, productID)
+		if saved {
+			s.data.stocks[productID] = stock
+		}
+	}
+}
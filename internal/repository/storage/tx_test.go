@@ -0,0 +1,236 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/clock"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// checkoutTx writes a checkout like the domain does: the order, the coupon usage, the stock and
+// the basket. The error is returned after all the writes.
+func checkoutTx(ctx context.Context, basket *entities.Basket, order *entities.Order, err error) func(tx checkout.Storage) error {
+	return func(tx checkout.Storage) error {
+		if err := tx.OrderSave(ctx, order); err != nil {
+			return err
+		}
+		coupon, _ := tx.CouponGet(ctx, "WELCOME10")
+		coupon.Used++
+		if err := tx.CouponSave(ctx, coupon); err != nil {
+			return err
+		}
+		stock, _ := tx.StockGet(ctx, "PEN")
+		stock.Reserve(basket.ID, 3, time.Now(), time.Now().Add(time.Hour))
+		stock.Commit(basket.ID, time.Now())
+		if err := tx.StockSave(ctx, stock); err != nil {
+			return err
+		}
+		if err := tx.ProductDelete(ctx, "MUG"); err != nil {
+			return err
+		}
+		basket.CheckOut(order)
+		if err := tx.BasketSave(ctx, basket, 1); err != nil {
+			return err
+		}
+		return err
+	}
+}
+
+func Test_storage_WithTx_Commit(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+			s.BasketSave(ctx, basket, 0)
+			stock, _ := s.StockGet(ctx, "PEN")
+			order := entities.NewOrder(*basket)
+
+			// When
+			err := s.WithTx(ctx, checkoutTx(ctx, basket, order, nil))
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+			sOrder, _ := s.OrderGet(ctx, order.ID)
+			sCoupon, _ := s.CouponGet(ctx, "WELCOME10")
+			sStock, _ := s.StockGet(ctx, "PEN")
+			_, errMug := s.ProductGet(ctx, "MUG")
+
+			// Then
+			assert.Nil(t, err)
+			assert.True(t, sBasket.IsCheckedOut())
+			assert.NotNil(t, sOrder)
+			assert.Equal(t, uint(1), sCoupon.Used)
+			assert.Equal(t, stock.OnHand-3, sStock.OnHand)
+			assert.NotNil(t, errMug)
+		})
+	}
+}
+
+func Test_storage_WithTx_Rollback(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+			s.BasketSave(ctx, basket, 0)
+			stored := *basket
+			coupon, _ := s.CouponGet(ctx, "WELCOME10")
+			stock, _ := s.StockGet(ctx, "PEN")
+			mug, _ := s.ProductGet(ctx, "MUG")
+			order := entities.NewOrder(*basket)
+
+			// When: the unit of work fails after all its writes
+			err := s.WithTx(ctx, checkoutTx(ctx, basket, order, errors.New("checkout-error")))
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+			sOrder, _ := s.OrderGet(ctx, order.ID)
+			sCoupon, _ := s.CouponGet(ctx, "WELCOME10")
+			sStock, _ := s.StockGet(ctx, "PEN")
+			sMug, _ := s.ProductGet(ctx, "MUG")
+
+			// Then: nothing is written
+			assert.EqualError(t, err, "checkout-error")
+			assert.Equal(t, stored, *sBasket)
+			assert.Nil(t, sOrder)
+			assert.Equal(t, *coupon, *sCoupon)
+			assert.Equal(t, *stock, *sStock)
+			assert.Equal(t, *mug, *sMug)
+		})
+	}
+}
+
+func Test_storage_WithTx_RollbackNewBasket(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := &entities.Basket{}
+
+			// When
+			err := s.WithTx(ctx, func(tx checkout.Storage) error {
+				if err := tx.BasketSave(ctx, basket, 0); err != nil {
+					return err
+				}
+				return errors.New("create-error")
+			})
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then
+			assert.EqualError(t, err, "create-error")
+			assert.NotEqual(t, "", basket.ID)
+			assert.Nil(t, sBasket)
+		})
+	}
+}
+
+func Test_storage_WithTx_RollbackEvents(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+			s.BasketEventsAppend(ctx, basket.ID, []entities.BasketEvent{entities.NewBasketCreatedEvent(basket)})
+
+			// When
+			err := s.WithTx(ctx, func(tx checkout.Storage) error {
+				events := []entities.BasketEvent{entities.NewBasketDeletedEvent(basket)}
+				if err := tx.BasketEventsAppend(ctx, basket.ID, events); err != nil {
+					return err
+				}
+				return errors.New("delete-error")
+			})
+			events, _ := s.BasketEventsGet(ctx, basket.ID)
+
+			// Then
+			assert.EqualError(t, err, "delete-error")
+			assert.Equal(t, 1, len(events))
+			assert.Equal(t, entities.BasketEventCreated, events[0].Type)
+		})
+	}
+}
+
+func Test_storage_WithTx_Nested(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+
+			// When: the outer unit of work fails after the nested one succeeded
+			err := s.WithTx(ctx, func(tx checkout.Storage) error {
+				tx.WithTx(ctx, func(tx checkout.Storage) error {
+					return tx.BasketSave(ctx, basket, 0)
+				})
+				return errors.New("outer-error")
+			})
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+
+			// Then: the nested writes are rolled back too
+			assert.EqualError(t, err, "outer-error")
+			assert.Nil(t, sBasket)
+		})
+	}
+}
+
+func Test_storage_WithTx_Panic(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range buildStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+
+			// When
+			panicked := func() (r interface{}) {
+				defer func() { r = recover() }()
+				s.WithTx(ctx, func(tx checkout.Storage) error {
+					tx.BasketSave(ctx, basket, 0)
+					panic("tx-panic")
+				})
+				return nil
+			}()
+			sBasket, _ := s.BasketGet(ctx, basket.ID)
+			errAfter := s.WithTx(ctx, func(tx checkout.Storage) error { return nil })
+
+			// Then: rolled back & the panic goes on, without leaving the storage locked
+			assert.Equal(t, "tx-panic", panicked)
+			assert.Nil(t, sBasket)
+			assert.Nil(t, errAfter)
+		})
+	}
+}
+
+func Test_fileStorage_WithTx_Recover(t *testing.T) {
+	// Given: a committed transaction and a rolled back one
+	ctx := context.Background()
+	dir := buildDataDir(t)
+	s, _ := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	basket := buildBasket("cf31bf2b-42a3-4cb5-ae51-34fbe30d163f")
+	s.BasketSave(ctx, basket, 0)
+	order := entities.NewOrder(*basket)
+	errCommit := s.WithTx(ctx, checkoutTx(ctx, basket, order, nil))
+	failed := buildBasket("78235217-43fe-4e7a-8f18-e5f83df01ca6")
+	s.WithTx(ctx, func(tx checkout.Storage) error {
+		tx.BasketSave(ctx, failed, 0)
+		return errors.New("tx-error")
+	})
+
+	// When: reopen without closing, as after a crash
+	recovered, err := storage.NewFileStorage(ctx, dir, 0, clock.NewClock())
+	sBasket, _ := recovered.BasketGet(ctx, basket.ID)
+	sOrder, _ := recovered.OrderGet(ctx, order.ID)
+	sCoupon, _ := recovered.CouponGet(ctx, "WELCOME10")
+	sFailed, _ := recovered.BasketGet(ctx, failed.ID)
+	errStale := recovered.BasketSave(ctx, sBasket, 0)
+
+	// Then
+	assert.Nil(t, errCommit)
+	assert.Nil(t, err)
+	assert.Equal(t, order.ID, sBasket.OrderID)
+	assert.Equal(t, order.ID, sOrder.ID)
+	assert.Equal(t, uint(1), sCoupon.Used)
+	assert.Nil(t, sFailed)
+	assert.EqualError(t, errStale, "stale fencing token 0 for basket "+basket.ID+", last accepted is 1")
+}
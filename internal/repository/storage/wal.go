@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// The write-ahead log is a sequence of framed records. Every frame has a fixed size header with
+// the payload length and its CRC32 checksum followed by the gob encoded payload:
+//
+//   | length (4 bytes) | crc32 (4 bytes) | payload (length bytes) |
+//
+// A crash in the middle of an append leaves a torn frame at the end of the file. When the log is
+// read the first frame that can't be fully read or doesn't match its checksum marks the end of
+// the valid data and everything after it is discarded.
+
+const (
+	walHeaderSize = 8
+	walMaxRecord  = 64 << 20
+)
+
+var errWalCorrupted = errors.New("corrupted wal record")
+
+func encodeWalRecord(rec walRecord) ([]byte, error) {
+	payload := &bytes.Buffer{}
+	if err := gob.NewEncoder(payload).Encode(rec); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, walHeaderSize, walHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(frame, payload.Bytes()...), nil
+}
+
+// readWal reads all the valid records of the log. The returned offset is the position right after
+// the last valid record, so the caller can truncate any torn data left by a crash.
+func readWal(file *os.File) ([]walRecord, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	records := make([]walRecord, 0)
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		rec, size, err := readWalRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || err == errWalCorrupted {
+			return records, offset, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, rec)
+		offset += size
+	}
+}
+
+func readWalRecord(reader io.Reader) (walRecord, int64, error) {
+	rec := walRecord{}
+
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return rec, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > walMaxRecord {
+		return rec, 0, errWalCorrupted
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return rec, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return rec, 0, errWalCorrupted
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, 0, errWalCorrupted
+	}
+
+	return rec, int64(walHeaderSize + length), nil
+}
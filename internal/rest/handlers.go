@@ -8,23 +8,42 @@ import (
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
+	"io"
 	"net/http"
 )
 
 type Handler struct {
-	srv checkout.Service
+	srv         checkout.Service
+	idempotency IdempotencyStore
 }
 
-func NewHandler(srv checkout.Service) *Handler {
-	return &Handler{
+type HandlerOption func(h *Handler)
+
+// WithIdempotencyStore sets the store of the responses to requests with an idempotency key. The
+// store is owned by the caller. Without a store idempotency keys are ignored.
+func WithIdempotencyStore(store IdempotencyStore) HandlerOption {
+	return func(h *Handler) {
+		h.idempotency = store
+	}
+}
+
+func NewHandler(srv checkout.Service, options ...HandlerOption) *Handler {
+	h := &Handler{
 		srv: srv,
 	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
 }
 
 const (
-	UrlParamBasketID   = "basketID"
-	UrlParamProductID  = "productID"
-	QueryParamQuantity = "quantity"
+	UrlParamBasketID    = "basketID"
+	UrlParamProductID   = "productID"
+	UrlParamOrderID     = "orderID"
+	UrlParamPromotionID = "promotionID"
+	UrlParamCouponCode  = "code"
+	QueryParamQuantity  = "quantity"
 )
 
 func (h Handler) Ping(w http.ResponseWriter, r *http.Request) {
@@ -35,16 +54,27 @@ func (h Handler) Ping(w http.ResponseWriter, r *http.Request) {
 func (h Handler) BasketCreate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	// Basket detail from payload, it's optional
+	basketDetail := entities.BasketDetail{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&basketDetail); err != nil && err != io.EOF {
+			err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+			h.HandleError(w, err)
+			return
+		}
+	}
+
 	// Service call
-	basket, err := h.srv.BasketCreate(ctx)
+	basket, err := h.srv.BasketCreate(ctx, basketDetail)
 	if err != nil {
 		h.HandleError(w, err)
 		return
 	}
 
 	// Success
+	h.SetBasketETag(w, basket)
 	render.Status(r, http.StatusCreated)
-	render.JSON(w, r, basket)
+	h.JSON(w, r, basket)
 }
 
 func (h Handler) BasketGet(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +91,8 @@ func (h Handler) BasketGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
-	render.JSON(w, r, basket)
+	h.SetBasketETag(w, basket)
+	h.JSON(w, r, basket)
 }
 
 func (h Handler) BasketDelete(w http.ResponseWriter, r *http.Request) {
@@ -131,6 +162,161 @@ func (h Handler) BasketRemoveItem(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h Handler) BasketSetItemQuantity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+	productID := chi.URLParam(r, UrlParamProductID)
+
+	// Quantity from payload. It's required, a missing quantity would remove the item
+	payload := struct {
+		Quantity *uint `json:"quantity"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+	if payload.Quantity == nil {
+		err := lanaerr.New(errors.New("quantity is required"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+	itemDetail := entities.ItemDetail{
+		ProductID: productID,
+		Quantity:  *payload.Quantity,
+	}
+
+	// Service call
+	if err := h.srv.BasketSetItemQuantity(ctx, basketID, itemDetail); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) BasketUpdateItems(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+
+	// Operations from payload
+	payload := struct {
+		Operations []entities.ItemOperation `json:"operations"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	if err := h.srv.BasketUpdateItems(ctx, basketID, payload.Operations); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) BasketCheckout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+
+	// Service call
+	order, err := h.srv.BasketCheckout(ctx, basketID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	render.Status(r, http.StatusCreated)
+	h.JSON(w, r, order)
+}
+
+func (h Handler) BasketApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+
+	// Coupon from payload
+	coupon := entities.CouponDetail{}
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	if err := h.srv.BasketApplyCoupon(ctx, basketID, coupon); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) BasketRemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+	code := chi.URLParam(r, UrlParamCouponCode)
+
+	// Service call
+	if err := h.srv.BasketRemoveCoupon(ctx, basketID, code); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) BasketEventList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+
+	// Service call
+	events, err := h.srv.BasketEventList(ctx, basketID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, events)
+}
+
+func (h Handler) BasketReplay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	basketID := chi.URLParam(r, UrlParamBasketID)
+
+	// Service call
+	basket, err := h.srv.BasketReplay(ctx, basketID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, basket)
+}
+
 func (h Handler) ProductList(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -142,7 +328,7 @@ func (h Handler) ProductList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
-	render.JSON(w, r, products)
+	h.JSON(w, r, products)
 }
 
 func (h Handler) ProductGet(w http.ResponseWriter, r *http.Request) {
@@ -159,5 +345,288 @@ func (h Handler) ProductGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
-	render.JSON(w, r, product)
+	h.JSON(w, r, product)
+}
+
+func (h Handler) ProductCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Product from payload
+	product := entities.Product{}
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	created, err := h.srv.ProductCreate(ctx, product)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	render.Status(r, http.StatusCreated)
+	h.JSON(w, r, created)
+}
+
+func (h Handler) ProductUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	productID := chi.URLParam(r, UrlParamProductID)
+
+	// Product from payload
+	product := entities.Product{}
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	updated, err := h.srv.ProductUpdate(ctx, productID, product)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, updated)
+}
+
+func (h Handler) ProductDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	productID := chi.URLParam(r, UrlParamProductID)
+
+	// Service call
+	if err := h.srv.ProductDelete(ctx, productID); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) ProductStockGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	productID := chi.URLParam(r, UrlParamProductID)
+
+	// Service call
+	stock, err := h.srv.ProductStockGet(ctx, productID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, stock)
+}
+
+func (h Handler) ProductStockUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	productID := chi.URLParam(r, UrlParamProductID)
+
+	// Stock from payload
+	stockDetail := entities.StockDetail{}
+	if err := json.NewDecoder(r.Body).Decode(&stockDetail); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	stock, err := h.srv.ProductStockUpdate(ctx, productID, stockDetail)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, stock)
+}
+
+func (h Handler) PromotionList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Service call
+	promotions, err := h.srv.PromotionList(ctx)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, promotions)
+}
+
+func (h Handler) PromotionGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	promotionID := chi.URLParam(r, UrlParamPromotionID)
+
+	// Service call
+	promotion, err := h.srv.PromotionGet(ctx, promotionID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, promotion)
+}
+
+func (h Handler) PromotionCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Promotion from payload
+	promotion := entities.Promotion{}
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	created, err := h.srv.PromotionCreate(ctx, promotion)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	render.Status(r, http.StatusCreated)
+	h.JSON(w, r, created)
+}
+
+func (h Handler) PromotionUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	promotionID := chi.URLParam(r, UrlParamPromotionID)
+
+	// Promotion from payload
+	promotion := entities.Promotion{}
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	updated, err := h.srv.PromotionUpdate(ctx, promotionID, promotion)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, updated)
+}
+
+func (h Handler) PromotionDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	promotionID := chi.URLParam(r, UrlParamPromotionID)
+
+	// Service call
+	if err := h.srv.PromotionDelete(ctx, promotionID); err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h Handler) CouponGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	code := chi.URLParam(r, UrlParamCouponCode)
+
+	// Service call
+	coupon, err := h.srv.CouponGet(ctx, code)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, coupon)
+}
+
+func (h Handler) CouponCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Coupon from payload
+	coupon := entities.Coupon{}
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	created, err := h.srv.CouponCreate(ctx, coupon)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	render.Status(r, http.StatusCreated)
+	h.JSON(w, r, created)
+}
+
+func (h Handler) CouponUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	code := chi.URLParam(r, UrlParamCouponCode)
+
+	// Coupon from payload
+	coupon := entities.Coupon{}
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		err = lanaerr.New(errors.New("payload error"), http.StatusBadRequest)
+		h.HandleError(w, err)
+		return
+	}
+
+	// Service call
+	updated, err := h.srv.CouponUpdate(ctx, code, coupon)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, updated)
+}
+
+func (h Handler) OrderGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Request params
+	orderID := chi.URLParam(r, UrlParamOrderID)
+
+	// Service call
+	order, err := h.srv.OrderGet(ctx, orderID)
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	// Success
+	h.JSON(w, r, order)
 }
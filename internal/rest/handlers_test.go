@@ -1,10 +1,13 @@
 package rest_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/idempotency"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/rest"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"github.com/gbrlmza/lana-bechallenge-checkout/test/fake"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -12,6 +15,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler_Ping_Success(t *testing.T) {
@@ -38,7 +42,7 @@ func TestHandler_BasketCreate_Error(t *testing.T) {
 	router := handler.RouterInit()
 	w := httptest.NewRecorder()
 
-	srv.On("BasketCreate", mock.Anything).Return(&entities.Basket{}, errors.New("create-error"))
+	srv.On("BasketCreate", mock.Anything, entities.BasketDetail{}).Return(&entities.Basket{}, errors.New("create-error"))
 
 	// When
 	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets", nil)
@@ -57,7 +61,7 @@ func TestHandler_BasketCreate_Success(t *testing.T) {
 	router := handler.RouterInit()
 	w := httptest.NewRecorder()
 
-	srv.On("BasketCreate", mock.Anything).Return(&entities.Basket{
+	srv.On("BasketCreate", mock.Anything, entities.BasketDetail{}).Return(&entities.Basket{
 		ID: "1680cd34-931e-4b0c-b7e3-ab314d688398",
 	}, nil)
 
@@ -67,7 +71,54 @@ func TestHandler_BasketCreate_Success(t *testing.T) {
 
 	// Then
 	assert.Equal(t, http.StatusCreated, w.Code)
-	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","items":null,"subtotal":0,"discount":0,"total":0}`
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,"items":null,"subtotal":0,"discount":0,"total":0}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketCreate_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	b := strings.NewReader(`{"country":`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketCreate_Detail(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	detail := entities.BasketDetail{Country: "PT", Currency: "USD"}
+	srv.On("BasketCreate", mock.Anything, detail).Return(&entities.Basket{
+		ID:       "1680cd34-931e-4b0c-b7e3-ab314d688398",
+		Currency: "USD",
+		Country:  "PT",
+		Taxes:    &entities.TaxAmounts{},
+	}, nil)
+
+	// When
+	b := strings.NewReader(`{"country":"PT","currency":"USD"}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,` +
+		`"currency":"USD","items":null,"subtotal":0,"discount":0,"total":0,` +
+		`"taxes":{"net":0,"tax":0,"gross":0},"country":"PT"}`
 	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
 	srv.AssertExpectations(t)
 }
@@ -108,7 +159,8 @@ func TestHandler_BasketGet_Success(t *testing.T) {
 
 	// Then
 	assert.Equal(t, http.StatusOK, w.Code)
-	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","items":null,"subtotal":0,"discount":0,"total":0}`
+	assert.Equal(t, `"0"`, w.Header().Get("ETag"))
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,"items":null,"subtotal":0,"discount":0,"total":0}`
 	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
 	srv.AssertExpectations(t)
 }
@@ -278,6 +330,147 @@ func TestHandler_BasketRemoveItem_Success(t *testing.T) {
 	srv.AssertExpectations(t)
 }
 
+func TestHandler_BasketSetItemQuantity_PayloadError(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{name: "invalid", payload: `{"quantity":-1}`, err: "payload error"},
+		{name: "without quantity", payload: `{}`, err: "quantity is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			srv := &fake.FakeService{}
+			handler := rest.NewHandler(srv)
+			router := handler.RouterInit()
+			w := httptest.NewRecorder()
+
+			// When
+			url := "/v1/baskets/1680cd34-931e-4b0c-b7e3-ab314d688398/items/PEN"
+			r, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(tt.payload))
+			router.ServeHTTP(w, r)
+
+			// Then
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tt.err, w.Body.String())
+			srv.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_BasketSetItemQuantity_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketSetItemQuantity", mock.Anything, basketID, entities.ItemDetail{
+		ProductID: "PEN",
+		Quantity:  4,
+	}).Return(errors.New("set-error"))
+
+	// When
+	url := fmt.Sprintf("/v1/baskets/%s/items/%s", basketID, "PEN")
+	r, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(`{"quantity":4}`))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "set-error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketSetItemQuantity_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketSetItemQuantity", mock.Anything, basketID, entities.ItemDetail{
+		ProductID: "PEN",
+		Quantity:  0,
+	}).Return(nil)
+
+	// When
+	url := fmt.Sprintf("/v1/baskets/%s/items/%s", basketID, "PEN")
+	r, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(`{"quantity":0}`))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketUpdateItems_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	url := "/v1/baskets/1680cd34-931e-4b0c-b7e3-ab314d688398/items"
+	r, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(`{"operations":{}}`))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketUpdateItems_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketUpdateItems", mock.Anything, basketID, []entities.ItemOperation{
+		{Op: entities.ItemOperationRemove, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+	}).Return(lanaerr.New(errors.New("operations[0] remove PEN: item PEN not found"), http.StatusNotFound))
+
+	// When
+	url := fmt.Sprintf("/v1/baskets/%s/items", basketID)
+	payload := `{"operations":[{"op":"remove","id":"PEN","quantity":2}]}`
+	r, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(payload))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "operations[0] remove PEN: item PEN not found", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketUpdateItems_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketUpdateItems", mock.Anything, basketID, []entities.ItemOperation{
+		{Op: entities.ItemOperationAdd, ItemDetail: entities.ItemDetail{ProductID: "PEN", Quantity: 2}},
+		{Op: entities.ItemOperationSet, ItemDetail: entities.ItemDetail{ProductID: "MUG", Quantity: 1}},
+	}).Return(nil)
+
+	// When
+	url := fmt.Sprintf("/v1/baskets/%s/items", basketID)
+	payload := `{"operations":[{"op":"add","id":"PEN","quantity":2},{"op":"set","id":"MUG","quantity":1}]}`
+	r, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(payload))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
 func TestHandler_ProductList_ServiceError(t *testing.T) {
 	// Given
 	srv := &fake.FakeService{}
@@ -343,7 +536,7 @@ func TestHandler_ProductGet_Success(t *testing.T) {
 	srv.On("ProductGet", mock.Anything, productID).Return(&entities.Product{
 		ID:    productID,
 		Name:  "Lana Pen",
-		Price: 10.50,
+		Price: entities.NewMoney(1050, entities.DefaultCurrency),
 	}, nil)
 
 	// When
@@ -356,3 +549,996 @@ func TestHandler_ProductGet_Success(t *testing.T) {
 	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
 	srv.AssertExpectations(t)
 }
+
+func TestHandler_ProductGet_V2_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	productID := "PEN"
+	srv.On("ProductGet", mock.Anything, productID).Return(&entities.Product{
+		ID:    productID,
+		Name:  "Lana Pen",
+		Price: entities.NewMoney(1050, entities.DefaultCurrency),
+	}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v2/products/"+productID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"PEN","name":"Lana Pen","price":{"amount":1050,"currency":"EUR"},"promotion_ids":null}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductGet_SeveralPromotions(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	productID := "PEN"
+	srv.On("ProductGet", mock.Anything, productID).Return(&entities.Product{
+		ID:           productID,
+		Name:         "Lana Pen",
+		Price:        entities.NewMoney(1050, entities.DefaultCurrency),
+		PromotionIDs: []string{"2X1", "10OFF"},
+	}, nil)
+
+	// When
+	w1 := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/v1/products/"+productID, nil)
+	router.ServeHTTP(w1, r)
+	w2 := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/v2/products/"+productID, nil)
+	router.ServeHTTP(w2, r)
+
+	// Then: v1 shows the first promotion only
+	assert.Equal(t, `{"id":"PEN","name":"Lana Pen","price":10.5,"promotion_id":"2X1"}`, strings.TrimSpace(w1.Body.String()))
+	expectedBody := `{"id":"PEN","name":"Lana Pen","price":{"amount":1050,"currency":"EUR"},"promotion_ids":["2X1","10OFF"]}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w2.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketGet_V1_Items(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{
+		ID:    "MUG",
+		Name:  "Lana Coffee Mug",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	item.AddQuantity(3)
+	basket.SaveItem(item)
+	srv.On("BasketGet", mock.Anything, basketID).Return(basket, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,` +
+		`"currency":"EUR","items":{"MUG":{"product":{"id":"MUG","name":"Lana Coffee Mug","price":7.5,"promotion_id":null},` +
+		`"quantity":3,"total":22.5,"discount":0}},"subtotal":22.5,"discount":0,"total":22.5}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketCheckout_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketCheckout", mock.Anything, basketID).Return(&entities.Order{}, errors.New("checkout-error"))
+
+	// When
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets/"+basketID+"/checkout", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "checkout-error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketCheckout_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketCheckout", mock.Anything, basketID).Return(&entities.Order{
+		ID:       "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11",
+		BasketID: basketID,
+		Status:   entities.OrderStatusCreated,
+		Items:    []entities.OrderItem{},
+		Total:    entities.NewMoney(1000, entities.DefaultCurrency),
+	}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets/"+basketID+"/checkout", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"id":"b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11","basket_id":"1680cd34-931e-4b0c-b7e3-ab314d688398",` +
+		`"status":"created","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","items":[],` +
+		`"subtotal":0,"discount":0,"total":10}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_OrderGet_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	orderID := "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	srv.On("OrderGet", mock.Anything, orderID).Return(&entities.Order{}, errors.New("get-error"))
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/orders/"+orderID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "get-error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_OrderGet_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	orderID := "b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11"
+	srv.On("OrderGet", mock.Anything, orderID).Return(&entities.Order{
+		ID:     orderID,
+		Status: entities.OrderStatusCreated,
+		Items: []entities.OrderItem{{
+			ProductID: "MUG",
+			Name:      "Lana Coffee Mug",
+			UnitPrice: entities.NewMoney(750, entities.DefaultCurrency),
+			Quantity:  1,
+			Total:     entities.NewMoney(750, entities.DefaultCurrency),
+			Discount:  entities.NewMoney(0, entities.DefaultCurrency),
+		}},
+	}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/orders/"+orderID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"b2a0e6d4-6f6a-4d8e-a0f5-2f9f0e1c8a11","basket_id":"","status":"created",` +
+		`"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","items":[{"product_id":"MUG",` +
+		`"name":"Lana Coffee Mug","unit_price":7.5,"quantity":1,"total":7.5,"discount":0}],` +
+		`"subtotal":0,"discount":0,"total":0}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductCreate_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	b := strings.NewReader(`{"price":"TEXT"}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/products", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductCreate_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductCreate", mock.Anything, mock.Anything).
+		Return(&entities.Product{}, lanaerr.New(errors.New("product BOOK already exists"), http.StatusConflict))
+
+	// When
+	b := strings.NewReader(`{"id":"BOOK","name":"Lana Book","price":12.5}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/products", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "product BOOK already exists", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductCreate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	product := entities.Product{
+		ID:    "BOOK",
+		Name:  "Lana Book",
+		Price: entities.NewMoney(1250, entities.DefaultCurrency),
+	}
+	srv.On("ProductCreate", mock.Anything, product).Return(&product, nil)
+
+	// When
+	b := strings.NewReader(`{"id":"BOOK","name":"Lana Book","price":12.5}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/products", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"id":"BOOK","name":"Lana Book","price":12.5,"promotion_id":null}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductUpdate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	product := entities.Product{
+		Name:  "Lana Book",
+		Price: entities.NewMoney(1300, "USD"),
+	}
+	updated := product
+	updated.ID = "BOOK"
+	srv.On("ProductUpdate", mock.Anything, "BOOK", product).Return(&updated, nil)
+
+	// When
+	b := strings.NewReader(`{"name":"Lana Book","price":{"amount":1300,"currency":"USD"}}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v2/products/BOOK", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"BOOK","name":"Lana Book","price":{"amount":1300,"currency":"USD"},"promotion_ids":null}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductUpdate_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductUpdate", mock.Anything, "BOOK", mock.Anything).
+		Return(&entities.Product{}, errors.New("update-error"))
+
+	// When
+	b := strings.NewReader(`{"name":"Lana Book","price":13}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v1/products/BOOK", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "update-error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductDelete_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductDelete", mock.Anything, "BOOK").Return(errors.New("delete-error"))
+
+	// When
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/products/BOOK", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "delete-error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductDelete_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductDelete", mock.Anything, "BOOK").Return(nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/products/BOOK", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductStockGet_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductStockGet", mock.Anything, "PEN").Return(&entities.Stock{
+		ProductID: "PEN",
+		OnHand:    10,
+		Available: 10,
+	}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/products/PEN/stock", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"product_id":"PEN","on_hand":10,"reserved":0,"available":10}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductStockUpdate_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	b := strings.NewReader(`{"on_hand":-1}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v1/products/PEN/stock", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductStockUpdate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("ProductStockUpdate", mock.Anything, "PEN", entities.StockDetail{OnHand: 20}).
+		Return(&entities.Stock{ProductID: "PEN", OnHand: 20, Reserved: 4, Available: 16}, nil)
+
+	// When
+	b := strings.NewReader(`{"on_hand":20}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v1/products/PEN/stock", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"product_id":"PEN","on_hand":20,"reserved":4,"available":16}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionList_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	promotions := []entities.Promotion{{ID: "2X1", RequiredItems: 2, FreeItems: 1}}
+	srv.On("PromotionList", mock.Anything).Return(promotions, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/promotions", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `[{"id":"2X1","required_items":2,"free_items":1,"reduction":0}]`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionGet_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("PromotionGet", mock.Anything, "2X1").
+		Return(&entities.Promotion{}, lanaerr.New(errors.New("promotion 2X1 not found"), http.StatusNotFound))
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/promotions/2X1", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "promotion 2X1 not found", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionCreate_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	b := strings.NewReader(`{"required_items":-1}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/promotions", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionCreate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	promotion := entities.Promotion{ID: "10OFF", Reduction: 10}
+	srv.On("PromotionCreate", mock.Anything, promotion).Return(&promotion, nil)
+
+	// When
+	b := strings.NewReader(`{"id":"10OFF","reduction":10}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/promotions", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"id":"10OFF","required_items":0,"free_items":0,"reduction":10}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionUpdate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	promotion := entities.Promotion{Reduction: 15}
+	updated := promotion
+	updated.ID = "10OFF"
+	srv.On("PromotionUpdate", mock.Anything, "10OFF", promotion).Return(&updated, nil)
+
+	// When
+	b := strings.NewReader(`{"reduction":15}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v1/promotions/10OFF", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"10OFF","required_items":0,"free_items":0,"reduction":15}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionDelete_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("PromotionDelete", mock.Anything, "2X1").
+		Return(lanaerr.New(errors.New("promotion 2X1 is used by product PEN"), http.StatusConflict))
+
+	// When
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/promotions/2X1", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "promotion 2X1 is used by product PEN", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_PromotionDelete_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	srv.On("PromotionDelete", mock.Anything, "2X1").Return(nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/promotions/2X1", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketApplyCoupon_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+
+	// When
+	b := strings.NewReader(`{"code":10}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets/"+basketID+"/coupons", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketApplyCoupon_ServiceError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketApplyCoupon", mock.Anything, basketID, entities.CouponDetail{Code: "10OFF"}).
+		Return(lanaerr.New(errors.New("coupon 10OFF is expired"), http.StatusBadRequest))
+
+	// When
+	b := strings.NewReader(`{"code":"10OFF"}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets/"+basketID+"/coupons", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "coupon 10OFF is expired", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketApplyCoupon_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketApplyCoupon", mock.Anything, basketID, entities.CouponDetail{Code: "10OFF"}).Return(nil)
+
+	// When
+	b := strings.NewReader(`{"code":"10OFF"}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/baskets/"+basketID+"/coupons", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketRemoveCoupon_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketRemoveCoupon", mock.Anything, basketID, "10OFF").Return(nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/baskets/"+basketID+"/coupons/10OFF", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketEventList_Error(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	err := lanaerr.New(errors.New("history not found"), http.StatusNotFound)
+	srv.On("BasketEventList", mock.Anything, basketID).Return(([]entities.BasketEvent)(nil), err)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID+"/events", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "history not found", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketEventList_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketEventList", mock.Anything, basketID).Return([]entities.BasketEvent{{
+		BasketID: basketID,
+		Sequence: 1,
+		Type:     entities.BasketEventItemAdded,
+		Quantity: 2,
+		Total:    entities.NewMoney(1000, entities.DefaultCurrency),
+	}}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID+"/events", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `[{"basket_id":"1680cd34-931e-4b0c-b7e3-ab314d688398","sequence":1,"type":"item_added",` +
+		`"occurred_at":"0001-01-01T00:00:00Z","quantity":2,"total":10}]`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketReplay_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketReplay", mock.Anything, basketID).Return(&entities.Basket{ID: basketID}, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID+"/events/replay", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"1680cd34-931e-4b0c-b7e3-ab314d688398"`)
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketGet_V1_Coupons(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{
+		ID:    "MUG",
+		Name:  "Lana Coffee Mug",
+		Price: entities.NewMoney(750, entities.DefaultCurrency),
+	}, nil)
+	item.AddQuantity(2)
+	basket.SaveItem(item)
+	basket.AddCoupon(entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10})
+	srv.On("BasketGet", mock.Anything, basketID).Return(basket, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,` +
+		`"currency":"EUR","items":{"MUG":{"product":{"id":"MUG","name":"Lana Coffee Mug","price":7.5,"promotion_id":null},` +
+		`"quantity":2,"total":15,"discount":0}},"subtotal":15,"discount":1.5,` +
+		`"coupons":[{"code":"10OFF","discount":1.5}],"total":13.5}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_ProductCreate_SinglePromotionPayload(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	product := entities.Product{
+		ID:           "BOOK",
+		Name:         "Lana Book",
+		Price:        entities.NewMoney(1250, entities.DefaultCurrency),
+		PromotionIDs: []string{"BUY2GET1FREE"},
+	}
+	srv.On("ProductCreate", mock.Anything, product).Return(&product, nil)
+
+	// When
+	b := strings.NewReader(`{"id":"BOOK","name":"Lana Book","price":12.5,"promotion_id":"BUY2GET1FREE"}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/products", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"id":"BOOK","name":"Lana Book","price":12.5,"promotion_id":"BUY2GET1FREE"}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_BasketGet_V1_AppliedPromotions(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	basket := entities.NewBasket()
+	basket.ID = basketID
+	item := entities.NewBasketItem(entities.Product{
+		ID:           "PEN",
+		Name:         "Lana Pen",
+		Price:        entities.NewMoney(500, entities.DefaultCurrency),
+		PromotionIDs: []string{"BUY2GET1FREE"},
+	}, &entities.Promotion{ID: "BUY2GET1FREE", RequiredItems: 2, FreeItems: 1})
+	item.AddQuantity(3)
+	basket.SaveItem(item)
+	srv.On("BasketGet", mock.Anything, basketID).Return(basket, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/baskets/"+basketID, nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"id":"1680cd34-931e-4b0c-b7e3-ab314d688398","created_at":"0001-01-01T00:00:00Z","last_modified_at":"0001-01-01T00:00:00Z","version":0,` +
+		`"currency":"EUR","items":{"PEN":{"product":{"id":"PEN","name":"Lana Pen","price":5,"promotion_id":"BUY2GET1FREE"},` +
+		`"quantity":3,"total":15,"discount":5,"applied_promotions":[{"promotion_id":"BUY2GET1FREE",` +
+		`"description":"1 free every 2 units","units":2,"discount":5}],"next_threshold":{` +
+		`"promotion_id":"BUY2GET1FREE","quantity":1,"message":"add 1 more PEN for 1 free"}}},` +
+		`"subtotal":15,"discount":5,"applied_promotions":[{"promotion_id":"BUY2GET1FREE",` +
+		`"description":"1 free every 2 units","units":2,"discount":5}],"total":10}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_CouponGet_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	coupon := entities.Coupon{Code: "10OFF", DiscountType: entities.CouponDiscountPercentage, Percent: 10, Used: 3}
+	srv.On("CouponGet", mock.Anything, "10OFF").Return(&coupon, nil)
+
+	// When
+	r, _ := http.NewRequest(http.MethodGet, "/v1/coupons/10OFF", nil)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"code":"10OFF","discount_type":"percentage","percent":10,"amount":0,` +
+		`"usage_limit":0,"used":3,"min_basket_total":0}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_CouponCreate_PayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+
+	// When
+	r, _ := http.NewRequest(http.MethodPost, "/v1/coupons", strings.NewReader(`{"code":10}`))
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "payload error", w.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_CouponCreate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	coupon := entities.Coupon{
+		Code:         "2OFF",
+		DiscountType: entities.CouponDiscountFixedAmount,
+		Amount:       entities.NewMoney(200, entities.DefaultCurrency),
+	}
+	srv.On("CouponCreate", mock.Anything, coupon).Return(&coupon, nil)
+
+	// When
+	b := strings.NewReader(`{"code":"2OFF","discount_type":"fixed_amount","amount":2}`)
+	r, _ := http.NewRequest(http.MethodPost, "/v1/coupons", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expectedBody := `{"code":"2OFF","discount_type":"fixed_amount","amount":2,` +
+		`"usage_limit":0,"used":0,"min_basket_total":0}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_CouponUpdate_Success(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	w := httptest.NewRecorder()
+	coupon := entities.Coupon{DiscountType: entities.CouponDiscountPercentage, Percent: 15}
+	updated := coupon
+	updated.Code = "10OFF"
+	srv.On("CouponUpdate", mock.Anything, "10OFF", coupon).Return(&updated, nil)
+
+	// When
+	b := strings.NewReader(`{"discount_type":"percentage","percent":15}`)
+	r, _ := http.NewRequest(http.MethodPut, "/v1/coupons/10OFF", b)
+	router.ServeHTTP(w, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	expectedBody := `{"code":"10OFF","discount_type":"percentage","percent":15,"amount":0,` +
+		`"usage_limit":0,"used":0,"min_basket_total":0}`
+	assert.Equal(t, expectedBody, strings.TrimSpace(w.Body.String()))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_Idempotency_Replay(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := rest.NewHandler(srv, rest.WithIdempotencyStore(idempotency.NewStore(ctx, time.Hour)))
+	router := handler.RouterInit()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketAddItem", mock.Anything, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1}).
+		Return(nil).Once()
+
+	// When: the request is retried
+	url := "/v1/baskets/" + basketID + "/items"
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(w, r)
+	wRetry := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(wRetry, r)
+
+	// Then: the item is added once
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, wRetry.Code)
+	assert.Equal(t, "true", wRetry.Header().Get(rest.HeaderIdempotentReplayed))
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_Idempotency_WithoutStore(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	handler := rest.NewHandler(srv)
+	router := handler.RouterInit()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketAddItem", mock.Anything, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1}).
+		Return(nil).Twice()
+
+	// When: the request is retried
+	url := "/v1/baskets/" + basketID + "/items"
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+		r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(rest.HeaderIdempotentReplayed))
+	}
+
+	// Then: the key is ignored
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_Idempotency_DifferentPayloadError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := rest.NewHandler(srv, rest.WithIdempotencyStore(idempotency.NewStore(ctx, time.Hour)))
+	router := handler.RouterInit()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketAddItem", mock.Anything, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1}).
+		Return(nil).Once()
+
+	// When: the key is reused with another payload
+	url := "/v1/baskets/" + basketID + "/items"
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(w, r)
+	wReused := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":2}`))
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(wReused, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, wReused.Code)
+	assert.Equal(t, "idempotency key already used for a different request", wReused.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_Idempotency_DifferentQueryError(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := rest.NewHandler(srv, rest.WithIdempotencyStore(idempotency.NewStore(ctx, time.Hour)))
+	router := handler.RouterInit()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketRemoveItem", mock.Anything, basketID, entities.ItemDetail{ProductID: "PEN", Quantity: 1}).
+		Return(nil).Once()
+
+	// When: the key is reused with another quantity in the query
+	url := "/v1/baskets/" + basketID + "/items/PEN"
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodDelete, url+"?quantity=1", nil)
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(w, r)
+	wReused := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodDelete, url+"?quantity=2", nil)
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(wReused, r)
+
+	// Then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, wReused.Code)
+	assert.Equal(t, "idempotency key already used for a different request", wReused.Body.String())
+	srv.AssertExpectations(t)
+}
+
+func TestHandler_Idempotency_ServerErrorNotStored(t *testing.T) {
+	// Given
+	srv := &fake.FakeService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := rest.NewHandler(srv, rest.WithIdempotencyStore(idempotency.NewStore(ctx, time.Hour)))
+	router := handler.RouterInit()
+	basketID := "1680cd34-931e-4b0c-b7e3-ab314d688398"
+	srv.On("BasketDelete", mock.Anything, basketID).Return(errors.New("delete-error")).Once()
+	srv.On("BasketDelete", mock.Anything, basketID).Return(nil).Once()
+
+	// When: the failed request is retried
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodDelete, "/v1/baskets/"+basketID, nil)
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(w, r)
+	wRetry := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodDelete, "/v1/baskets/"+basketID, nil)
+	r.Header.Set(rest.HeaderIdempotencyKey, "e5f0c2a4")
+	router.ServeHTTP(wRetry, r)
+
+	// Then: the retry runs again
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusOK, wRetry.Code)
+	assert.Equal(t, "", wRetry.Header().Get(rest.HeaderIdempotentReplayed))
+	srv.AssertExpectations(t)
+}
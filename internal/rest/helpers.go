@@ -2,6 +2,7 @@ package rest
 
 import (
 	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
 	"net/http"
 	"strconv"
@@ -31,3 +32,8 @@ func (h Handler) GetQueryParamUintValue(r *http.Request, name string, defaultVal
 
 	return uint(intValue), nil
 }
+
+// SetBasketETag sets the version of the basket as its entity tag.
+func (h Handler) SetBasketETag(w http.ResponseWriter, basket *entities.Basket) {
+	w.Header().Set("ETag", fmt.Sprintf("%q", strconv.FormatUint(basket.Version, 10)))
+}
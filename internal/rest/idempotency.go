@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/idempotency"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/utils/lanaerr"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"io/ioutil"
+	"net/http"
+)
+
+// Clients can send an Idempotency-Key header with the changes to a basket, so a request retried
+// on a timeout isn't applied twice. The first response for a key and basket is stored and
+// replayed for the repeated requests during the store window. Server errors(5xx) aren't stored,
+// so the request can be retried.
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+type IdempotencyStore interface {
+	Start(ctx context.Context, key string, fingerprint string) (*idempotency.Response, error)
+	Finish(ctx context.Context, key string, response *idempotency.Response)
+	Cancel(ctx context.Context, key string)
+}
+
+func (h Handler) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if h.idempotency == nil || key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The payload is part of the request fingerprint, so it's read and restored
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(r.Body); err != nil {
+				h.HandleError(w, lanaerr.New(errors.New("payload error"), http.StatusBadRequest))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		// Keys are scoped to the basket
+		key = chi.URLParam(r, UrlParamBasketID) + "/" + key
+		response, err := h.idempotency.Start(ctx, key, requestFingerprint(r, body))
+		if err != nil {
+			h.HandleError(w, err)
+			return
+		}
+
+		// Replay the stored response
+		if response != nil {
+			for name, values := range response.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(HeaderIdempotentReplayed, "true")
+			w.WriteHeader(response.StatusCode)
+			w.Write(response.Body)
+			return
+		}
+
+		// Run the request & store its response. A request that doesn't finish(panic) is cancelled
+		finished := false
+		defer func() {
+			if !finished {
+				h.idempotency.Cancel(ctx, key)
+			}
+		}()
+
+		buf := &bytes.Buffer{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(buf)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		h.idempotency.Finish(ctx, key, &idempotency.Response{
+			StatusCode: status,
+			Header:     w.Header().Clone(),
+			Body:       buf.Bytes(),
+		})
+		finished = true
+	})
+}
+
+// requestFingerprint identifies the request by its method, path, query and payload. The query
+// is encoded sorted by key, so the order of its parameters doesn't change the fingerprint.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -1,12 +1,14 @@
 package rest
 
 import (
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/repository/metrics/prometheus"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -49,3 +51,30 @@ func getRoutePattern(chiCtx *chi.Context) string {
 	route = strings.Replace(route, "}", "", -1)
 	return route
 }
+
+// IfMatchMiddleware passes the basket versions of the If-Match header to the service, so changes
+// made on a stale basket fail with 412 Precondition Failed. The ETag of a basket is its version
+// (see BasketGet). Any version matches "*", and weak or unknown tags never match.
+func IfMatchMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+		if ifMatch == "" || ifMatch == "*" || r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		versions := make([]uint64, 0)
+		for _, tag := range strings.Split(ifMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+				continue
+			}
+			if version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64); err == nil {
+				versions = append(versions, version)
+			}
+		}
+
+		ctx := checkout.WithBasketVersions(r.Context(), versions)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
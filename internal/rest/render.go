@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+// The API version is taken from the URI(/v1, /v2). Both versions share the same handlers and only
+// differ in how the responses are represented:
+// - v1: money amounts are numbers in major units, like 10.5, and products have a single
+//       promotion_id, the first of their promotions (original representation)
+// - v2: money amounts are objects with the amount in minor units and the currency, like
+//       {"amount":1050,"currency":"EUR"}
+
+const (
+	APIVersion1 = "v1"
+	APIVersion2 = "v2"
+)
+
+type ctxKey string
+
+const ctxKeyAPIVersion ctxKey = "api-version"
+
+func APIVersionMiddleware(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ctxKeyAPIVersion, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func getAPIVersion(r *http.Request) string {
+	if version, ok := r.Context().Value(ctxKeyAPIVersion).(string); ok {
+		return version
+	}
+	return APIVersion1
+}
+
+// JSON renders the value with the representation of the requested API version.
+func (h Handler) JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	data, err := json.Marshal(v)
+	if err == nil && getAPIVersion(r) == APIVersion1 {
+		data, err = toV1Representation(data)
+	}
+	if err != nil {
+		h.HandleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	w.Write(append(data, '\n'))
+}
+
+// toV1Representation replaces every money object in the JSON document by its amount in major
+// units, and every list of promotion ids by its first id. The order of the keys is preserved.
+func toV1Representation(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	switch data[0] {
+	case '{':
+		return objectToV1Representation(data)
+	case '[':
+		return arrayToV1Representation(data)
+	default:
+		return data, nil
+	}
+}
+
+func objectToV1Representation(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // {
+		return nil, err
+	}
+
+	keys := make([]string, 0)
+	values := make([]json.RawMessage, 0)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		value := json.RawMessage{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		keys = append(keys, token.(string))
+		values = append(values, value)
+	}
+
+	// Money object
+	if len(keys) == 2 && keys[0] == "amount" && keys[1] == "currency" {
+		money := entities.Money{}
+		if err := json.Unmarshal(data, &money); err != nil {
+			return nil, err
+		}
+		return []byte(money.Decimal()), nil
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(keys[i])
+		value, err := toV1Representation(values[i])
+		if keys[i] == "promotion_ids" {
+			key, _ = json.Marshal("promotion_id")
+			value, err = firstPromotionID(values[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func arrayToV1Representation(data []byte) ([]byte, error) {
+	values := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for i := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := toV1Representation(values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// firstPromotionID returns the first id of the list of promotion ids, null if it's empty.
+func firstPromotionID(data []byte) ([]byte, error) {
+	ids := make([]string, 0)
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []byte("null"), nil
+	}
+	return json.Marshal(ids[0])
+}
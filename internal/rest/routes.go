@@ -24,51 +24,139 @@ func (h *Handler) RouterInit() http.Handler {
 
 	// API evolves over time and we need some kind of versioning system.
 	// I'm using the common URI versioning approach, but could be by header version,
-	// query param, accept header, domain, etc.
+	// query param, accept header, domain, etc. Both versions share the same endpoints,
+	// v2 only changes the representation of money amounts(see render.go).
 	//
 	// A metrics middleware is injected for all routes
-	r.With(MetricsMiddleware, middleware.Logger).Route("/v1/", func(r chi.Router) {
+	r.With(MetricsMiddleware, middleware.Logger, APIVersionMiddleware(APIVersion1)).
+		Route("/v1/", h.apiRoutes)
+	r.With(MetricsMiddleware, middleware.Logger, APIVersionMiddleware(APIVersion2)).
+		Route("/v2/", h.apiRoutes)
 
-		// Basket endpoints
-		r.Route("/baskets", func(r chi.Router) {
+	// List registered routes
+	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		fmt.Printf("  - %s [%s]\n", route, method)
+		return nil
+	}
+	fmt.Println("### Registered routes:")
+	chi.Walk(r, walkFunc)
+
+	return r
+}
+
+func (h *Handler) apiRoutes(r chi.Router) {
+	// Basket endpoints
+	r.Route("/baskets", func(r chi.Router) {
+		// Changes can require the basket version with If-Match
+		r.Use(IfMatchMiddleware)
+
+		// Changes retried with the same Idempotency-Key are applied once
+		r = r.With(h.IdempotencyMiddleware)
 
-			// Create basket
-			r.Post("/", h.BasketCreate)
+		// Create basket
+		r.Post("/", h.BasketCreate)
 
-			// Get basket details
-			r.Get("/{basketID}", h.BasketGet)
+		// Get basket details
+		r.Get("/{basketID}", h.BasketGet)
 
-			// Delete basket
-			r.Delete("/{basketID}", h.BasketDelete)
+		// Delete basket
+		r.Delete("/{basketID}", h.BasketDelete)
 
-			// Add product to basket
-			r.Post("/{basketID}/items", h.BasketAddItem)
+		// Add product to basket
+		r.Post("/{basketID}/items", h.BasketAddItem)
 
-			// Remove product from basket
-			r.Delete("/{basketID}/items/{productID}", h.BasketRemoveItem)
+		// Remove product from basket
+		r.Delete("/{basketID}/items/{productID}", h.BasketRemoveItem)
 
-		})
+		// Set the quantity of a product in the basket
+		r.Put("/{basketID}/items/{productID}", h.BasketSetItemQuantity)
 
-		// Product endpoints
-		r.Route("/products", func(r chi.Router) {
+		// Add, remove & set several products of the basket at once
+		r.Patch("/{basketID}/items", h.BasketUpdateItems)
 
-			// Get product list
-			r.Get("/", h.ProductList)
+		// Checkout basket
+		r.Post("/{basketID}/checkout", h.BasketCheckout)
 
-			// Get product information
-			r.Get("/{productID}", h.ProductGet)
+		// Apply coupon to basket
+		r.Post("/{basketID}/coupons", h.BasketApplyCoupon)
+
+		// Remove coupon from basket
+		r.Delete("/{basketID}/coupons/{code}", h.BasketRemoveCoupon)
+
+		// Get basket history
+		r.Get("/{basketID}/events", h.BasketEventList)
+
+		// Rebuild basket from its history
+		r.Get("/{basketID}/events/replay", h.BasketReplay)
 
-		})
 	})
 
-	// List registered routes
-	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
-		route = strings.Replace(route, "/*/", "/", -1)
-		fmt.Printf("  - %s [%s]\n", route, method)
-		return nil
-	}
-	fmt.Println("### Registered routes:")
-	chi.Walk(r, walkFunc)
+	// Product endpoints
+	r.Route("/products", func(r chi.Router) {
 
-	return r
+		// Get product list
+		r.Get("/", h.ProductList)
+
+		// Get product information
+		r.Get("/{productID}", h.ProductGet)
+
+		// Create product (admin)
+		r.Post("/", h.ProductCreate)
+
+		// Update product (admin)
+		r.Put("/{productID}", h.ProductUpdate)
+
+		// Delete product (admin)
+		r.Delete("/{productID}", h.ProductDelete)
+
+		// Get product stock (admin)
+		r.Get("/{productID}/stock", h.ProductStockGet)
+
+		// Update product stock on hand (admin)
+		r.Put("/{productID}/stock", h.ProductStockUpdate)
+
+	})
+
+	// Promotion endpoints
+	r.Route("/promotions", func(r chi.Router) {
+
+		// Get promotion list
+		r.Get("/", h.PromotionList)
+
+		// Get promotion information
+		r.Get("/{promotionID}", h.PromotionGet)
+
+		// Create promotion (admin)
+		r.Post("/", h.PromotionCreate)
+
+		// Update promotion (admin)
+		r.Put("/{promotionID}", h.PromotionUpdate)
+
+		// Delete promotion (admin)
+		r.Delete("/{promotionID}", h.PromotionDelete)
+
+	})
+
+	// Coupon endpoints
+	r.Route("/coupons", func(r chi.Router) {
+
+		// Get coupon information (admin)
+		r.Get("/{code}", h.CouponGet)
+
+		// Create coupon (admin)
+		r.Post("/", h.CouponCreate)
+
+		// Update coupon (admin)
+		r.Put("/{code}", h.CouponUpdate)
+
+	})
+
+	// Order endpoints
+	r.Route("/orders", func(r chi.Router) {
+
+		// Get order details
+		r.Get("/{orderID}", h.OrderGet)
+
+	})
 }
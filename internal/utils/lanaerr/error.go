@@ -52,3 +52,8 @@ func (e lanaError) GetStatusCode() int {
 func (e lanaError) GetError() error {
 	return e.Err
 }
+
+// Unwrap returns the wrapped error, so it can be inspected with errors.Is & errors.As.
+func (e lanaError) Unwrap() error {
+	return e.Err
+}
@@ -63,3 +63,14 @@ func TestNewFromStandardError(t *testing.T) {
 	assert.EqualError(t, newLErr.GetError(), "my custom error")
 	assert.Equal(t, 500, newLErr.GetStatusCode())
 }
+
+func TestUnwrap(t *testing.T) {
+	// Given
+	err := errors.New("my custom error")
+
+	// When
+	lErr := lanaerr.New(err, http.StatusNotFound)
+
+	// Then
+	assert.True(t, errors.Is(lErr, err))
+}
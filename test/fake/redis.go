@@ -0,0 +1,445 @@
+package fake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisServer is an in-process stand-in of a Redis server for the tests. It speaks the Redis
+// protocol but only knows the commands used by the lock: PING, AUTH, SET(with NX & PX), GET, DEL,
+// INCR, PEXPIRE and EVAL. EVAL runs the Lua scripts like Redis does, converting the replies of
+// redis.call and the returned value the same way: integers become Lua numbers(doubles), so the
+// scripts are tested with the precision they have in a real server.
+type RedisServer struct {
+	listener net.Listener
+	data     map[string]redisValue
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+	conns    map[net.Conn]struct{}
+}
+
+type redisValue struct {
+	value     string
+	expiresAt time.Time // Zero if it doesn't expire
+}
+
+func NewRedisServer() (*RedisServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RedisServer{
+		listener: listener,
+		data:     make(map[string]redisValue),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *RedisServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Get returns the value of the key, if it exists.
+func (s *RedisServer) Get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.get(key)
+	return v.value, ok
+}
+
+// Run runs the command as if sent by a client, returning the encoded reply.
+func (s *RedisServer) Run(args ...string) string {
+	return s.run(args)
+}
+
+// Expire deletes the key as if its TTL was over.
+func (s *RedisServer) Expire(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.data, key)
+}
+
+// Close stops the server and closes the client connections.
+func (s *RedisServer) Close() error {
+	err := s.listener.Close()
+
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *RedisServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns[conn] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *RedisServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.run(args)); err != nil {
+			return
+		}
+	}
+}
+
+// run runs the command, returning the encoded reply.
+func (s *RedisServer) run(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.exec(args)
+}
+
+// exec runs the command, returning the encoded reply. Must be called holding the mutex.
+func (s *RedisServer) exec(args []string) string {
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH":
+		return "+OK\r\n"
+	case "GET":
+		if len(args) != 2 {
+			return "-ERR wrong number of arguments for 'get' command\r\n"
+		}
+		v, ok := s.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(v.value)
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.get(key); ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SET":
+		return s.set(args)
+	case "INCR":
+		if len(args) != 2 {
+			return "-ERR wrong number of arguments for 'incr' command\r\n"
+		}
+		return s.incr(args[1])
+	case "PEXPIRE":
+		if len(args) != 3 {
+			return "-ERR wrong number of arguments for 'pexpire' command\r\n"
+		}
+		return s.pexpire(args[1], args[2])
+	case "EVAL":
+		return s.eval(args)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func (s *RedisServer) set(args []string) string {
+	if len(args) < 3 {
+		return "-ERR wrong number of arguments for 'set' command\r\n"
+	}
+	key, value := args[1], args[2]
+
+	nx := false
+	var expiresAt time.Time
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "PX":
+			if i+1 >= len(args) {
+				return "-ERR syntax error\r\n"
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || ms <= 0 {
+				return "-ERR invalid expire time in 'set' command\r\n"
+			}
+			expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			i++
+		default:
+			return "-ERR syntax error\r\n"
+		}
+	}
+
+	if _, ok := s.get(key); ok && nx {
+		return "$-1\r\n"
+	}
+	s.data[key] = redisValue{value: value, expiresAt: expiresAt}
+	return "+OK\r\n"
+}
+
+func (s *RedisServer) incr(key string) string {
+	v, _ := s.get(key)
+	n := int64(0)
+	if v.value != "" {
+		var err error
+		if n, err = strconv.ParseInt(v.value, 10, 64); err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+	}
+	n++
+	v.value = strconv.FormatInt(n, 10)
+	s.data[key] = v
+	return fmt.Sprintf(":%d\r\n", n)
+}
+
+func (s *RedisServer) pexpire(key string, ttl string) string {
+	ms, err := strconv.ParseInt(ttl, 10, 64)
+	if err != nil {
+		return "-ERR value is not an integer or out of range\r\n"
+	}
+	v, ok := s.get(key)
+	if !ok {
+		return ":0\r\n"
+	}
+	v.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	s.data[key] = v
+	return ":1\r\n"
+}
+
+func (s *RedisServer) eval(args []string) string {
+	if len(args) < 3 {
+		return "-ERR wrong number of arguments for 'eval' command\r\n"
+	}
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || numKeys < 0 || len(args) < 3+numKeys {
+		return "-ERR Number of keys can't be greater than number of args\r\n"
+	}
+	script, keys, argv := args[1], args[3:3+numKeys], args[3+numKeys:]
+
+	L := lua.NewState()
+	defer L.Close()
+	L.SetGlobal("KEYS", luaStrings(L, keys))
+	L.SetGlobal("ARGV", luaStrings(L, argv))
+	redis := L.NewTable()
+	L.SetField(redis, "call", L.NewFunction(s.luaCall))
+	L.SetGlobal("redis", redis)
+
+	top := L.GetTop()
+	if err := L.DoString(script); err != nil {
+		return fmt.Sprintf("-ERR Error running script: %s\r\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	if L.GetTop() == top {
+		return "$-1\r\n"
+	}
+	return luaToReply(L.Get(top + 1))
+}
+
+// luaCall runs redis.call: the command with the arguments of the script, its reply converted to
+// a Lua value. Error replies raise an error, like in Redis.
+func (s *RedisServer) luaCall(L *lua.LState) int {
+	args := make([]string, 0, L.GetTop())
+	for i := 1; i <= L.GetTop(); i++ {
+		args = append(args, lua.LVAsString(L.Get(i)))
+	}
+
+	reply, err := readRespValue(bufio.NewReader(strings.NewReader(s.exec(args))), L)
+	if err != nil {
+		L.RaiseError("%s", err.Error())
+		return 0
+	}
+	L.Push(reply)
+	return 1
+}
+
+// readRespValue reads an encoded reply as a Lua value, converted like Redis does: integers to
+// numbers, bulk strings to strings, nil to false, status replies to a table with an ok field and
+// arrays to tables. Error replies are returned as errors.
+func readRespValue(r *bufio.Reader, L *lua.LState) (lua.LValue, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	kind, value := line[0], line[1:]
+
+	switch kind {
+	case '+':
+		status := L.NewTable()
+		L.SetField(status, "ok", lua.LString(value))
+		return status, nil
+	case '-':
+		return nil, errors.New(value)
+	case ':':
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return lua.LNumber(float64(n)), nil
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return lua.LFalse, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return lua.LString(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		items := L.NewTable()
+		for i := 0; i < size; i++ {
+			item, err := readRespValue(r, L)
+			if err != nil {
+				return nil, err
+			}
+			items.Append(item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("protocol error: %q", line)
+	}
+}
+
+// luaToReply encodes the value returned by a script like Redis does: numbers are truncated to
+// integers, false & nil are nil, true is 1, and tables are arrays unless they have an ok or err
+// field.
+func luaToReply(value lua.LValue) string {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return fmt.Sprintf(":%d\r\n", int64(v))
+	case lua.LString:
+		return bulkString(string(v))
+	case lua.LBool:
+		if v {
+			return ":1\r\n"
+		}
+		return "$-1\r\n"
+	case *lua.LTable:
+		if ok, isString := v.RawGetString("ok").(lua.LString); isString {
+			return "+" + string(ok) + "\r\n"
+		}
+		if msg, isString := v.RawGetString("err").(lua.LString); isString {
+			return "-" + string(msg) + "\r\n"
+		}
+		reply := fmt.Sprintf("*%d\r\n", v.Len())
+		for i := 1; i <= v.Len(); i++ {
+			reply += luaToReply(v.RawGetInt(i))
+		}
+		return reply
+	default:
+		return "$-1\r\n"
+	}
+}
+
+func luaStrings(L *lua.LState, values []string) *lua.LTable {
+	table := L.NewTable()
+	for _, value := range values {
+		table.Append(lua.LString(value))
+	}
+	return table
+}
+
+// get returns the value of the key if it isn't expired. Must be called holding the mutex.
+func (s *RedisServer) get(key string) (redisValue, bool) {
+	v, ok := s.data[key]
+	if ok && !v.expiresAt.IsZero() && !time.Now().Before(v.expiresAt) {
+		delete(s.data, key)
+		return redisValue{}, false
+	}
+	return v, ok
+}
+
+func bulkString(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// readRedisCommand reads a command sent as an array of bulk strings.
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, fmt.Errorf("protocol error: %q", line)
+	}
+	size, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("protocol error: %q", line)
+	}
+
+	args := make([]string, size)
+	for i := range args {
+		line, err := readRedisLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, fmt.Errorf("protocol error: %q", line)
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("protocol error: %q", line)
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func readRedisLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -10,37 +10,147 @@ type FakeService struct {
 	mock.Mock
 }
 
-func (f FakeService) BasketCreate(ctx context.Context) (*entities.Basket, error) {
-	args := f.Called(ctx)
+func (f *FakeService) BasketCreate(ctx context.Context, basketDetail entities.BasketDetail) (*entities.Basket, error) {
+	args := f.Called(ctx, basketDetail)
 	return args.Get(0).(*entities.Basket), args.Error(1)
 }
 
-func (f FakeService) BasketGet(ctx context.Context, basketID string) (*entities.Basket, error) {
+func (f *FakeService) BasketGet(ctx context.Context, basketID string) (*entities.Basket, error) {
 	args := f.Called(ctx, basketID)
 	return args.Get(0).(*entities.Basket), args.Error(1)
 }
 
-func (f FakeService) BasketDelete(ctx context.Context, basketID string) error {
+func (f *FakeService) BasketDelete(ctx context.Context, basketID string) error {
 	args := f.Called(ctx, basketID)
 	return args.Error(0)
 }
 
-func (f FakeService) BasketAddItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+func (f *FakeService) BasketAddItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+	args := f.Called(ctx, basketID, itemDetail)
+	return args.Error(0)
+}
+
+func (f *FakeService) BasketRemoveItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
 	args := f.Called(ctx, basketID, itemDetail)
 	return args.Error(0)
 }
 
-func (f FakeService) BasketRemoveItem(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
+func (f *FakeService) BasketSetItemQuantity(ctx context.Context, basketID string, itemDetail entities.ItemDetail) error {
 	args := f.Called(ctx, basketID, itemDetail)
 	return args.Error(0)
 }
 
-func (f FakeService) ProductList(ctx context.Context) ([]entities.Product, error) {
+func (f *FakeService) BasketUpdateItems(ctx context.Context, basketID string, operations []entities.ItemOperation) error {
+	args := f.Called(ctx, basketID, operations)
+	return args.Error(0)
+}
+
+func (f *FakeService) BasketCheckout(ctx context.Context, basketID string) (*entities.Order, error) {
+	args := f.Called(ctx, basketID)
+	return args.Get(0).(*entities.Order), args.Error(1)
+}
+
+func (f *FakeService) BasketApplyCoupon(ctx context.Context, basketID string, couponDetail entities.CouponDetail) error {
+	args := f.Called(ctx, basketID, couponDetail)
+	return args.Error(0)
+}
+
+func (f *FakeService) BasketRemoveCoupon(ctx context.Context, basketID string, code string) error {
+	args := f.Called(ctx, basketID, code)
+	return args.Error(0)
+}
+
+func (f *FakeService) BasketExpireIdle(ctx context.Context) (int, error) {
+	args := f.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (f *FakeService) BasketEventList(ctx context.Context, basketID string) ([]entities.BasketEvent, error) {
+	args := f.Called(ctx, basketID)
+	return args.Get(0).([]entities.BasketEvent), args.Error(1)
+}
+
+func (f *FakeService) BasketReplay(ctx context.Context, basketID string) (*entities.Basket, error) {
+	args := f.Called(ctx, basketID)
+	return args.Get(0).(*entities.Basket), args.Error(1)
+}
+
+func (f *FakeService) ProductList(ctx context.Context) ([]entities.Product, error) {
 	args := f.Called(ctx)
 	return args.Get(0).([]entities.Product), args.Error(1)
 }
 
-func (f FakeService) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
+func (f *FakeService) ProductGet(ctx context.Context, productID string) (*entities.Product, error) {
 	args := f.Called(ctx, productID)
 	return args.Get(0).(*entities.Product), args.Error(1)
 }
+
+func (f *FakeService) OrderGet(ctx context.Context, orderID string) (*entities.Order, error) {
+	args := f.Called(ctx, orderID)
+	return args.Get(0).(*entities.Order), args.Error(1)
+}
+
+func (f *FakeService) ProductCreate(ctx context.Context, product entities.Product) (*entities.Product, error) {
+	args := f.Called(ctx, product)
+	return args.Get(0).(*entities.Product), args.Error(1)
+}
+
+func (f *FakeService) ProductUpdate(ctx context.Context, productID string, product entities.Product) (*entities.Product, error) {
+	args := f.Called(ctx, productID, product)
+	return args.Get(0).(*entities.Product), args.Error(1)
+}
+
+func (f *FakeService) ProductDelete(ctx context.Context, productID string) error {
+	args := f.Called(ctx, productID)
+	return args.Error(0)
+}
+
+func (f *FakeService) ProductStockGet(ctx context.Context, productID string) (*entities.Stock, error) {
+	args := f.Called(ctx, productID)
+	return args.Get(0).(*entities.Stock), args.Error(1)
+}
+
+func (f *FakeService) ProductStockUpdate(ctx context.Context, productID string, stockDetail entities.StockDetail) (*entities.Stock, error) {
+	args := f.Called(ctx, productID, stockDetail)
+	return args.Get(0).(*entities.Stock), args.Error(1)
+}
+
+func (f *FakeService) PromotionList(ctx context.Context) ([]entities.Promotion, error) {
+	args := f.Called(ctx)
+	return args.Get(0).([]entities.Promotion), args.Error(1)
+}
+
+func (f *FakeService) PromotionGet(ctx context.Context, promotionID string) (*entities.Promotion, error) {
+	args := f.Called(ctx, promotionID)
+	return args.Get(0).(*entities.Promotion), args.Error(1)
+}
+
+func (f *FakeService) PromotionCreate(ctx context.Context, promotion entities.Promotion) (*entities.Promotion, error) {
+	args := f.Called(ctx, promotion)
+	return args.Get(0).(*entities.Promotion), args.Error(1)
+}
+
+func (f *FakeService) PromotionUpdate(ctx context.Context, promotionID string, promotion entities.Promotion) (*entities.Promotion, error) {
+	args := f.Called(ctx, promotionID, promotion)
+	return args.Get(0).(*entities.Promotion), args.Error(1)
+}
+
+func (f *FakeService) PromotionDelete(ctx context.Context, promotionID string) error {
+	args := f.Called(ctx, promotionID)
+	return args.Error(0)
+}
+
+func (f *FakeService) CouponGet(ctx context.Context, code string) (*entities.Coupon, error) {
+	args := f.Called(ctx, code)
+	return args.Get(0).(*entities.Coupon), args.Error(1)
+}
+
+func (f *FakeService) CouponCreate(ctx context.Context, coupon entities.Coupon) (*entities.Coupon, error) {
+	args := f.Called(ctx, coupon)
+	return args.Get(0).(*entities.Coupon), args.Error(1)
+}
+
+func (f *FakeService) CouponUpdate(ctx context.Context, code string, coupon entities.Coupon) (*entities.Coupon, error) {
+	args := f.Called(ctx, code, coupon)
+	return args.Get(0).(*entities.Coupon), args.Error(1)
+}
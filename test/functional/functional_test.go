@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/gbrlmza/lana-bechallenge-checkout/cmd/config"
 	"github.com/gbrlmza/lana-bechallenge-checkout/cmd/container"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/domain/checkout/entities"
 	"github.com/gbrlmza/lana-bechallenge-checkout/internal/rest"
+	"github.com/gbrlmza/lana-bechallenge-checkout/test/fake"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -19,7 +21,7 @@ func buildTestDependencies() http.Handler {
 	ctx := context.Background()
 
 	// Container & service initialization
-	container := container.NewContainer(ctx)
+	container, _ := container.NewContainer(ctx, config.Config{})
 	service := checkout.NewService(container)
 
 	// Handler
@@ -108,25 +110,25 @@ func TestHandler_Functional_Success(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), newBasket)
 
 	// Assert expected basket values
-	assert.Equal(t, 82.5, newBasket.Subtotal)
-	assert.Equal(t, 20.0, newBasket.Discount)
-	assert.Equal(t, 62.5, newBasket.Total)
+	assert.Equal(t, entities.NewMoney(8250, entities.DefaultCurrency), newBasket.Subtotal)
+	assert.Equal(t, entities.NewMoney(2000, entities.DefaultCurrency), newBasket.Discount)
+	assert.Equal(t, entities.NewMoney(6250, entities.DefaultCurrency), newBasket.Total)
 	assert.Equal(t, 3, len(newBasket.Items))
 
 	// PEN: 3 units, $15 total, $5 discount
 	assert.Equal(t, uint(3), newBasket.Items["PEN"].Quantity)
-	assert.Equal(t, 15.0, newBasket.Items["PEN"].Total)
-	assert.Equal(t, 5.0, newBasket.Items["PEN"].Discount)
+	assert.Equal(t, entities.NewMoney(1500, entities.DefaultCurrency), newBasket.Items["PEN"].Total)
+	assert.Equal(t, entities.NewMoney(500, entities.DefaultCurrency), newBasket.Items["PEN"].Discount)
 
 	// TSHIRT: 3 units, $60 total, $15 discount
 	assert.Equal(t, uint(3), newBasket.Items["TSHIRT"].Quantity)
-	assert.Equal(t, 60.0, newBasket.Items["TSHIRT"].Total)
-	assert.Equal(t, 15.0, newBasket.Items["TSHIRT"].Discount)
+	assert.Equal(t, entities.NewMoney(6000, entities.DefaultCurrency), newBasket.Items["TSHIRT"].Total)
+	assert.Equal(t, entities.NewMoney(1500, entities.DefaultCurrency), newBasket.Items["TSHIRT"].Discount)
 
 	// MUG: 1 unit, $7.50 total, $0 discount
 	assert.Equal(t, uint(1), newBasket.Items["MUG"].Quantity)
-	assert.Equal(t, 7.5, newBasket.Items["MUG"].Total)
-	assert.Equal(t, 0.0, newBasket.Items["MUG"].Discount)
+	assert.Equal(t, entities.NewMoney(750, entities.DefaultCurrency), newBasket.Items["MUG"].Total)
+	assert.Equal(t, entities.NewMoney(0, entities.DefaultCurrency), newBasket.Items["MUG"].Discount)
 
 	//==================================================================================================
 	// 7-Delete basket
@@ -147,3 +149,338 @@ func TestHandler_Functional_Success(t *testing.T) {
 	// Basket shouldn't exists
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+func TestHandler_Functional_Checkout(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	router := buildTestDependencies()
+	basket := &entities.Basket{}
+	order := &entities.Order{}
+
+	// ### Functional test steps:
+	// 1-Create basket
+	// 2-Add items to basket
+	// 3-Checkout basket
+	// 4-Add items to the checked out basket
+	// 5-Get order
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 2-Add item to basket: 3 PEN
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":3}`))
+	router.ServeHTTP(w, r)
+
+	// 3-Checkout basket
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/checkout", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), order)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, order.ID)
+	assert.Equal(t, entities.NewMoney(1000, entities.DefaultCurrency), order.Total)
+
+	// 4-Add items to the checked out basket
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 5-Get order
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/orders/%s", order.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	storedOrder := &entities.Order{}
+	json.Unmarshal(w.Body.Bytes(), storedOrder)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, order.ID, storedOrder.ID)
+	assert.Equal(t, basket.ID, storedOrder.BasketID)
+	assert.Equal(t, uint(3), storedOrder.Items[0].Quantity)
+}
+
+func TestHandler_Functional_IfMatch(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	router := buildTestDependencies()
+	basket := &entities.Basket{}
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	// 2-Add item to basket with the current version
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":3}`))
+	r.Header.Set("If-Match", `"1"`)
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 3-Add item to basket with the stale version
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	r.Header.Set("If-Match", `"1"`)
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// 4-Get basket: only the first change is applied
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, uint(3), basket.Items["PEN"].Quantity)
+}
+
+func TestHandler_Functional_RedisLock(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	basket := &entities.Basket{}
+
+	// Service with the redis lock of a stand-in server
+	server, err := fake.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	cfg := config.Config{Lock: config.LockConfig{Type: "redis", Address: server.Addr()}}
+	container, err := container.NewContainer(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := rest.NewHandler(checkout.NewService(container)).RouterInit()
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 2-Add item to basket
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":3}`))
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 3-The basket is locked by another instance
+	server.Run("SET", "lock:basket-"+basket.ID, "other-instance", "PX", "60000")
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":1}`))
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusLocked, w.Code)
+	_, locked := server.Get("lock:basket-" + basket.ID)
+	assert.True(t, locked)
+}
+
+func TestHandler_Functional_BasketEvents(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	router := buildTestDependencies()
+	basket := &entities.Basket{}
+
+	// ### Functional test steps:
+	// 1-Create basket
+	// 2-Add & remove items
+	// 3-Checkout basket
+	// 4-Get basket events
+	// 5-Replay basket events
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 2-Add 3 PEN & remove 1
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":3}`))
+	router.ServeHTTP(w, r)
+
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items/PEN", basket.ID)
+	r, _ = http.NewRequest(http.MethodDelete, url, strings.NewReader(`{"quantity":1}`))
+	router.ServeHTTP(w, r)
+
+	// 3-Checkout basket
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/checkout", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, nil)
+	router.ServeHTTP(w, r)
+	order := &entities.Order{}
+	json.Unmarshal(w.Body.Bytes(), order)
+
+	// 4-Get basket events
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/events", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	events := []entities.BasketEvent{}
+	json.Unmarshal(w.Body.Bytes(), &events)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 4, len(events))
+	types := make([]entities.BasketEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []entities.BasketEventType{
+		entities.BasketEventCreated,
+		entities.BasketEventItemAdded,
+		entities.BasketEventItemRemoved,
+		entities.BasketEventCheckedOut,
+	}, types)
+	assert.Equal(t, order.ID, events[3].OrderID)
+
+	// 5-Replay basket events
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/events/replay", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	replayed := &entities.Basket{}
+	json.Unmarshal(w.Body.Bytes(), replayed)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, basket.ID, replayed.ID)
+	assert.Equal(t, order.ID, replayed.OrderID)
+	assert.Equal(t, uint(2), replayed.Items["PEN"].Quantity)
+	assert.Equal(t, order.Total, replayed.Total)
+}
+
+func TestHandler_Functional_BasketEvents_Coupons(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	router := buildTestDependencies()
+	basket := &entities.Basket{}
+
+	// ### Functional test steps:
+	// 1-Create basket
+	// 2-Add items & apply coupons
+	// 3-Remove a coupon
+	// 4-Get basket
+	// 5-Replay basket events
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 2-Add 3 TSHIRT & apply WELCOME10 and 5OFF
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"TSHIRT","quantity":3}`))
+	router.ServeHTTP(w, r)
+
+	for _, code := range []string{"WELCOME10", "5OFF"} {
+		w = httptest.NewRecorder()
+		url = fmt.Sprintf("/v1/baskets/%s/coupons", basket.ID)
+		r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"code":"`+code+`"}`))
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// 3-Remove WELCOME10
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/coupons/WELCOME10", basket.ID)
+	r, _ = http.NewRequest(http.MethodDelete, url, nil)
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 4-Get basket
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 5-Replay basket events
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/events/replay", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	replayed := &entities.Basket{}
+	json.Unmarshal(w.Body.Bytes(), replayed)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(replayed.Coupons))
+	assert.Equal(t, "5OFF", replayed.Coupons[0].Code)
+	assert.Equal(t, entities.NewMoney(4000, entities.DefaultCurrency), basket.Total)
+	assert.Equal(t, basket.Total, replayed.Total)
+}
+
+func TestHandler_Functional_PromotionEndedEarly(t *testing.T) {
+	var w *httptest.ResponseRecorder
+	var r *http.Request
+	var url string
+	router := buildTestDependencies()
+	basket := &entities.Basket{}
+
+	// ### Functional test steps:
+	// 1-Create basket
+	// 2-Add 3 PEN with 2x1
+	// 3-End the 2x1 through the promotion admin
+	// 4-Get basket, without the 2x1 discount
+
+	// 1-Create basket
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/v1/baskets", nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	// 2-Add 3 PEN with 2x1
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s/items", basket.ID)
+	r, _ = http.NewRequest(http.MethodPost, url, strings.NewReader(`{"id":"PEN","quantity":3}`))
+	router.ServeHTTP(w, r)
+
+	// 3-End the 2x1 through the promotion admin
+	w = httptest.NewRecorder()
+	body := `{"required_items":2,"free_items":1,"ends_at":"2020-01-01T00:00:00Z"}`
+	r, _ = http.NewRequest(http.MethodPut, "/v1/promotions/BUY2GET1FREE", strings.NewReader(body))
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 4-Get basket, without the 2x1 discount
+	w = httptest.NewRecorder()
+	url = fmt.Sprintf("/v1/baskets/%s", basket.ID)
+	r, _ = http.NewRequest(http.MethodGet, url, nil)
+	router.ServeHTTP(w, r)
+	json.Unmarshal(w.Body.Bytes(), basket)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, entities.Zero(entities.DefaultCurrency), basket.Discount)
+	assert.Equal(t, entities.NewMoney(1500, entities.DefaultCurrency), basket.Total)
+}